@@ -2,10 +2,25 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"user-service/internal/archive"
 	"user-service/internal/handlers"
+	"user-service/internal/logging"
+	"user-service/internal/metrics"
+	"user-service/internal/middleware"
+	"user-service/internal/models"
+	"user-service/internal/notify"
+	"user-service/internal/openapi"
+	"user-service/internal/outbox"
+	"user-service/internal/redact"
 	"user-service/internal/repository"
 	"user-service/internal/service"
 	"user-service/pkg/storage"
@@ -18,14 +33,27 @@ import (
 
 func main() {
 	// Load environment variables
-	if err := godotenv.Load(); err != nil {
-		log.Printf("Warning: .env file not found")
+	envErr := godotenv.Load()
+
+	// Log JSON to stdout, tagged with request IDs
+	logger, err := logging.New(os.Stdout, logging.Config{
+		Level:  os.Getenv("LOG_LEVEL"),
+		Format: os.Getenv("LOG_FORMAT"),
+	})
+	if err != nil {
+		log.Fatalf("Failed to configure logging: %v", err)
+	}
+	slog.SetDefault(logger)
+	if envErr != nil {
+		slog.Warn(".env file not found")
 	}
 
 	// Initialize MongoDB connection
-	mongoClient, err := mongo.Connect(context.Background(), options.Client().ApplyURI(os.Getenv("MONGODB_URI")))
+	mongoClient, err := mongo.Connect(context.Background(), options.Client().
+		ApplyURI(os.Getenv("MONGODB_URI")).
+		SetMonitor(metrics.CommandMonitor()))
 	if err != nil {
-		log.Fatalf("Failed to connect to MongoDB: %v", err)
+		fatal("Failed to connect to MongoDB", "error", err)
 	}
 	defer mongoClient.Disconnect(context.Background())
 
@@ -44,10 +72,10 @@ func main() {
 			BaseDir: baseDir,
 		})
 		if err != nil {
-			log.Fatalf("Failed to initialize local storage: %v", err)
+			fatal("Failed to initialize local storage", "error", err)
 		}
-		fileStorage = localStorage
-		log.Printf("Using local storage at: %s", baseDir)
+		fileStorage = metrics.InstrumentStorage(localStorage, "local")
+		slog.Info("Using local storage", "dir", baseDir)
 	} else {
 		// Use GCS storage
 		gcsConfig := storage.GCSConfig{
@@ -57,58 +85,192 @@ func main() {
 		}
 		gcsStorage, err := storage.NewGCSStorage(gcsConfig)
 		if err != nil {
-			log.Printf("Failed to initialize GCS storage, falling back to local storage: %v", err)
+			slog.Error("Failed to initialize GCS storage, falling back to local storage", "error", err)
 			baseDir := filepath.Join(os.TempDir(), "analyticsai-files")
 			localStorage, err := storage.NewLocalStorage(storage.LocalStorageConfig{
 				BaseDir: baseDir,
 			})
 			if err != nil {
-				log.Fatalf("Failed to initialize local storage: %v", err)
+				fatal("Failed to initialize local storage", "error", err)
 			}
-			fileStorage = localStorage
-			log.Printf("Using local storage at: %s", baseDir)
+			fileStorage = metrics.InstrumentStorage(localStorage, "local")
+			slog.Info("Using local storage", "dir", baseDir)
 		} else {
-			fileStorage = gcsStorage
-			log.Printf("Using GCS storage with bucket: %s", gcsConfig.BucketName)
+			fileStorage = metrics.InstrumentStorage(gcsStorage, "gcs")
+			slog.Info("Using GCS storage", "bucket", gcsConfig.BucketName)
 		}
 	}
 
 	// Initialize repositories
-	fileRepo := repository.NewFileRepository(db)
+	outboxRepo := repository.NewOutboxRepository(db)
+	if err := outboxRepo.EnsureIndexes(context.Background()); err != nil {
+		slog.Warn("Failed to create indexes", "indexes", "outbox", "error", err)
+	}
+	fileRepo := repository.NewFileRepository(db, outboxRepo)
+	if err := fileRepo.EnsureIndexes(context.Background()); err != nil {
+		slog.Warn("Failed to create indexes", "indexes", "file", "error", err)
+	}
+	quotaRepo := repository.NewQuotaRepository(db)
+	if err := quotaRepo.EnsureIndexes(context.Background()); err != nil {
+		slog.Warn("Failed to create indexes", "indexes", "quota", "error", err)
+	}
+	searchIndexRepo := repository.NewSearchIndexRepository(db)
+	if err := searchIndexRepo.EnsureIndexes(context.Background()); err != nil {
+		slog.Warn("Failed to create indexes", "indexes", "search index", "error", err)
+	}
+	patternRepo := repository.NewPatternRepository(db)
+	if err := patternRepo.EnsureIndexes(context.Background()); err != nil {
+		slog.Warn("Failed to create indexes", "indexes", "pattern", "error", err)
+	}
+	jobRepo := repository.NewJobRepository(db)
+	if err := jobRepo.EnsureIndexes(context.Background()); err != nil {
+		slog.Warn("Failed to create indexes", "indexes", "job", "error", err)
+	}
+	settingsRepo := repository.NewSettingsRepository(db)
+	if err := settingsRepo.EnsureIndexes(context.Background()); err != nil {
+		slog.Warn("Failed to create indexes", "indexes", "settings", "error", err)
+	}
+	savedQueryRepo := repository.NewSavedQueryRepository(db)
+	if err := savedQueryRepo.EnsureIndexes(context.Background()); err != nil {
+		slog.Warn("Failed to create indexes", "indexes", "saved query", "error", err)
+	}
+	alertRepo := repository.NewAlertRepository(db)
+	if err := alertRepo.EnsureIndexes(context.Background()); err != nil {
+		slog.Warn("Failed to create indexes", "indexes", "alert", "error", err)
+	}
+	webhookRepo := repository.NewWebhookRepository(db)
+	if err := webhookRepo.EnsureIndexes(context.Background()); err != nil {
+		slog.Warn("Failed to create indexes", "indexes", "webhook", "error", err)
+	}
+	deliveryRepo := repository.NewDeliveryRepository(db)
+	if err := deliveryRepo.EnsureIndexes(context.Background()); err != nil {
+		slog.Warn("Failed to create indexes", "indexes", "webhook delivery", "error", err)
+	}
+	auditRepo := repository.NewAuditRepository(db)
+	if err := auditRepo.EnsureIndexes(context.Background()); err != nil {
+		slog.Warn("Failed to create indexes", "indexes", "audit", "error", err)
+	}
 
 	// Initialize services
-	fileService := service.NewFileService(fileRepo, fileStorage)
+	quotaService := service.NewQuotaService(quotaRepo, service.QuotaConfig{
+		MaxBytes: getEnvInt64("QUOTA_MAX_BYTES", 1<<30),
+		MaxFiles: getEnvInt64("QUOTA_MAX_FILES", 1000),
+	})
+	uploadPolicy := service.DefaultUploadPolicy()
+	uploadPolicy.MaxSize = getEnvInt64("UPLOAD_MAX_SIZE", uploadPolicy.MaxSize)
+	uploadPolicy.MaxSizeByType = getEnvSizeMap("UPLOAD_MAX_SIZE_BY_TYPE")
+	if extensions, ok := getEnvList("UPLOAD_ALLOWED_EXTENSIONS"); ok {
+		uploadPolicy.AllowedExtensions = extensions
+	}
+	if mimeTypes, ok := getEnvList("UPLOAD_ALLOWED_MIME_TYPES"); ok {
+		uploadPolicy.AllowedMimeTypes = mimeTypes
+	}
+	uploadPolicy.MaxArchiveSize = getEnvInt64("ARCHIVE_MAX_SIZE", uploadPolicy.MaxArchiveSize)
+	uploadPolicy.MaxAppendSize = getEnvInt64("APPEND_MAX_SIZE", uploadPolicy.MaxAppendSize)
+	uploadPolicy.Archive = archive.Limits{
+		MaxEntries:   int(getEnvInt64("ARCHIVE_MAX_ENTRIES", 1000)),
+		MaxTotalSize: getEnvInt64("ARCHIVE_MAX_TOTAL_SIZE", 100<<20),
+		MaxRatio:     getEnvInt64("ARCHIVE_MAX_RATIO", 100),
+	}
+	if mode := os.Getenv("REDACTION_MODE"); mode != "" {
+		uploadPolicy.Redaction = models.RedactionMode(mode)
+		if !slices.Contains(models.RedactionModes, uploadPolicy.Redaction) {
+			fatal("Invalid REDACTION_MODE", "value", mode)
+		}
+	}
+	if categories, ok := getEnvList("REDACTION_DETECTORS"); ok {
+		detectors, err := redact.Lookup(categories)
+		if err != nil {
+			fatal("Invalid REDACTION_DETECTORS", "error", err)
+		}
+		uploadPolicy.Detectors = detectors
+	}
+	analysisService := service.NewAnalysisService(fileRepo, searchIndexRepo, patternRepo, fileStorage, service.AnalysisConfig{
+		Workers:       int(getEnvInt64("ANALYSIS_WORKERS", 2)),
+		QueueSize:     int(getEnvInt64("ANALYSIS_QUEUE_SIZE", 100)),
+		SampleLines:   int(getEnvInt64("FORMAT_SAMPLE_LINES", 200)),
+		SweepInterval: time.Duration(getEnvInt64("ANALYSIS_SWEEP_INTERVAL_SECONDS", 300)) * time.Second,
+	})
+	webhookService := service.NewWebhookService(webhookRepo, deliveryRepo, nil, service.WebhookConfig{
+		Workers:     int(getEnvInt64("WEBHOOK_WORKERS", 4)),
+		MaxAttempts: int(getEnvInt64("WEBHOOK_MAX_ATTEMPTS", 8)),
+		RetryBase:   time.Duration(getEnvInt64("WEBHOOK_RETRY_BASE_SECONDS", 10)) * time.Second,
+		RetryMax:    time.Duration(getEnvInt64("WEBHOOK_RETRY_MAX_SECONDS", 3600)) * time.Second,
+		Timeout:     time.Duration(getEnvInt64("WEBHOOK_TIMEOUT_SECONDS", 10)) * time.Second,
+	})
+	webhookService.Start(context.Background())
+	publisher, err := newOutboxPublisher()
+	if err != nil {
+		fatal("Failed to initialize outbox publisher", "error", err)
+	}
+	service.NewOutboxRelay(outboxRepo, publisher, service.OutboxConfig{
+		PollInterval: time.Duration(getEnvInt64("OUTBOX_POLL_INTERVAL_SECONDS", 1)) * time.Second,
+		BatchSize:    int(getEnvInt64("OUTBOX_BATCH_SIZE", 100)),
+		GapTimeout:   time.Duration(getEnvInt64("OUTBOX_GAP_TIMEOUT_SECONDS", 60)) * time.Second,
+	}).Start(context.Background())
+	notifier := notify.Multi{notify.Log{}, webhookService}
+	queryService := service.NewQueryService(savedQueryRepo, alertRepo, fileRepo, fileStorage, notifier)
+	settingsService := service.NewSettingsService(settingsRepo)
+	fileService := service.NewFileService(fileRepo, fileStorage, quotaService, uploadPolicy, analysisService, settingsService, notifier)
+	analysisService.OnComplete(fileService.AnalysisCompleted)
+	analysisService.OnComplete(queryService.Evaluate)
+	analysisService.Start(context.Background())
+	metrics.WatchAnalysisQueue(analysisService.QueueLength, analysisService.QueueCapacity)
+	searchService := service.NewSearchService(fileRepo, searchIndexRepo, fileStorage)
+	jobService := service.NewJobService(jobRepo, service.JobConfig{
+		Workers:       int(getEnvInt64("JOB_WORKERS", 2)),
+		QueueSize:     int(getEnvInt64("JOB_QUEUE_SIZE", 100)),
+		SweepInterval: time.Duration(getEnvInt64("JOB_SWEEP_INTERVAL_SECONDS", 300)) * time.Second,
+	})
+	exportService := service.NewExportService(fileRepo, fileStorage, quotaService, jobService, service.ExportConfig{
+		SyncMaxSize: getEnvInt64("EXPORT_SYNC_MAX_SIZE", 10<<20),
+	})
+	mergeService := service.NewMergeService(fileRepo, fileStorage, quotaService, jobService, service.MergeConfig{
+		MaxFiles: int(getEnvInt64("MERGE_MAX_FILES", 20)),
+	})
+	jobService.Start(context.Background())
 
-	// Initialize handlers
-	fileHandler := handlers.NewFileHandler(fileService)
+	auditService := service.NewAuditService(auditRepo, os.Getenv("AUDIT_HASH_CHAIN") == "true")
+	var adminIDs []uint
+	adminList, _ := getEnvList("ADMIN_USER_IDS")
+	for _, item := range adminList {
+		id, err := strconv.ParseUint(item, 10, 0)
+		if err != nil {
+			fatal("Invalid ADMIN_USER_IDS entry", "value", item)
+		}
+		adminIDs = append(adminIDs, uint(id))
+	}
 
 	// Set up Gin router
-	router := gin.Default()
-
-	// Add middleware
-	router.Use(gin.Logger())
-	router.Use(gin.Recovery())
-
-	// Add authentication middleware
-	router.Use(func(c *gin.Context) {
-		// TODO: Implement proper authentication
-		// For now, we'll just set a dummy user ID
-		c.Set("user_id", uint(1))
-		c.Next()
+	gin.DebugPrintRouteFunc = func(method, path, handler string, handlers int) {
+		slog.Debug("Registered route", "method", method, "path", path, "handler", handler)
+	}
+	router := newRouter(routeDeps{
+		file:     handlers.NewFileHandler(fileService),
+		usage:    handlers.NewUsageHandler(quotaService),
+		search:   handlers.NewSearchHandler(searchService),
+		settings: handlers.NewSettingsHandler(settingsService),
+		export:   handlers.NewExportHandler(exportService),
+		merge:    handlers.NewMergeHandler(mergeService),
+		job:      handlers.NewJobHandler(jobService),
+		query:    handlers.NewQueryHandler(queryService),
+		webhook:  handlers.NewWebhookHandler(webhookService),
+		audit:    handlers.NewAuditHandler(auditService),
+
+		// Every file access and mutation, and every read of the audit log, is
+		// recorded in the audit log
+		audited:      middleware.Audit(auditService),
+		requireAdmin: middleware.RequireAdmin(adminIDs),
+		swaggerUI:    os.Getenv("SWAGGER_UI") == "true",
 	})
 
-	// API routes
-	api := router.Group("/api/v1")
-	{
-		files := api.Group("/files")
-		{
-			files.POST("/upload", fileHandler.UploadFile)
-			files.POST("/upload-url", fileHandler.UploadFileFromURL)
-			files.GET("", fileHandler.ListFiles)
-			files.DELETE("/:id", fileHandler.DeleteFile)
-			files.PATCH("/:id/hide", fileHandler.HideFile)
-			files.GET("/:id/download", fileHandler.DownloadFile)
-		}
+	// Refuse to start with routes the spec doesn't describe
+	missing, err := openapi.MissingRoutes(router.Routes())
+	if err != nil {
+		fatal("Failed to check OpenAPI spec", "error", err)
+	}
+	if len(missing) > 0 {
+		fatal("OpenAPI spec is missing routes", "routes", missing)
 	}
 
 	// Start server
@@ -117,8 +279,96 @@ func main() {
 		port = "8080"
 	}
 
-	log.Printf("Server starting on port %s", port)
+	slog.Info("Server starting", "port", port)
 	if err := router.Run(":" + port); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+		fatal("Failed to start server", "error", err)
+	}
+}
+
+// fatal logs an error and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// getEnvInt64 reads an integer environment variable, falling back to def when
+// it is unset or malformed.
+func getEnvInt64(key string, def int64) int64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		slog.Warn("Invalid environment variable, using default", "key", key, "default", def, "error", err)
+		return def
+	}
+	return n
+}
+
+// getEnvList reads a comma-separated environment variable. The second result
+// is false when the variable is unset, so callers can keep their defaults;
+// an explicitly empty value yields an empty list.
+func getEnvList(key string) ([]string, bool) {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return nil, false
+	}
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list, true
+}
+
+// getEnvSizeMap reads a comma-separated list of key=bytes pairs, such as
+// "application/json=5242880,text/plain=10485760".
+func getEnvSizeMap(key string) map[string]int64 {
+	items, _ := getEnvList(key)
+	sizes := make(map[string]int64, len(items))
+	for _, item := range items {
+		name, value, found := strings.Cut(item, "=")
+		n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if !found || err != nil {
+			slog.Warn("Ignoring invalid environment variable entry", "key", key, "value", item)
+			continue
+		}
+		sizes[strings.TrimSpace(name)] = n
+	}
+	return sizes
+}
+
+// newOutboxPublisher returns the publisher named by OUTBOX_PUBLISHER. The
+// default in-process channel is drained into the log, for deployments
+// without a message broker.
+func newOutboxPublisher() (outbox.Publisher, error) {
+	switch name := os.Getenv("OUTBOX_PUBLISHER"); name {
+	case "", "channel":
+		publisher := outbox.NewChannel(100)
+		go func() {
+			for msg := range publisher.Messages() {
+				slog.Info("Outbox event", "type", msg.Type, "file_id", msg.FileID, "sequence", msg.Sequence, "event_id", msg.ID)
+			}
+		}()
+		return publisher, nil
+	case "nats":
+		subject := os.Getenv("OUTBOX_NATS_SUBJECT")
+		if subject == "" {
+			subject = "analyticsai.events"
+		}
+		publisher, err := outbox.NewNATS(outbox.NATSConfig{
+			URL:           os.Getenv("OUTBOX_NATS_URL"),
+			SubjectPrefix: subject,
+			JetStream:     os.Getenv("OUTBOX_NATS_JETSTREAM") == "true",
+		})
+		if err != nil {
+			return nil, err
+		}
+		slog.Info("Publishing outbox events to NATS", "subject", subject+".*")
+		return publisher, nil
+	default:
+		return nil, fmt.Errorf("unknown OUTBOX_PUBLISHER %q", name)
 	}
 }
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"user-service/internal/handlers"
+	"user-service/internal/metrics"
+	"user-service/internal/middleware"
+	"user-service/internal/models"
+	"user-service/internal/openapi"
+
+	"github.com/gin-gonic/gin"
+)
+
+// routeDeps holds the handlers and middleware the routes are built from.
+type routeDeps struct {
+	file     *handlers.FileHandler
+	usage    *handlers.UsageHandler
+	search   *handlers.SearchHandler
+	settings *handlers.SettingsHandler
+	export   *handlers.ExportHandler
+	merge    *handlers.MergeHandler
+	job      *handlers.JobHandler
+	query    *handlers.QueryHandler
+	webhook  *handlers.WebhookHandler
+	audit    *handlers.AuditHandler
+
+	// audited records a request in the audit log under an action.
+	audited func(action models.AuditAction) gin.HandlerFunc
+
+	// requireAdmin rejects requests from users who are not admins.
+	requireAdmin gin.HandlerFunc
+
+	// swaggerUI serves the Swagger UI at /docs.
+	swaggerUI bool
+}
+
+// registerRoutes adds the API, metrics and documentation routes. Every API
+// route must be described in the OpenAPI spec.
+func registerRoutes(router *gin.Engine, deps routeDeps) {
+	audited := deps.audited
+
+	// API routes
+	api := router.Group("/api/v1")
+	{
+		files := api.Group("/files")
+		{
+			files.POST("/upload", audited(models.AuditFileUpload), deps.file.UploadFile)
+			files.POST("/upload-url", audited(models.AuditFileUploadURL), deps.file.UploadFileFromURL)
+			files.POST("/merge", audited(models.AuditFileMerge), deps.merge.Merge)
+			files.GET("", audited(models.AuditFileList), deps.file.ListFiles)
+			files.DELETE("/:id", audited(models.AuditFileDelete), deps.file.DeleteFile)
+			files.PATCH("/:id/hide", audited(models.AuditFileHide), deps.file.HideFile)
+			files.GET("/:id/download", audited(models.AuditFileDownload), deps.file.DownloadFile)
+			files.GET("/:id/preview", audited(models.AuditFilePreview), deps.file.PreviewFile)
+			files.GET("/:id/search", audited(models.AuditFileSearch), deps.file.SearchFile)
+			files.GET("/:id/analysis", audited(models.AuditFileAnalysis), deps.file.GetAnalysis)
+			files.GET("/:id/patterns", audited(models.AuditFilePatterns), deps.file.GetPatterns)
+			files.GET("/:id/timeline", audited(models.AuditFileTimeline), deps.file.GetTimeline)
+			files.GET("/:id/export", audited(models.AuditFileExport), deps.export.Export)
+			files.POST("/:id/append", audited(models.AuditFileAppend), deps.file.AppendFile)
+			files.GET("/:id/tail", audited(models.AuditFileTail), deps.file.TailFile)
+		}
+
+		admin := api.Group("/admin")
+		{
+			admin.GET("/audit", audited(models.AuditLogList), deps.requireAdmin, deps.audit.ListEntries)
+			admin.GET("/audit/export", audited(models.AuditLogExport), deps.requireAdmin, deps.audit.Export)
+			admin.GET("/audit/verify", audited(models.AuditLogVerify), deps.requireAdmin, deps.audit.Verify)
+			admin.PUT("/quotas/:user_id", audited(models.AuditQuotaUpdate), deps.requireAdmin, deps.usage.SetLimits)
+		}
+
+		api.GET("/usage", deps.usage.GetUsage)
+		api.GET("/search", deps.search.Search)
+		api.GET("/settings", deps.settings.GetSettings)
+		api.PUT("/settings", deps.settings.UpdateSettings)
+		api.GET("/jobs/:id", deps.job.GetJob)
+		api.POST("/queries", deps.query.CreateQuery)
+		api.GET("/queries", deps.query.ListQueries)
+		api.GET("/queries/:id", deps.query.GetQuery)
+		api.PUT("/queries/:id", deps.query.UpdateQuery)
+		api.DELETE("/queries/:id", deps.query.DeleteQuery)
+		api.GET("/alerts", deps.query.ListAlerts)
+		api.POST("/webhooks", deps.webhook.CreateWebhook)
+		api.GET("/webhooks", deps.webhook.ListWebhooks)
+		api.GET("/webhooks/:id", deps.webhook.GetWebhook)
+		api.PUT("/webhooks/:id", deps.webhook.UpdateWebhook)
+		api.DELETE("/webhooks/:id", deps.webhook.DeleteWebhook)
+		api.GET("/webhooks/:id/deliveries", deps.webhook.ListDeliveries)
+		api.POST("/webhooks/:id/deliveries/:delivery_id/redeliver", deps.webhook.Redeliver)
+	}
+
+	// Prometheus metrics
+	router.GET("/metrics", gin.WrapH(metrics.Handler()))
+
+	// API documentation
+	router.GET("/openapi.json", openapi.Handler)
+	if deps.swaggerUI {
+		router.GET("/docs", openapi.SwaggerUIHandler)
+		router.StaticFS("/docs/assets", openapi.SwaggerAssets())
+	}
+}
+
+// newRouter returns a router with the service's middleware and routes.
+func newRouter(deps routeDeps) *gin.Engine {
+	router := gin.New()
+
+	// Add middleware
+	router.Use(middleware.RequestID())
+	router.Use(middleware.RequestLogger())
+	router.Use(middleware.Metrics())
+	router.Use(middleware.Recovery())
+	router.Use(middleware.ErrorHandler())
+
+	// Add authentication middleware
+	router.Use(func(c *gin.Context) {
+		// TODO: Implement proper authentication
+		// For now, we'll just set a dummy user ID
+		c.Set("user_id", uint(1))
+		c.Next()
+	})
+
+	registerRoutes(router, deps)
+	return router
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"user-service/internal/models"
+	"user-service/internal/openapi"
+
+	"github.com/gin-gonic/gin"
+)
+
+// testRouter builds the service's router without any backing services. The
+// handlers are never called, only registered.
+func testRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	pass := func(c *gin.Context) { c.Next() }
+	return newRouter(routeDeps{
+		audited:      func(models.AuditAction) gin.HandlerFunc { return pass },
+		requireAdmin: pass,
+		swaggerUI:    true,
+	})
+}
+
+func TestRoutesAreDocumented(t *testing.T) {
+	missing, err := openapi.MissingRoutes(testRouter().Routes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, route := range missing {
+		t.Errorf("%s is not described in internal/openapi/openapi.json", route)
+	}
+}
+
+func TestSwaggerUIIsSelfContained(t *testing.T) {
+	router := testRouter()
+	for _, path := range []string{"/docs", "/docs/assets/swagger-ui-bundle.js", "/docs/assets/swagger-ui.css", "/openapi.json"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("GET %s: status %d, want %d", path, w.Code, http.StatusOK)
+		}
+		if w.Body.Len() == 0 {
+			t.Errorf("GET %s: empty body", path)
+		}
+	}
+}
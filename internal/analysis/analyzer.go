@@ -0,0 +1,150 @@
+// Package analysis computes statistics over stored log files.
+package analysis
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"unicode/utf8"
+	"user-service/internal/logtime"
+	"user-service/internal/models"
+)
+
+// Encodings reported by Analyze.
+const (
+	EncodingASCII   = "ascii"
+	EncodingUTF8    = "utf-8"
+	EncodingUTF16LE = "utf-16le"
+	EncodingUTF16BE = "utf-16be"
+	EncodingLatin1  = "iso-8859-1"
+	EncodingBinary  = "binary"
+)
+
+// readBufferSize bounds memory use; longer lines are processed in pieces.
+const readBufferSize = 64 * 1024
+
+// Analyze streams r once and computes line and byte counts, the detected
+// encoding, and the first and last timestamps that appear in the content.
+func Analyze(ctx context.Context, r io.Reader) (*models.FileAnalysis, error) {
+	reader := bufio.NewReaderSize(r, readBufferSize)
+	result := &models.FileAnalysis{}
+	detector := &encodingDetector{}
+
+	atLineStart := true
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if len(chunk) > 0 {
+			result.ByteCount += int64(len(chunk))
+			detector.write(chunk)
+
+			if atLineStart {
+				result.LineCount++
+				if result.LineCount%10000 == 0 {
+					if ctxErr := ctx.Err(); ctxErr != nil {
+						return nil, ctxErr
+					}
+				}
+				if t, ok := logtime.Extract(string(chunk[:min(len(chunk), 256)])); ok {
+					t = t.UTC()
+					if result.FirstTimestamp == nil {
+						result.FirstTimestamp = &t
+					}
+					result.LastTimestamp = &t
+				}
+			}
+			atLineStart = chunk[len(chunk)-1] == '\n'
+		}
+
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result.Encoding = detector.result()
+	return result, nil
+}
+
+// encodingDetector incrementally classifies a byte stream's text encoding.
+type encodingDetector struct {
+	started  bool
+	bom      string
+	pending  []byte
+	invalid  bool
+	nonASCII bool
+	nul      bool
+}
+
+func (d *encodingDetector) write(p []byte) {
+	if !d.started {
+		d.started = true
+		switch {
+		case bytes.HasPrefix(p, []byte{0xEF, 0xBB, 0xBF}):
+			d.bom = EncodingUTF8
+		case bytes.HasPrefix(p, []byte{0xFF, 0xFE}):
+			d.bom = EncodingUTF16LE
+		case bytes.HasPrefix(p, []byte{0xFE, 0xFF}):
+			d.bom = EncodingUTF16BE
+		}
+	}
+	if d.bom != "" {
+		return
+	}
+
+	if bytes.IndexByte(p, 0) >= 0 {
+		d.nul = true
+	}
+	if d.invalid {
+		return
+	}
+
+	data := p
+	if len(d.pending) > 0 {
+		data = append(append([]byte{}, d.pending...), p...)
+	}
+
+	// Hold back a trailing incomplete rune until the next write
+	cut := len(data)
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				cut = i
+			}
+			break
+		}
+	}
+	tail := data[cut:]
+	data = data[:cut]
+
+	for _, b := range data {
+		if b >= utf8.RuneSelf {
+			d.nonASCII = true
+			break
+		}
+	}
+	if d.nonASCII && !utf8.Valid(data) {
+		d.invalid = true
+	}
+	d.pending = append(d.pending[:0], tail...)
+}
+
+func (d *encodingDetector) result() string {
+	switch {
+	case d.bom != "":
+		return d.bom
+	case d.nul:
+		return EncodingBinary
+	case d.invalid || len(d.pending) > 0:
+		return EncodingLatin1
+	case d.nonASCII:
+		return EncodingUTF8
+	default:
+		return EncodingASCII
+	}
+}
@@ -0,0 +1,196 @@
+package analysis
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"regexp"
+	"strings"
+	"user-service/internal/models"
+)
+
+// maxSampleLineLength caps how much of each sampled line is kept.
+const maxSampleLineLength = 4096
+
+// minConfidence is the share of sampled lines a structured format must match
+// before it is preferred over plain text.
+const minConfidence = 0.6
+
+var (
+	// <165>1 2003-10-11T22:14:15.003Z host app 1234 ID47 - message
+	syslog5424Pattern = regexp.MustCompile(`^<\d{1,3}>\d{1,2} (\S+) \S+ \S+ \S+ \S+ `)
+
+	// <34>Oct 11 22:14:15 host app[123]: message
+	syslog3164Pattern = regexp.MustCompile(`^(<\d{1,3}>)?[A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2} \S+ \S`)
+
+	// 127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /a.gif HTTP/1.0" 200 2326 "ref" "agent"
+	combinedPattern = regexp.MustCompile(`^\S+ \S+ \S+ \[[^\]]+\] "[^"]*" \d{3} (\d+|-)`)
+
+	logfmtPairPattern = regexp.MustCompile(`^[A-Za-z_][\w.\-]*=("(?:[^"\\]|\\.)*"|\S*)`)
+)
+
+// DetectFormat samples up to sampleLines non-empty lines from r and classifies
+// them.
+func DetectFormat(r io.Reader, sampleLines int) (*models.FormatDetection, error) {
+	lines, err := sample(r, sampleLines)
+	if err != nil {
+		return nil, err
+	}
+	return ClassifyLines(lines), nil
+}
+
+// ClassifyLines picks the format that best explains the given lines. The
+// confidence is the share of lines that match the chosen format; files that
+// match no structured format well enough are plain text.
+func ClassifyLines(lines []string) *models.FormatDetection {
+	result := &models.FormatDetection{
+		Format:       models.LogFormatText,
+		Confidence:   1,
+		SampledLines: len(lines),
+	}
+	if len(lines) == 0 {
+		return result
+	}
+
+	// Checked in order of specificity; ties keep the earlier format
+	candidates := []struct {
+		format models.LogFormat
+		match  func(string) bool
+	}{
+		{models.LogFormatJSONLines, isJSONObject},
+		{models.LogFormatSyslog5424, syslog5424Pattern.MatchString},
+		{models.LogFormatCombined, combinedPattern.MatchString},
+		{models.LogFormatSyslog3164, syslog3164Pattern.MatchString},
+		{models.LogFormatLogfmt, isLogfmt},
+	}
+
+	best, bestScore := models.LogFormatText, 0.0
+	for _, candidate := range candidates {
+		matched := 0
+		for _, line := range lines {
+			if candidate.match(line) {
+				matched++
+			}
+		}
+		if score := float64(matched) / float64(len(lines)); score > bestScore {
+			best, bestScore = candidate.format, score
+		}
+	}
+	for _, delimited := range []struct {
+		format models.LogFormat
+		sep    byte
+	}{
+		{models.LogFormatTSV, '\t'},
+		{models.LogFormatCSV, ','},
+	} {
+		if score := delimitedScore(lines, delimited.sep); score > bestScore {
+			best, bestScore = delimited.format, score
+		}
+	}
+
+	if bestScore >= minConfidence {
+		result.Format = best
+		result.Confidence = round(bestScore)
+	} else {
+		result.Confidence = round(1 - bestScore)
+	}
+	return result
+}
+
+// sample reads up to n non-empty lines, truncating long ones.
+func sample(r io.Reader, n int) ([]string, error) {
+	reader := bufio.NewReaderSize(r, readBufferSize)
+	var lines []string
+	var current []byte
+	truncated := false
+
+	for len(lines) < n {
+		chunk, err := reader.ReadSlice('\n')
+		if !truncated {
+			room := maxSampleLineLength - len(current)
+			if len(chunk) > room {
+				chunk, truncated = chunk[:room], true
+			}
+			current = append(current, chunk...)
+		}
+
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if line := strings.TrimRight(string(current), "\r\n"); strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+		current, truncated = current[:0], false
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return lines, nil
+}
+
+func isJSONObject(line string) bool {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "{") {
+		return false
+	}
+	var v map[string]json.RawMessage
+	return json.Unmarshal([]byte(line), &v) == nil
+}
+
+// isLogfmt reports whether a line consists of at least two key=value pairs
+// and nothing else.
+func isLogfmt(line string) bool {
+	rest := strings.TrimSpace(line)
+	pairs := 0
+	for rest != "" {
+		loc := logfmtPairPattern.FindStringIndex(rest)
+		if loc == nil {
+			return false
+		}
+		pairs++
+		rest = strings.TrimLeft(rest[loc[1]:], " \t")
+	}
+	return pairs >= 2
+}
+
+// delimitedScore returns the share of lines that have the most common
+// non-zero field count for the separator. Quoted fields are honoured.
+func delimitedScore(lines []string, sep byte) float64 {
+	counts := make(map[int]int)
+	for _, line := range lines {
+		if fields := countFields(line, sep); fields > 1 {
+			counts[fields]++
+		}
+	}
+
+	best := 0
+	for _, n := range counts {
+		if n > best {
+			best = n
+		}
+	}
+	return float64(best) / float64(len(lines))
+}
+
+func countFields(line string, sep byte) int {
+	fields, quoted := 1, false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '"':
+			quoted = !quoted
+		case sep:
+			if !quoted {
+				fields++
+			}
+		}
+	}
+	return fields
+}
+
+func round(f float64) float64 {
+	return float64(int(f*100+0.5)) / 100
+}
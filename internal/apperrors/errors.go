@@ -0,0 +1,128 @@
+// Package apperrors defines the typed errors shared by the repository, service
+// and handler layers. Each error carries a stable code and a client-safe
+// message; the underlying cause is kept for logging and never sent to clients.
+package apperrors
+
+import "errors"
+
+// Code is the machine-readable error code returned in API error envelopes.
+type Code string
+
+const (
+	CodeInvalidRequest Code = "INVALID_REQUEST"
+	CodeInvalidURL     Code = "INVALID_URL"
+	CodeInvalidFile    Code = "INVALID_FILE"
+	CodeFileTooLarge   Code = "FILE_TOO_LARGE"
+	CodeNotFound       Code = "NOT_FOUND"
+	CodeFileNotFound   Code = "FILE_NOT_FOUND"
+	CodeUnauthorized   Code = "UNAUTHORIZED"
+	CodeForbidden      Code = "FORBIDDEN"
+	CodeQuotaExceeded  Code = "QUOTA_EXCEEDED"
+	CodeInvalidState   Code = "INVALID_STATE"
+	CodeStorageError   Code = "STORAGE_ERROR"
+	CodeDatabaseError  Code = "DATABASE_ERROR"
+	CodeInternalError  Code = "INTERNAL_ERROR"
+)
+
+// Sentinel errors. Use errors.Is to test for them; errors created with New or
+// Wrap match the sentinel they were created from, and every sentinel matches
+// its parent (ErrFileNotFound is also ErrNotFound).
+var (
+	ErrInvalidRequest = newKind(nil, CodeInvalidRequest, "invalid request")
+	ErrInvalidURL     = newKind(ErrInvalidRequest, CodeInvalidURL, "failed to download file from URL")
+	ErrInvalidFile    = newKind(ErrInvalidRequest, CodeInvalidFile, "invalid file format")
+	ErrFileTooLarge   = newKind(nil, CodeFileTooLarge, "file exceeds the maximum allowed size")
+	ErrNotFound       = newKind(nil, CodeNotFound, "resource not found")
+	ErrFileNotFound   = newKind(ErrNotFound, CodeFileNotFound, "file not found")
+	ErrUnauthorized   = newKind(nil, CodeUnauthorized, "unauthorized")
+	ErrForbidden      = newKind(nil, CodeForbidden, "you do not have permission to access this resource")
+	ErrQuotaExceeded  = newKind(nil, CodeQuotaExceeded, "storage quota exceeded")
+	ErrInvalidState   = newKind(nil, CodeInvalidState, "resource is not in a valid state for this operation")
+	ErrStorage        = newKind(nil, CodeStorageError, "error occurred while accessing storage")
+	ErrDatabase       = newKind(nil, CodeDatabaseError, "error occurred while accessing database")
+	ErrInternal       = newKind(nil, CodeInternalError, "internal server error")
+)
+
+// Error is a domain error with a code, a client-safe message and optional
+// details.
+type Error struct {
+	Code    Code
+	Message string
+	Details map[string]any
+
+	kind  *Error
+	cause error
+}
+
+func newKind(parent *Error, code Code, message string) *Error {
+	return &Error{Code: code, Message: message, kind: parent}
+}
+
+// New creates an error of the given kind with a more specific message.
+func New(kind *Error, message string) *Error {
+	return &Error{Code: kind.Code, Message: message, kind: kind}
+}
+
+// Wrap creates an error of the given kind that records cause for logging. The
+// kind's default message is used when message is empty.
+func Wrap(kind *Error, cause error, message string) *Error {
+	if message == "" {
+		message = kind.Message
+	}
+	return &Error{Code: kind.Code, Message: message, kind: kind, cause: cause}
+}
+
+// Database wraps a database driver error.
+func Database(cause error) *Error {
+	return Wrap(ErrDatabase, cause, "")
+}
+
+// Storage wraps a storage backend error.
+func Storage(cause error) *Error {
+	return Wrap(ErrStorage, cause, "")
+}
+
+// WithDetails returns a copy of the error carrying extra details for the
+// client.
+func (e *Error) WithDetails(details map[string]any) *Error {
+	clone := *e
+	clone.Details = details
+	clone.kind = e
+	return &clone
+}
+
+func (e *Error) Error() string {
+	if e.cause != nil {
+		return e.Message + ": " + e.cause.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// Is reports whether target is this error or one of the kinds it derives
+// from.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	if !ok {
+		return false
+	}
+	for k := e; k != nil; k = k.kind {
+		if k == t {
+			return true
+		}
+	}
+	return false
+}
+
+// From returns the *Error in err's chain, or wraps err as an internal error
+// when it carries no domain error.
+func From(err error) *Error {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+	return Wrap(ErrInternal, err, "")
+}
@@ -0,0 +1,262 @@
+// Package archive walks the entries of zip and tar.gz bundles so they can be
+// stored as individual files. Every walk is bounded: the number of entries,
+// the total bytes decompressed and the expansion ratio are capped, and
+// entries with unsafe paths or of a type other than regular file are
+// skipped.
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// Kind identifies an archive format.
+type Kind string
+
+const (
+	KindZip   Kind = "zip"
+	KindTarGz Kind = "tar.gz"
+)
+
+// Detect returns the kind of archive whose content starts with head, or ""
+// when head is neither a zip nor a gzip stream.
+func Detect(head []byte) Kind {
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")), bytes.HasPrefix(head, []byte("PK\x05\x06")):
+		return KindZip
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		return KindTarGz
+	}
+	return ""
+}
+
+// Limits bound a walk. Zero values select the defaults.
+type Limits struct {
+	// MaxEntries caps the entries of an archive, directories included.
+	// Default 1000.
+	MaxEntries int
+
+	// MaxTotalSize caps the bytes decompressed from an archive. Default
+	// 100MB.
+	MaxTotalSize int64
+
+	// MaxRatio caps the bytes decompressed per byte of archive. Default 100.
+	MaxRatio int64
+}
+
+func (l Limits) withDefaults() Limits {
+	if l.MaxEntries <= 0 {
+		l.MaxEntries = 1000
+	}
+	if l.MaxTotalSize <= 0 {
+		l.MaxTotalSize = 100 << 20
+	}
+	if l.MaxRatio <= 0 {
+		l.MaxRatio = 100
+	}
+	return l
+}
+
+var (
+	// ErrTooManyEntries is returned when an archive has more entries than
+	// allowed.
+	ErrTooManyEntries = errors.New("archive has too many entries")
+
+	// ErrTooLarge is returned when an archive expands beyond the allowed
+	// total size or ratio.
+	ErrTooLarge = errors.New("archive expands beyond the allowed size")
+)
+
+// Entry is a regular file in an archive.
+type Entry struct {
+	// Path is the cleaned, slash-separated path of the entry.
+	Path string
+}
+
+// Skipped is an entry that was not passed to the walk function.
+type Skipped struct {
+	Path   string
+	Reason string
+}
+
+// Walk calls fn for each regular file in the archive read from r, which is
+// size bytes long, and returns the entries it skipped. fn must not keep r after
+// it returns; reading past the walk's limits fails with ErrTooLarge.
+func Walk(ctx context.Context, r io.ReaderAt, size int64, kind Kind, limits Limits, fn func(Entry, io.Reader) error) ([]Skipped, error) {
+	limits = limits.withDefaults()
+	budget := limits.MaxTotalSize
+	if ratio := size * limits.MaxRatio; size > 0 && ratio < budget {
+		budget = ratio
+	}
+	w := &walker{ctx: ctx, limits: limits, budget: budget, fn: fn}
+
+	var err error
+	switch kind {
+	case KindZip:
+		err = w.zip(r, size)
+	case KindTarGz:
+		err = w.tarGz(io.NewSectionReader(r, 0, size))
+	default:
+		return nil, fmt.Errorf("unsupported archive kind %q", kind)
+	}
+	if w.exceeded {
+		// fn may have wrapped or flattened the error
+		err = ErrTooLarge
+	}
+	return w.skipped, err
+}
+
+type walker struct {
+	ctx      context.Context
+	limits   Limits
+	budget   int64
+	exceeded bool
+	entries  int
+	skipped  []Skipped
+	fn       func(Entry, io.Reader) error
+}
+
+func (w *walker) zip(r io.ReaderAt, size int64) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return fmt.Errorf("invalid zip archive: %w", err)
+	}
+	if len(zr.File) > w.limits.MaxEntries {
+		return ErrTooManyEntries
+	}
+	for _, file := range zr.File {
+		if err := w.ctx.Err(); err != nil {
+			return err
+		}
+		mode := file.Mode()
+		if mode.IsDir() {
+			continue
+		}
+		name, ok := CleanPath(file.Name)
+		if !ok {
+			w.skip(file.Name, "unsafe path")
+			continue
+		}
+		if !mode.IsRegular() {
+			w.skip(name, "not a regular file")
+			continue
+		}
+		if file.UncompressedSize64 > uint64(w.budget) {
+			w.exceeded = true
+			return ErrTooLarge
+		}
+
+		rc, err := file.Open()
+		if err != nil {
+			w.skip(name, err.Error())
+			continue
+		}
+		err = w.fn(Entry{Path: name}, &budgetReader{r: rc, w: w})
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *walker) tarGz(r io.Reader) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("invalid gzip stream: %w", err)
+	}
+	defer gz.Close()
+
+	// Headers and skipped entries count against the budget too
+	tr := tar.NewReader(&budgetReader{r: gz, w: w})
+	for {
+		if err := w.ctx.Err(); err != nil {
+			return err
+		}
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			if errors.Is(err, ErrTooLarge) {
+				return err
+			}
+			return fmt.Errorf("invalid tar archive: %w", err)
+		}
+		if w.entries++; w.entries > w.limits.MaxEntries {
+			return ErrTooManyEntries
+		}
+		if header.Typeflag == tar.TypeDir {
+			continue
+		}
+		name, ok := CleanPath(header.Name)
+		if !ok {
+			w.skip(header.Name, "unsafe path")
+			continue
+		}
+		if header.Typeflag != tar.TypeReg {
+			w.skip(name, "not a regular file")
+			continue
+		}
+		if err := w.fn(Entry{Path: name}, tr); err != nil {
+			return err
+		}
+	}
+}
+
+func (w *walker) skip(name, reason string) {
+	w.skipped = append(w.skipped, Skipped{Path: name, Reason: reason})
+}
+
+// budgetReader fails with ErrTooLarge once the walk has decompressed more
+// than its budget.
+type budgetReader struct {
+	r io.Reader
+	w *walker
+}
+
+func (b *budgetReader) Read(p []byte) (int, error) {
+	if b.w.budget <= 0 {
+		// Only fail when there is more to read
+		var probe [1]byte
+		if n, err := b.r.Read(probe[:]); n == 0 {
+			return 0, err
+		}
+		b.w.exceeded = true
+		return 0, ErrTooLarge
+	}
+	if int64(len(p)) > b.w.budget {
+		p = p[:b.w.budget]
+	}
+	n, err := b.r.Read(p)
+	b.w.budget -= int64(n)
+	return n, err
+}
+
+// CleanPath converts an entry name to a relative, slash-separated path. It
+// reports false for names that are absolute, contain a drive letter, or
+// climb out of the archive with "..".
+func CleanPath(name string) (string, bool) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if name == "" || strings.HasPrefix(name, "/") || (len(name) >= 2 && name[1] == ':') {
+		return "", false
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return "", false
+		}
+	}
+	cleaned := path.Clean(name)
+	if cleaned == "." || strings.ContainsRune(cleaned, 0) {
+		return "", false
+	}
+	return cleaned, true
+}
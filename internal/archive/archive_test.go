@@ -0,0 +1,254 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// file is an archive entry for the fixtures below.
+type file struct {
+	name    string
+	content []byte
+	link    bool
+}
+
+func zipFixture(t *testing.T, files ...file) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range files {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Deflate})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(f.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func tarGzFixture(t *testing.T, files ...file) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, f := range files {
+		header := &tar.Header{Name: f.name, Mode: 0o644, Size: int64(len(f.content)), Typeflag: tar.TypeReg}
+		if f.link {
+			header = &tar.Header{Name: f.name, Linkname: "/etc/passwd", Typeflag: tar.TypeSymlink}
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(f.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// bomb is a megabyte of zeros, which deflates to about a kilobyte.
+var bomb = make([]byte, 1<<20)
+
+// walk walks an archive and returns the content of each entry by path.
+func walk(data []byte, kind Kind, limits Limits) (map[string]string, []Skipped, error) {
+	entries := map[string]string{}
+	skipped, err := Walk(context.Background(), bytes.NewReader(data), int64(len(data)), kind, limits, func(entry Entry, r io.Reader) error {
+		content, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		entries[entry.Path] = string(content)
+		return nil
+	})
+	return entries, skipped, err
+}
+
+func TestCleanPath(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+		ok   bool
+	}{
+		{"app.log", "app.log", true},
+		{"logs/app.log", "logs/app.log", true},
+		{"./logs//app.log", "logs/app.log", true},
+		{`logs\app.log`, "logs/app.log", true},
+		{"", "", false},
+		{".", "", false},
+		{"../app.log", "", false},
+		{"logs/../../app.log", "", false},
+		{"logs/../app.log", "", false},
+		{`..\app.log`, "", false},
+		{"/etc/passwd", "", false},
+		{`\Windows\win.ini`, "", false},
+		{`C:\Windows\win.ini`, "", false},
+		{"C:app.log", "", false},
+		{"app\x00.log", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := CleanPath(tt.name)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("CleanPath(%q) = %q, %v, want %q, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name string
+		head []byte
+		want Kind
+	}{
+		{"zip", zipFixture(t, file{name: "app.log", content: []byte("line\n")}), KindZip},
+		{"empty zip", zipFixture(t), KindZip},
+		{"tar.gz", tarGzFixture(t, file{name: "app.log", content: []byte("line\n")}), KindTarGz},
+		{"text", []byte("2024-03-20 INFO started\n"), ""},
+		{"empty", nil, ""},
+	}
+	for _, tt := range tests {
+		if got := Detect(tt.head); got != tt.want {
+			t.Errorf("Detect(%s) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWalk(t *testing.T) {
+	files := []file{
+		{name: "logs/app.log", content: []byte("started\n")},
+		{name: "../escape.log", content: []byte("outside\n")},
+		{name: "/etc/cron.log", content: []byte("absolute\n")},
+	}
+	tests := []struct {
+		name string
+		data []byte
+		kind Kind
+		more []Skipped
+	}{
+		{"zip", zipFixture(t, files...), KindZip, nil},
+		{
+			"tar.gz",
+			tarGzFixture(t, append(files, file{name: "logs/link", link: true})...),
+			KindTarGz,
+			[]Skipped{{Path: "logs/link", Reason: "not a regular file"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, skipped, err := walk(tt.data, tt.kind, Limits{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := map[string]string{"logs/app.log": "started\n"}; !reflect.DeepEqual(entries, want) {
+				t.Errorf("entries = %q, want %q", entries, want)
+			}
+			want := append([]Skipped{
+				{Path: "../escape.log", Reason: "unsafe path"},
+				{Path: "/etc/cron.log", Reason: "unsafe path"},
+			}, tt.more...)
+			if !reflect.DeepEqual(skipped, want) {
+				t.Errorf("skipped = %+v, want %+v", skipped, want)
+			}
+		})
+	}
+}
+
+func TestWalkLimits(t *testing.T) {
+	three := []file{
+		{name: "a.log", content: []byte("a\n")},
+		{name: "b.log", content: []byte("b\n")},
+		{name: "c.log", content: []byte("c\n")},
+	}
+	tests := []struct {
+		name   string
+		data   []byte
+		kind   Kind
+		limits Limits
+		err    error
+	}{
+		{"zip within the entry limit", zipFixture(t, three...), KindZip, Limits{MaxEntries: 3}, nil},
+		{"zip over the entry limit", zipFixture(t, three...), KindZip, Limits{MaxEntries: 2}, ErrTooManyEntries},
+		{"tar.gz over the entry limit", tarGzFixture(t, three...), KindTarGz, Limits{MaxEntries: 2}, ErrTooManyEntries},
+		{"zip bomb over the ratio", zipFixture(t, file{name: "zeros.log", content: bomb}), KindZip, Limits{}, ErrTooLarge},
+		{"tar.gz bomb over the ratio", tarGzFixture(t, file{name: "zeros.log", content: bomb}), KindTarGz, Limits{}, ErrTooLarge},
+		{
+			"zip over the total size", zipFixture(t, file{name: "zeros.log", content: bomb}), KindZip,
+			Limits{MaxTotalSize: 64 << 10, MaxRatio: 1 << 20}, ErrTooLarge,
+		},
+		{
+			"tar.gz over the total size", tarGzFixture(t, file{name: "zeros.log", content: bomb}), KindTarGz,
+			Limits{MaxTotalSize: 64 << 10, MaxRatio: 1 << 20}, ErrTooLarge,
+		},
+		{
+			"bomb within generous limits", tarGzFixture(t, file{name: "zeros.log", content: bomb}), KindTarGz,
+			Limits{MaxTotalSize: 2 << 20, MaxRatio: 1 << 20}, nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := walk(tt.data, tt.kind, tt.limits)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Walk = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+// TestWalkReportsExceededBudget checks that reading past the budget fails
+// with ErrTooLarge even when the walk function replaces the error.
+func TestWalkReportsExceededBudget(t *testing.T) {
+	data := tarGzFixture(t, file{name: "zeros.log", content: bomb})
+	_, err := Walk(context.Background(), bytes.NewReader(data), int64(len(data)), KindTarGz, Limits{}, func(_ Entry, r io.Reader) error {
+		if _, err := io.Copy(io.Discard, r); err != nil {
+			return errors.New("failed to store entry")
+		}
+		return nil
+	})
+	if !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Walk = %v, want %v", err, ErrTooLarge)
+	}
+}
+
+func TestBudgetReader(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		budget  int64
+		want    string
+		err     error
+	}{
+		{"within the budget", "hello", 10, "hello", nil},
+		{"exactly the budget", "hello", 5, "hello", nil},
+		{"over the budget", "hello world", 5, "hello", ErrTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &walker{budget: tt.budget}
+			got, err := io.ReadAll(&budgetReader{r: strings.NewReader(tt.content), w: w})
+			if string(got) != tt.want || !errors.Is(err, tt.err) {
+				t.Errorf("read %q, %v, want %q, %v", got, err, tt.want, tt.err)
+			}
+			if w.exceeded != (tt.err != nil) {
+				t.Errorf("exceeded = %v", w.exceeded)
+			}
+		})
+	}
+}
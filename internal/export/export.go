@@ -0,0 +1,344 @@
+// Package export writes normalized log records as NDJSON, CSV or Parquet.
+// Each format writes the same columns: the record's line, timestamp, level,
+// message and source, its structured fields as one JSON value, and any
+// single structured field selected as "fields.<name>".
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"user-service/internal/parser"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// Format is an export output format.
+type Format string
+
+const (
+	FormatNDJSON  Format = "ndjson"
+	FormatCSV     Format = "csv"
+	FormatParquet Format = "parquet"
+)
+
+// Formats lists the supported formats.
+var Formats = []Format{FormatNDJSON, FormatCSV, FormatParquet}
+
+// ContentType returns the MIME type of a format.
+func (f Format) ContentType() string {
+	switch f {
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	case FormatCSV:
+		return "text/csv"
+	case FormatParquet:
+		return "application/vnd.apache.parquet"
+	}
+	return "application/octet-stream"
+}
+
+// Extension returns the file name extension of a format, including the
+// leading dot.
+func (f Format) Extension() string {
+	return "." + string(f)
+}
+
+// Column names.
+const (
+	ColumnLine      = "line"
+	ColumnTimestamp = "timestamp"
+	ColumnLevel     = "level"
+	ColumnMessage   = "message"
+	ColumnSource    = "source"
+	ColumnFields    = "fields"
+
+	// fieldPrefix selects a single structured field, as in "fields.user".
+	fieldPrefix = "fields."
+)
+
+// DefaultColumns are exported when no columns are selected.
+var DefaultColumns = []string{ColumnLine, ColumnTimestamp, ColumnLevel, ColumnMessage, ColumnSource, ColumnFields}
+
+const maxColumns = 100
+
+// ParseColumns parses a comma-separated column selection. An empty
+// selection returns DefaultColumns.
+func ParseColumns(spec string) ([]string, error) {
+	if strings.TrimSpace(spec) == "" {
+		return DefaultColumns, nil
+	}
+	var columns []string
+	seen := make(map[string]bool)
+	for _, column := range strings.Split(spec, ",") {
+		column = strings.TrimSpace(column)
+		if !validColumn(column) {
+			return nil, fmt.Errorf("unknown field %q", column)
+		}
+		if seen[column] {
+			continue
+		}
+		seen[column] = true
+		columns = append(columns, column)
+	}
+	if len(columns) > maxColumns {
+		return nil, fmt.Errorf("at most %d fields can be selected", maxColumns)
+	}
+	return columns, nil
+}
+
+func validColumn(column string) bool {
+	for _, c := range DefaultColumns {
+		if column == c {
+			return true
+		}
+	}
+	return strings.HasPrefix(column, fieldPrefix) && len(column) > len(fieldPrefix)
+}
+
+// Writer writes records in one format. Close must be called to complete the
+// output; it does not close the underlying writer.
+type Writer interface {
+	Write(record parser.Record) error
+	Close() error
+}
+
+// NewWriter returns a Writer for the format that writes the given columns
+// to w.
+func NewWriter(w io.Writer, format Format, columns []string) (Writer, error) {
+	switch format {
+	case FormatNDJSON:
+		return &ndjsonWriter{w: w, columns: columns}, nil
+	case FormatCSV:
+		return &csvWriter{w: csv.NewWriter(w), columns: columns}, nil
+	case FormatParquet:
+		return newParquetWriter(w, columns), nil
+	}
+	return nil, fmt.Errorf("unsupported export format %q", format)
+}
+
+// value returns a column's value for a record, or nil when it has none.
+func value(record parser.Record, column string) any {
+	switch column {
+	case ColumnLine:
+		return record.Line
+	case ColumnTimestamp:
+		if record.Timestamp == nil {
+			return nil
+		}
+		return *record.Timestamp
+	case ColumnLevel:
+		return emptyToNil(record.Level)
+	case ColumnMessage:
+		return record.Message
+	case ColumnSource:
+		return emptyToNil(record.Source)
+	case ColumnFields:
+		if len(record.Fields) == 0 {
+			return nil
+		}
+		return record.Fields
+	}
+	if v, ok := record.Fields[strings.TrimPrefix(column, fieldPrefix)]; ok {
+		return v
+	}
+	return nil
+}
+
+func emptyToNil(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// text formats a value for CSV and Parquet string columns. Strings are
+// written as they are and everything else as JSON.
+func text(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+type ndjsonWriter struct {
+	w       io.Writer
+	columns []string
+	buf     bytes.Buffer
+}
+
+// Write writes the selected columns in order, leaving out empty ones.
+func (n *ndjsonWriter) Write(record parser.Record) error {
+	n.buf.Reset()
+	n.buf.WriteByte('{')
+	first := true
+	for _, column := range n.columns {
+		v := value(record, column)
+		if v == nil {
+			continue
+		}
+		if t, ok := v.(time.Time); ok {
+			v = t.UTC()
+		}
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			encoded, _ = json.Marshal(fmt.Sprint(v))
+		}
+		key, _ := json.Marshal(column)
+		if !first {
+			n.buf.WriteByte(',')
+		}
+		first = false
+		n.buf.Write(key)
+		n.buf.WriteByte(':')
+		n.buf.Write(encoded)
+	}
+	n.buf.WriteString("}\n")
+	_, err := n.w.Write(n.buf.Bytes())
+	return err
+}
+
+func (n *ndjsonWriter) Close() error {
+	return nil
+}
+
+type csvWriter struct {
+	w       *csv.Writer
+	columns []string
+	header  bool
+	row     []string
+}
+
+func (c *csvWriter) Write(record parser.Record) error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	c.row = c.row[:0]
+	for _, column := range c.columns {
+		v := value(record, column)
+		if v == nil {
+			c.row = append(c.row, "")
+			continue
+		}
+		c.row = append(c.row, text(v))
+	}
+	return c.w.Write(c.row)
+}
+
+func (c *csvWriter) writeHeader() error {
+	if c.header {
+		return nil
+	}
+	c.header = true
+	return c.w.Write(c.columns)
+}
+
+// Close writes the header of an empty export and flushes.
+func (c *csvWriter) Close() error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+const (
+	parquetBatchRows    = 1000
+	parquetRowGroupRows = 100_000
+)
+
+// parquetWriter writes line as a required int64, timestamp as an optional
+// nanosecond timestamp and every other column as an optional string.
+type parquetWriter struct {
+	w       *parquet.Writer
+	columns []string
+
+	// index maps each selected column to its position in the schema, which
+	// orders columns by name.
+	index []int
+	rows  []parquet.Row
+}
+
+func newParquetWriter(w io.Writer, columns []string) *parquetWriter {
+	group := parquet.Group{}
+	for _, column := range columns {
+		switch column {
+		case ColumnLine:
+			group[column] = parquet.Int(64)
+		case ColumnTimestamp:
+			group[column] = parquet.Optional(parquet.Timestamp(parquet.Nanosecond))
+		default:
+			group[column] = parquet.Optional(parquet.String())
+		}
+	}
+	schema := parquet.NewSchema("record", group)
+
+	positions := make(map[string]int)
+	for i, path := range schema.Columns() {
+		positions[path[0]] = i
+	}
+	index := make([]int, len(columns))
+	for i, column := range columns {
+		index[i] = positions[column]
+	}
+
+	return &parquetWriter{
+		w:       parquet.NewWriter(w, schema, parquet.MaxRowsPerRowGroup(parquetRowGroupRows)),
+		columns: columns,
+		index:   index,
+	}
+}
+
+func (p *parquetWriter) Write(record parser.Record) error {
+	row := make(parquet.Row, len(p.columns))
+	for i, column := range p.columns {
+		col := p.index[i]
+		v := value(record, column)
+		switch {
+		case column == ColumnLine:
+			row[col] = parquet.Int64Value(record.Line).Level(0, 0, col)
+		case v == nil:
+			row[col] = parquet.NullValue().Level(0, 0, col)
+		case column == ColumnTimestamp:
+			row[col] = parquet.Int64Value(v.(time.Time).UnixNano()).Level(0, 1, col)
+		default:
+			row[col] = parquet.ByteArrayValue([]byte(text(v))).Level(0, 1, col)
+		}
+	}
+	p.rows = append(p.rows, row)
+	if len(p.rows) >= parquetBatchRows {
+		return p.flush()
+	}
+	return nil
+}
+
+func (p *parquetWriter) flush() error {
+	if len(p.rows) == 0 {
+		return nil
+	}
+	_, err := p.w.WriteRows(p.rows)
+	p.rows = p.rows[:0]
+	return err
+}
+
+// Close writes the buffered rows and the file footer.
+func (p *parquetWriter) Close() error {
+	if err := p.flush(); err != nil {
+		return err
+	}
+	return p.w.Close()
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"user-service/internal/apperrors"
+	"user-service/internal/models"
+	"user-service/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AuditHandler struct {
+	auditService *service.AuditService
+}
+
+func NewAuditHandler(auditService *service.AuditService) *AuditHandler {
+	return &AuditHandler{
+		auditService: auditService,
+	}
+}
+
+// ListEntries returns the most recent audit entries matching the filters.
+func (h *AuditHandler) ListEntries(c *gin.Context) {
+	req, err := bindAuditFilter(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	entries, err := h.auditService.List(c.Request.Context(), req)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	respond(c, http.StatusOK, entries)
+}
+
+// Export streams the audit entries matching the filters as NDJSON.
+func (h *AuditHandler) Export(c *gin.Context) {
+	req, err := bindAuditFilter(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	err = h.auditService.Export(c.Request.Context(), req, func() io.Writer {
+		c.Header("Content-Disposition", "attachment; filename=audit.ndjson")
+		c.Header("Content-Type", "application/x-ndjson")
+		c.Status(http.StatusOK)
+		return c.Writer
+	})
+	if err != nil {
+		c.Error(err)
+	}
+}
+
+// Verify checks the audit log's hash chain.
+func (h *AuditHandler) Verify(c *gin.Context) {
+	result, err := h.auditService.Verify(c.Request.Context())
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	respond(c, http.StatusOK, result)
+}
+
+func bindAuditFilter(c *gin.Context) (models.AuditListRequest, error) {
+	var req models.AuditListRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		return req, apperrors.Wrap(apperrors.ErrInvalidRequest, err, "invalid audit filters")
+	}
+	return req, nil
+}
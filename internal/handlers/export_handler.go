@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"user-service/internal/apperrors"
+	"user-service/internal/export"
+	"user-service/internal/models"
+	"user-service/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ExportHandler struct {
+	exportService *service.ExportService
+}
+
+func NewExportHandler(exportService *service.ExportService) *ExportHandler {
+	return &ExportHandler{
+		exportService: exportService,
+	}
+}
+
+// Export streams a file's records in the requested format, or responds
+// with 202 Accepted and the job that will produce them.
+func (h *ExportHandler) Export(c *gin.Context) {
+	userID, err := currentUserID(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	id, err := fileIDParam(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	var req models.ExportRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.Error(apperrors.Wrap(apperrors.ErrInvalidRequest, err, "invalid export parameters"))
+		return
+	}
+
+	job, err := h.exportService.Export(c.Request.Context(), userID, id, req, func(file *models.File, format export.Format) io.Writer {
+		name := strings.TrimSuffix(file.Name, path.Ext(file.Name)) + format.Extension()
+		c.Header("Content-Disposition", "attachment; filename="+name)
+		c.Header("Content-Type", format.ContentType())
+		c.Status(http.StatusOK)
+		return c.Writer
+	})
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if job != nil {
+		respond(c, http.StatusAccepted, job)
+	}
+}
@@ -1,9 +1,16 @@
 package handlers
 
 import (
-	"log"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
+	"strings"
+	"user-service/internal/apperrors"
 	"user-service/internal/models"
+	"user-service/internal/preview"
+	"user-service/internal/search"
 	"user-service/internal/service"
 
 	"github.com/gin-gonic/gin"
@@ -22,174 +29,445 @@ func NewFileHandler(fileService *service.FileService) *FileHandler {
 
 func (h *FileHandler) UploadFile(c *gin.Context) {
 	// Get user ID from context (set by auth middleware)
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+	userID, err := currentUserID(c)
+	if err != nil {
+		c.Error(err)
 		return
 	}
 
 	file, err := c.FormFile("file")
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to get file from request"})
+		c.Error(apperrors.New(apperrors.ErrInvalidRequest, "failed to get file from request"))
 		return
 	}
 
 	// Open the uploaded file
 	src, err := file.Open()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to open file"})
+		c.Error(apperrors.Wrap(apperrors.ErrInternal, err, "failed to open file"))
 		return
 	}
 	defer src.Close()
 
 	// Upload file
-	fileRecord, err := h.fileService.UploadFile(c.Request.Context(), userID.(uint), src, file.Filename, file.Header.Get("Content-Type"))
+	opts := service.UploadOptions{
+		Redaction: models.RedactionMode(c.PostForm("redaction")),
+		Extract:   c.PostForm("extract") == "true",
+	}
+	if tags := c.PostForm("tags"); tags != "" {
+		opts.Tags = strings.Split(tags, ",")
+	}
+	fileRecord, err := h.fileService.UploadFile(c.Request.Context(), userID, src, file.Filename, opts)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
+	c.Set("file_id", fileRecord.ID.Hex())
 
-	c.JSON(http.StatusCreated, fileRecord)
+	respond(c, http.StatusCreated, fileRecord)
 }
 
 func (h *FileHandler) UploadFileFromURL(c *gin.Context) {
-	log.Printf("[UploadFileFromURL] Starting request processing")
+	slog.DebugContext(c.Request.Context(), "Starting request processing", "op", "FileHandler.UploadFileFromURL")
 
 	// Get user ID from context
-	userID, exists := c.Get("user_id")
-	if !exists {
-		log.Printf("[UploadFileFromURL] User ID not found in context")
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+	userID, err := currentUserID(c)
+	if err != nil {
+		slog.DebugContext(c.Request.Context(), "User ID not found in context", "op", "FileHandler.UploadFileFromURL")
+		c.Error(err)
 		return
 	}
-	log.Printf("[UploadFileFromURL] User ID found: %v", userID)
+	slog.DebugContext(c.Request.Context(), "User ID found", "op", "FileHandler.UploadFileFromURL", "user_id", userID)
 
 	var req models.FileUploadRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		log.Printf("[UploadFileFromURL] Failed to bind JSON request: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		slog.DebugContext(c.Request.Context(), "Failed to bind JSON request", "op", "FileHandler.UploadFileFromURL", "error", err)
+		c.Error(apperrors.New(apperrors.ErrInvalidRequest, "invalid request body"))
 		return
 	}
-	log.Printf("[UploadFileFromURL] Request body parsed successfully - URL: %s, Name: %s", req.URL, req.Name)
+	slog.DebugContext(c.Request.Context(), "Request body parsed successfully", "op", "FileHandler.UploadFileFromURL", "url", req.URL, "name", req.Name)
 
-	fileRecord, err := h.fileService.UploadFileFromURL(c.Request.Context(), userID.(uint), req.URL, req.Name)
+	fileRecord, err := h.fileService.UploadFileFromURL(c.Request.Context(), userID, req.URL, req.Name, service.UploadOptions{Redaction: req.Redaction, Extract: req.Extract, Tags: req.Tags})
 	if err != nil {
-		log.Printf("[UploadFileFromURL] Service error: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		slog.DebugContext(c.Request.Context(), "Service error", "op", "FileHandler.UploadFileFromURL", "error", err)
+		c.Error(err)
 		return
 	}
-	log.Printf("[UploadFileFromURL] File uploaded successfully - ID: %d, Name: %s", fileRecord.ID, fileRecord.Name)
+	slog.InfoContext(c.Request.Context(), "File uploaded successfully", "op", "FileHandler.UploadFileFromURL", "file_id", fileRecord.ID.Hex(), "name", fileRecord.Name)
+	c.Set("file_id", fileRecord.ID.Hex())
 
-	c.JSON(http.StatusCreated, fileRecord)
+	respond(c, http.StatusCreated, fileRecord)
 }
 
 func (h *FileHandler) ListFiles(c *gin.Context) {
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+	userID, err := currentUserID(c)
+	if err != nil {
+		c.Error(err)
 		return
 	}
 
-	files, err := h.fileService.ListUserFiles(c.Request.Context(), userID.(uint))
+	filter := models.FileFilter{
+		Format: models.LogFormat(c.Query("format")),
+		Tag:    c.Query("tag"),
+	}
+	if parent := c.Query("parent_id"); parent != "" {
+		parentID, err := primitive.ObjectIDFromHex(parent)
+		if err != nil {
+			c.Error(apperrors.New(apperrors.ErrInvalidRequest, "invalid parent_id"))
+			return
+		}
+		filter.ParentID = &parentID
+	}
+
+	files, err := h.fileService.ListUserFiles(c.Request.Context(), userID, filter)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
+	if files == nil {
+		files = []models.File{}
+	}
 
-	c.JSON(http.StatusOK, files)
+	respond(c, http.StatusOK, gin.H{"files": files})
 }
 
 func (h *FileHandler) DeleteFile(c *gin.Context) {
-	log.Printf("[DeleteFile] Starting file deletion")
+	slog.DebugContext(c.Request.Context(), "Starting file deletion", "op", "FileHandler.DeleteFile")
 
-	userID, exists := c.Get("user_id")
-	if !exists {
-		log.Printf("[DeleteFile] User ID not found in context")
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+	userID, err := currentUserID(c)
+	if err != nil {
+		slog.DebugContext(c.Request.Context(), "User ID not found in context", "op", "FileHandler.DeleteFile")
+		c.Error(err)
 		return
 	}
-	log.Printf("[DeleteFile] User ID found: %v", userID)
+	slog.DebugContext(c.Request.Context(), "User ID found", "op", "FileHandler.DeleteFile", "user_id", userID)
 
-	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	id, err := fileIDParam(c)
 	if err != nil {
-		log.Printf("[DeleteFile] Invalid file ID: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file ID"})
+		slog.DebugContext(c.Request.Context(), "Invalid file ID", "op", "FileHandler.DeleteFile", "error", err)
+		c.Error(err)
 		return
 	}
 
-	if err := h.fileService.DeleteFile(c.Request.Context(), id); err != nil {
-		log.Printf("[DeleteFile] Failed to delete file: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := h.fileService.DeleteFile(c.Request.Context(), userID, id); err != nil {
+		slog.DebugContext(c.Request.Context(), "Failed to delete file", "op", "FileHandler.DeleteFile", "error", err)
+		c.Error(err)
 		return
 	}
 
-	log.Printf("[DeleteFile] Successfully deleted file")
+	slog.InfoContext(c.Request.Context(), "Successfully deleted file", "op", "FileHandler.DeleteFile")
 	c.Status(http.StatusNoContent)
 }
 
 func (h *FileHandler) HideFile(c *gin.Context) {
-	log.Printf("[HideFile] Starting file hide operation")
+	slog.DebugContext(c.Request.Context(), "Starting file hide operation", "op", "FileHandler.HideFile")
 
-	userID, exists := c.Get("user_id")
-	if !exists {
-		log.Printf("[HideFile] User ID not found in context")
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+	userID, err := currentUserID(c)
+	if err != nil {
+		slog.DebugContext(c.Request.Context(), "User ID not found in context", "op", "FileHandler.HideFile")
+		c.Error(err)
 		return
 	}
-	log.Printf("[HideFile] User ID found: %v", userID)
+	slog.DebugContext(c.Request.Context(), "User ID found", "op", "FileHandler.HideFile", "user_id", userID)
 
-	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	id, err := fileIDParam(c)
 	if err != nil {
-		log.Printf("[HideFile] Invalid file ID: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file ID"})
+		slog.DebugContext(c.Request.Context(), "Invalid file ID", "op", "FileHandler.HideFile", "error", err)
+		c.Error(err)
 		return
 	}
 
-	if err := h.fileService.HideFile(c.Request.Context(), id); err != nil {
-		log.Printf("[HideFile] Failed to hide file: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := h.fileService.HideFile(c.Request.Context(), userID, id); err != nil {
+		slog.DebugContext(c.Request.Context(), "Failed to hide file", "op", "FileHandler.HideFile", "error", err)
+		c.Error(err)
 		return
 	}
 
-	log.Printf("[HideFile] Successfully hid file")
+	slog.InfoContext(c.Request.Context(), "Successfully hid file", "op", "FileHandler.HideFile")
 	c.Status(http.StatusNoContent)
 }
 
 func (h *FileHandler) DownloadFile(c *gin.Context) {
-	log.Printf("[DownloadFile] Starting file download")
-
-	userID, exists := c.Get("user_id")
-	if !exists {
-		log.Printf("[DownloadFile] User ID not found in context")
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
-		return
-	}
-	log.Printf("[DownloadFile] User ID found: %v", userID)
+	slog.DebugContext(c.Request.Context(), "Starting file download", "op", "FileHandler.DownloadFile")
 
-	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	userID, err := currentUserID(c)
 	if err != nil {
-		log.Printf("[DownloadFile] Invalid file ID: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file ID"})
+		slog.DebugContext(c.Request.Context(), "User ID not found in context", "op", "FileHandler.DownloadFile")
+		c.Error(err)
 		return
 	}
+	slog.DebugContext(c.Request.Context(), "User ID found", "op", "FileHandler.DownloadFile", "user_id", userID)
 
-	file, err := h.fileService.GetFile(c.Request.Context(), id)
+	id, err := fileIDParam(c)
 	if err != nil {
-		log.Printf("[DownloadFile] Failed to fetch file: %v", err)
-		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		slog.DebugContext(c.Request.Context(), "Invalid file ID", "op", "FileHandler.DownloadFile", "error", err)
+		c.Error(err)
 		return
 	}
 
-	reader, err := h.fileService.DownloadFile(c.Request.Context(), id)
+	file, reader, err := h.fileService.DownloadFile(c.Request.Context(), userID, id)
 	if err != nil {
-		log.Printf("[DownloadFile] Failed to download file: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		slog.DebugContext(c.Request.Context(), "Failed to download file", "op", "FileHandler.DownloadFile", "error", err)
+		c.Error(err)
 		return
 	}
 	defer reader.Close()
 
-	log.Printf("[DownloadFile] Successfully downloaded file")
+	slog.InfoContext(c.Request.Context(), "Successfully downloaded file", "op", "FileHandler.DownloadFile")
 	c.Header("Content-Disposition", "attachment; filename="+file.Name)
 	c.Header("Content-Type", file.MimeType)
 	c.DataFromReader(http.StatusOK, -1, file.MimeType, reader, nil)
 }
+
+func (h *FileHandler) PreviewFile(c *gin.Context) {
+	userID, err := currentUserID(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	id, err := fileIDParam(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	var req models.PreviewRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.Error(apperrors.Wrap(apperrors.ErrInvalidRequest, err, "head, tail, from_line and to_line must be integers"))
+		return
+	}
+
+	file, lines, err := h.fileService.PreviewFile(c.Request.Context(), userID, id, req)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if lines == nil {
+		lines = []preview.Line{}
+	}
+
+	respond(c, http.StatusOK, gin.H{
+		"file_id": file.ID,
+		"lines":   lines,
+	})
+}
+
+// SearchFile streams the lines of a file that match a query as NDJSON: one
+// object per match or context line, then a summary. Errors found before the
+// first line is written use the usual error envelope; later ones end the
+// stream with an error object.
+func (h *FileHandler) SearchFile(c *gin.Context) {
+	userID, err := currentUserID(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	id, err := fileIDParam(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	var req models.SearchRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.Error(apperrors.Wrap(apperrors.ErrInvalidRequest, err, "invalid search parameters"))
+		return
+	}
+
+	encoder := json.NewEncoder(c.Writer)
+	started := false
+	write := func(v any) error {
+		if !started {
+			c.Header("Content-Type", "application/x-ndjson")
+			c.Status(http.StatusOK)
+			started = true
+		}
+		if err := encoder.Encode(v); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	}
+
+	summary, err := h.fileService.SearchFile(c.Request.Context(), userID, id, req, func(result search.Result) error {
+		return write(result)
+	})
+	if err != nil {
+		c.Error(err)
+		if started {
+			appErr := apperrors.From(err)
+			write(gin.H{"type": "error", "error": gin.H{"code": appErr.Code, "message": appErr.Message}})
+		}
+		return
+	}
+	write(summary)
+}
+
+func (h *FileHandler) GetAnalysis(c *gin.Context) {
+	userID, err := currentUserID(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	id, err := fileIDParam(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	file, err := h.fileService.GetFile(c.Request.Context(), userID, id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	respond(c, http.StatusOK, gin.H{
+		"file_id":     file.ID,
+		"file_status": file.Status,
+		"analysis":    file.Analysis,
+	})
+}
+
+func (h *FileHandler) GetPatterns(c *gin.Context) {
+	userID, err := currentUserID(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	id, err := fileIDParam(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	file, patterns, err := h.fileService.GetPatterns(c.Request.Context(), userID, id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	respond(c, http.StatusOK, gin.H{
+		"file_id":     file.ID,
+		"file_status": file.Status,
+		"patterns":    patterns,
+	})
+}
+
+func (h *FileHandler) GetTimeline(c *gin.Context) {
+	userID, err := currentUserID(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	id, err := fileIDParam(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	timeline, err := h.fileService.GetTimeline(c.Request.Context(), userID, id, c.DefaultQuery("bucket", "5m"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	respond(c, http.StatusOK, gin.H{
+		"file_id":  id,
+		"timeline": timeline,
+	})
+}
+
+// AppendFile appends the request body to a file and returns the updated
+// file.
+func (h *FileHandler) AppendFile(c *gin.Context) {
+	userID, err := currentUserID(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	id, err := fileIDParam(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	file, err := h.fileService.AppendFile(c.Request.Context(), userID, id, c.Request.Body)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	respond(c, http.StatusOK, file)
+}
+
+// TailFile streams a file's last lines and then the lines appended to it as
+// Server-Sent Events.
+func (h *FileHandler) TailFile(c *gin.Context) {
+	userID, err := currentUserID(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	id, err := fileIDParam(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	var req models.TailRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.Error(apperrors.Wrap(apperrors.ErrInvalidRequest, err, "invalid tail parameters"))
+		return
+	}
+
+	var stream *sseStream
+	err = h.fileService.TailFile(c.Request.Context(), userID, id, req, func() service.TailStream {
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		// Keep reverse proxies from buffering events
+		c.Header("X-Accel-Buffering", "no")
+		c.Status(http.StatusOK)
+		stream = &sseStream{w: c.Writer}
+		return stream
+	})
+	if err != nil {
+		if stream != nil {
+			appErr := apperrors.From(err)
+			_ = stream.Send("error", gin.H{"code": appErr.Code, "message": appErr.Message})
+		}
+		c.Error(err)
+	}
+}
+
+// sseStream writes Server-Sent Events, flushing each one to the client.
+type sseStream struct {
+	w gin.ResponseWriter
+}
+
+func (s *sseStream) Send(event string, data any) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, encoded); err != nil {
+		return err
+	}
+	s.w.Flush()
+	return nil
+}
+
+func (s *sseStream) Heartbeat() error {
+	if _, err := io.WriteString(s.w, ": heartbeat\n\n"); err != nil {
+		return err
+	}
+	s.w.Flush()
+	return nil
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net/http"
+	"user-service/internal/apperrors"
+	"user-service/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type JobHandler struct {
+	jobService *service.JobService
+}
+
+func NewJobHandler(jobService *service.JobService) *JobHandler {
+	return &JobHandler{
+		jobService: jobService,
+	}
+}
+
+func (h *JobHandler) GetJob(c *gin.Context) {
+	userID, err := currentUserID(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.Error(apperrors.New(apperrors.ErrInvalidRequest, "invalid job ID"))
+		return
+	}
+
+	job, err := h.jobService.Get(c.Request.Context(), userID, id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	respond(c, http.StatusOK, job)
+}
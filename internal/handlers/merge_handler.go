@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"user-service/internal/apperrors"
+	"user-service/internal/merge"
+	"user-service/internal/models"
+	"user-service/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MergeHandler struct {
+	mergeService *service.MergeService
+}
+
+func NewMergeHandler(mergeService *service.MergeService) *MergeHandler {
+	return &MergeHandler{
+		mergeService: mergeService,
+	}
+}
+
+// Merge streams the merged records of several files, or responds with 202
+// Accepted and the job that will store them as a new file.
+func (h *MergeHandler) Merge(c *gin.Context) {
+	userID, err := currentUserID(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	var req models.MergeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperrors.Wrap(apperrors.ErrInvalidRequest, err, "invalid request body"))
+		return
+	}
+
+	job, err := h.mergeService.Merge(c.Request.Context(), userID, req, func(format merge.Format) io.Writer {
+		c.Header("Content-Disposition", "attachment; filename=merged"+format.Extension())
+		c.Header("Content-Type", format.ContentType())
+		c.Status(http.StatusOK)
+		return c.Writer
+	})
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if job != nil {
+		respond(c, http.StatusAccepted, job)
+	}
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"net/http"
+	"user-service/internal/apperrors"
+	"user-service/internal/models"
+	"user-service/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type QueryHandler struct {
+	queryService *service.QueryService
+}
+
+func NewQueryHandler(queryService *service.QueryService) *QueryHandler {
+	return &QueryHandler{
+		queryService: queryService,
+	}
+}
+
+func (h *QueryHandler) CreateQuery(c *gin.Context) {
+	userID, err := currentUserID(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	var req models.SavedQueryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperrors.Wrap(apperrors.ErrInvalidRequest, err, "invalid request body"))
+		return
+	}
+
+	query, err := h.queryService.Create(c.Request.Context(), userID, req)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	respond(c, http.StatusCreated, query)
+}
+
+func (h *QueryHandler) ListQueries(c *gin.Context) {
+	userID, err := currentUserID(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	queries, err := h.queryService.List(c.Request.Context(), userID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	respond(c, http.StatusOK, queries)
+}
+
+func (h *QueryHandler) GetQuery(c *gin.Context) {
+	userID, err := currentUserID(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	id, err := queryIDParam(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	query, err := h.queryService.Get(c.Request.Context(), userID, id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	respond(c, http.StatusOK, query)
+}
+
+func (h *QueryHandler) UpdateQuery(c *gin.Context) {
+	userID, err := currentUserID(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	id, err := queryIDParam(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	var req models.SavedQueryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperrors.Wrap(apperrors.ErrInvalidRequest, err, "invalid request body"))
+		return
+	}
+
+	query, err := h.queryService.Update(c.Request.Context(), userID, id, req)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	respond(c, http.StatusOK, query)
+}
+
+func (h *QueryHandler) DeleteQuery(c *gin.Context) {
+	userID, err := currentUserID(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	id, err := queryIDParam(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err := h.queryService.Delete(c.Request.Context(), userID, id); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *QueryHandler) ListAlerts(c *gin.Context) {
+	userID, err := currentUserID(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	var req models.AlertListRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.Error(apperrors.Wrap(apperrors.ErrInvalidRequest, err, "limit must be an integer"))
+		return
+	}
+
+	alerts, err := h.queryService.ListAlerts(c.Request.Context(), userID, req)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	respond(c, http.StatusOK, alerts)
+}
+
+func queryIDParam(c *gin.Context) (primitive.ObjectID, error) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return primitive.NilObjectID, apperrors.New(apperrors.ErrInvalidRequest, "invalid query ID")
+	}
+	return id, nil
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"user-service/internal/apperrors"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SuccessResponse is the documented success envelope.
+type SuccessResponse struct {
+	Status string `json:"status"`
+	Data   any    `json:"data"`
+}
+
+// respond writes data wrapped in the success envelope. Errors are not written
+// here; handlers attach them with c.Error and middleware.ErrorHandler renders
+// them.
+func respond(c *gin.Context, status int, data any) {
+	c.JSON(status, SuccessResponse{Status: "success", Data: data})
+}
+
+// currentUserID returns the user ID set by the authentication middleware.
+func currentUserID(c *gin.Context) (uint, error) {
+	value, exists := c.Get("user_id")
+	if !exists {
+		return 0, apperrors.ErrUnauthorized
+	}
+	userID, ok := value.(uint)
+	if !ok {
+		return 0, apperrors.ErrUnauthorized
+	}
+	return userID, nil
+}
+
+// fileIDParam parses the :id path parameter as a file ID.
+func fileIDParam(c *gin.Context) (primitive.ObjectID, error) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return primitive.NilObjectID, apperrors.New(apperrors.ErrInvalidRequest, "invalid file ID")
+	}
+	return id, nil
+}
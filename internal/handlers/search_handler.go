@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"net/http"
+	"user-service/internal/apperrors"
+	"user-service/internal/models"
+	"user-service/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SearchHandler struct {
+	searchService *service.SearchService
+}
+
+func NewSearchHandler(searchService *service.SearchService) *SearchHandler {
+	return &SearchHandler{
+		searchService: searchService,
+	}
+}
+
+func (h *SearchHandler) Search(c *gin.Context) {
+	userID, err := currentUserID(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	var req models.LibrarySearchRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.Error(apperrors.Wrap(apperrors.ErrInvalidRequest, err, "from and to must be RFC 3339 timestamps and limit an integer"))
+		return
+	}
+
+	results, err := h.searchService.Search(c.Request.Context(), userID, req)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if results == nil {
+		results = []models.LibrarySearchResult{}
+	}
+
+	respond(c, http.StatusOK, gin.H{"results": results})
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"user-service/internal/apperrors"
+	"user-service/internal/models"
+	"user-service/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type UsageHandler struct {
+	quotaService *service.QuotaService
+}
+
+func NewUsageHandler(quotaService *service.QuotaService) *UsageHandler {
+	return &UsageHandler{
+		quotaService: quotaService,
+	}
+}
+
+func (h *UsageHandler) GetUsage(c *gin.Context) {
+	userID, err := currentUserID(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	usage, err := h.quotaService.Usage(c.Request.Context(), userID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	respond(c, http.StatusOK, usage)
+}
+
+// SetLimits sets the quota overrides of the user in the :user_id path
+// parameter.
+func (h *UsageHandler) SetLimits(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("user_id"), 10, 0)
+	if err != nil || userID == 0 {
+		c.Error(apperrors.New(apperrors.ErrInvalidRequest, "invalid user ID"))
+		return
+	}
+
+	var req models.QuotaLimitsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperrors.Wrap(apperrors.ErrInvalidRequest, err, "invalid request body"))
+		return
+	}
+
+	usage, err := h.quotaService.SetLimits(c.Request.Context(), uint(userID), req)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	respond(c, http.StatusOK, usage)
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"net/http"
+	"user-service/internal/apperrors"
+	"user-service/internal/models"
+	"user-service/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type WebhookHandler struct {
+	webhookService *service.WebhookService
+}
+
+func NewWebhookHandler(webhookService *service.WebhookService) *WebhookHandler {
+	return &WebhookHandler{
+		webhookService: webhookService,
+	}
+}
+
+func (h *WebhookHandler) CreateWebhook(c *gin.Context) {
+	userID, err := currentUserID(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	var req models.WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperrors.Wrap(apperrors.ErrInvalidRequest, err, "invalid request body"))
+		return
+	}
+
+	webhook, err := h.webhookService.Create(c.Request.Context(), userID, req)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	respond(c, http.StatusCreated, webhook)
+}
+
+func (h *WebhookHandler) ListWebhooks(c *gin.Context) {
+	userID, err := currentUserID(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	webhooks, err := h.webhookService.List(c.Request.Context(), userID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	respond(c, http.StatusOK, webhooks)
+}
+
+func (h *WebhookHandler) GetWebhook(c *gin.Context) {
+	userID, err := currentUserID(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	id, err := webhookIDParam(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	webhook, err := h.webhookService.Get(c.Request.Context(), userID, id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	respond(c, http.StatusOK, webhook)
+}
+
+func (h *WebhookHandler) UpdateWebhook(c *gin.Context) {
+	userID, err := currentUserID(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	id, err := webhookIDParam(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	var req models.WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperrors.Wrap(apperrors.ErrInvalidRequest, err, "invalid request body"))
+		return
+	}
+
+	webhook, err := h.webhookService.Update(c.Request.Context(), userID, id, req)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	respond(c, http.StatusOK, webhook)
+}
+
+func (h *WebhookHandler) DeleteWebhook(c *gin.Context) {
+	userID, err := currentUserID(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	id, err := webhookIDParam(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err := h.webhookService.Delete(c.Request.Context(), userID, id); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *WebhookHandler) ListDeliveries(c *gin.Context) {
+	userID, err := currentUserID(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	id, err := webhookIDParam(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	var req models.DeliveryListRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.Error(apperrors.Wrap(apperrors.ErrInvalidRequest, err, "limit must be an integer"))
+		return
+	}
+
+	deliveries, err := h.webhookService.ListDeliveries(c.Request.Context(), userID, id, req)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	respond(c, http.StatusOK, deliveries)
+}
+
+func (h *WebhookHandler) Redeliver(c *gin.Context) {
+	userID, err := currentUserID(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	id, err := webhookIDParam(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	deliveryID, err := primitive.ObjectIDFromHex(c.Param("delivery_id"))
+	if err != nil {
+		c.Error(apperrors.New(apperrors.ErrInvalidRequest, "invalid delivery ID"))
+		return
+	}
+
+	delivery, err := h.webhookService.Redeliver(c.Request.Context(), userID, id, deliveryID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	respond(c, http.StatusAccepted, delivery)
+}
+
+func webhookIDParam(c *gin.Context) (primitive.ObjectID, error) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return primitive.NilObjectID, apperrors.New(apperrors.ErrInvalidRequest, "invalid webhook ID")
+	}
+	return id, nil
+}
@@ -0,0 +1,129 @@
+// Package index builds the inverted index used to search across files. Each
+// file is split into chunks of consecutive lines and every chunk records the
+// distinct terms that appear in it.
+package index
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+	"user-service/internal/models"
+	"user-service/internal/parser"
+	"user-service/internal/preview"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// Chunks are closed when they reach any of these limits.
+	maxChunkLines = 1000
+	maxChunkBytes = 1 << 20
+	maxChunkTerms = 10000
+
+	minTermLength = 2
+	maxTermLength = 64
+)
+
+// Tokenize splits text into lower-case terms made of letters, digits and
+// underscores. Single characters and terms longer than 64 bytes are dropped.
+func Tokenize(text string) []string {
+	var terms []string
+	for _, field := range strings.FieldsFunc(text, isSeparator) {
+		if utf8.RuneCountInString(field) >= minTermLength && len(field) <= maxTermLength {
+			terms = append(terms, strings.ToLower(field))
+		}
+	}
+	return terms
+}
+
+// ContainsAll reports whether text contains every one of terms.
+func ContainsAll(text string, terms []string) bool {
+	present := make(map[string]bool)
+	for _, term := range Tokenize(text) {
+		present[term] = true
+	}
+	for _, term := range terms {
+		if !present[term] {
+			return false
+		}
+	}
+	return true
+}
+
+func isSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+}
+
+// Builder groups parsed records into chunks and passes each finished chunk
+// to flush.
+type Builder struct {
+	fileID   primitive.ObjectID
+	userID   uint
+	encoding string
+	flush    func(*models.IndexChunk) error
+
+	chunk *models.IndexChunk
+	terms map[string]struct{}
+}
+
+// NewBuilder returns a Builder for a file. encoding is the file's detected
+// encoding and is used to decode lines before they are tokenized.
+func NewBuilder(fileID primitive.ObjectID, userID uint, encoding string, flush func(*models.IndexChunk) error) *Builder {
+	return &Builder{
+		fileID:   fileID,
+		userID:   userID,
+		encoding: encoding,
+		flush:    flush,
+	}
+}
+
+// Add indexes a record, flushing the current chunk when it is full.
+func (b *Builder) Add(record parser.Record) error {
+	if b.chunk == nil {
+		b.chunk = &models.IndexChunk{
+			FileID:      b.fileID,
+			UserID:      b.userID,
+			StartLine:   record.Line,
+			StartOffset: record.Offset,
+		}
+		b.terms = make(map[string]struct{})
+	}
+
+	chunk := b.chunk
+	chunk.EndLine = record.Line
+	chunk.EndOffset = record.Offset + record.Length
+	if t := record.Timestamp; t != nil {
+		if chunk.FirstTimestamp == nil || t.Before(*chunk.FirstTimestamp) {
+			chunk.FirstTimestamp = t
+		}
+		if chunk.LastTimestamp == nil || t.After(*chunk.LastTimestamp) {
+			chunk.LastTimestamp = t
+		}
+	}
+	for _, term := range Tokenize(preview.Decode([]byte(record.Raw), b.encoding)) {
+		b.terms[term] = struct{}{}
+	}
+
+	if chunk.EndLine-chunk.StartLine+1 >= maxChunkLines ||
+		chunk.EndOffset-chunk.StartOffset >= maxChunkBytes ||
+		len(b.terms) >= maxChunkTerms {
+		return b.Close()
+	}
+	return nil
+}
+
+// Close flushes the last, partly filled chunk.
+func (b *Builder) Close() error {
+	if b.chunk == nil {
+		return nil
+	}
+	chunk := b.chunk
+	chunk.Terms = make([]string, 0, len(b.terms))
+	for term := range b.terms {
+		chunk.Terms = append(chunk.Terms, term)
+	}
+	slices.Sort(chunk.Terms)
+	b.chunk, b.terms = nil, nil
+	return b.flush(chunk)
+}
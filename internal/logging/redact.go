@@ -0,0 +1,74 @@
+package logging
+
+import (
+	"log/slog"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces values that must not be logged.
+const Redacted = "REDACTED"
+
+// sensitiveKeys are attribute keys whose values are never logged.
+var sensitiveKeys = map[string]bool{
+	"authorization": true,
+	"cookie":        true,
+	"password":      true,
+	"secret":        true,
+	"token":         true,
+}
+
+// urlPattern finds URLs embedded in messages and errors, such as the
+// `Get "https://..."` of a failed HTTP request.
+var urlPattern = regexp.MustCompile(`[a-zA-Z][a-zA-Z0-9+.-]*://[^\s"'<>]+`)
+
+// RedactURL hides the parts of a URL that may hold credentials: the
+// password in its user info and the values of its query parameters, which
+// often carry access tokens or signatures. It drops the fragment.
+func RedactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		// Keep what precedes anything that might be a credential
+		before, _, _ := strings.Cut(raw, "?")
+		return before
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), Redacted)
+	}
+	query := u.RawQuery
+	u.RawQuery, u.Fragment, u.RawFragment = "", "", ""
+	if query == "" {
+		return u.String()
+	}
+	params := strings.Split(query, "&")
+	for i, param := range params {
+		name, _, _ := strings.Cut(param, "=")
+		params[i] = name + "=" + Redacted
+	}
+	return u.String() + "?" + strings.Join(params, "&")
+}
+
+// redactString redacts every URL in s.
+func redactString(s string) string {
+	if !strings.Contains(s, "://") {
+		return s
+	}
+	return urlPattern.ReplaceAllStringFunc(s, RedactURL)
+}
+
+// redactAttr is the ReplaceAttr hook of the handlers returned by New.
+func redactAttr(_ []string, a slog.Attr) slog.Attr {
+	if sensitiveKeys[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, Redacted)
+	}
+	switch a.Value.Kind() {
+	case slog.KindString:
+		a.Value = slog.StringValue(redactString(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			a.Value = slog.StringValue(redactString(err.Error()))
+		}
+	}
+	return a
+}
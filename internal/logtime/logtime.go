@@ -0,0 +1,91 @@
+// Package logtime extracts timestamps from log lines in the formats commonly
+// found in application, access and system logs.
+package logtime
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// scanLimit bounds how far into a line Extract looks for a timestamp.
+const scanLimit = 256
+
+var (
+	// 2024-03-20T10:00:00Z, 2024-03-20 10:00:00,123, 2024-03-20T10:00:00.5+0100
+	isoPattern = regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:[.,]\d+)?(?:Z|[+-]\d{2}:?\d{2})?`)
+
+	// Common/combined log format: 10/Oct/2000:13:55:36 -0700
+	clfPattern = regexp.MustCompile(`\d{2}/[A-Z][a-z]{2}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}`)
+
+	// RFC 3164 syslog: Oct  3 13:55:36
+	syslogPattern = regexp.MustCompile(`[A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2}`)
+)
+
+// Extract returns the first timestamp found near the start of line.
+func Extract(line string) (time.Time, bool) {
+	if len(line) > scanLimit {
+		line = line[:scanLimit]
+	}
+
+	if match := isoPattern.FindString(line); match != "" {
+		if t, ok := parseISO(match); ok {
+			return t, true
+		}
+	}
+	if match := clfPattern.FindString(line); match != "" {
+		if t, err := time.Parse("02/Jan/2006:15:04:05 -0700", match); err == nil {
+			return t, true
+		}
+	}
+	if match := syslogPattern.FindString(line); match != "" {
+		if t, ok := parseSyslog(match); ok {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Parse parses a standalone timestamp value, such as a "time" field in a
+// structured log record.
+func Parse(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	if match := isoPattern.FindString(value); match != "" && len(match) == len(value) {
+		return parseISO(match)
+	}
+	return Extract(value)
+}
+
+func parseISO(match string) (time.Time, bool) {
+	s := strings.Replace(match, " ", "T", 1)
+	s = strings.Replace(s, ",", ".", 1)
+
+	// Normalize +0100 to +01:00 so a single layout covers both
+	if n := len(s); n > 5 && (s[n-5] == '+' || s[n-5] == '-') && !strings.Contains(s[n-5:], ":") {
+		s = s[:n-2] + ":" + s[n-2:]
+	}
+
+	if t, err := time.Parse("2006-01-02T15:04:05.999999999Z07:00", s); err == nil {
+		return t, true
+	}
+	if t, err := time.Parse("2006-01-02T15:04:05.999999999", s); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// parseSyslog parses an RFC 3164 timestamp, which has no year. The current
+// year is assumed unless that would put the time more than a day in the
+// future, in which case the line is taken to be from last year.
+func parseSyslog(match string) (time.Time, bool) {
+	t, err := time.Parse("Jan _2 15:04:05", match)
+	if err != nil {
+		return time.Time{}, false
+	}
+	now := time.Now().UTC()
+	t = t.AddDate(now.Year(), 0, 0)
+	if t.After(now.Add(24 * time.Hour)) {
+		t = t.AddDate(-1, 0, 0)
+	}
+	return t, true
+}
@@ -0,0 +1,193 @@
+// Package merge interleaves the records of several log files into one stream
+// ordered by timestamp. Sources are read one record at a time, so a merge
+// holds a single record per source in memory however large the files are.
+package merge
+
+import (
+	"bufio"
+	"container/heap"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+	"user-service/internal/parser"
+)
+
+// Source yields records in file order and io.EOF at the end.
+// *parser.Scanner is a Source.
+type Source interface {
+	Next(ctx context.Context) (parser.Record, error)
+}
+
+// Merge calls fn with the records of all sources, oldest first. Each source
+// keeps its own order: a record without a timestamp sorts with the record
+// before it in the same source, and records before a source's first
+// timestamp come first. Ties go to the source listed first. Returning an
+// error from fn stops the merge.
+func Merge(ctx context.Context, sources []Source, fn func(source int, record parser.Record) error) error {
+	h := make(recordHeap, 0, len(sources))
+	last := make([]time.Time, len(sources))
+
+	next := func(i int) error {
+		record, err := sources[i].Next(ctx)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("source %d: %w", i, err)
+		}
+		if record.Timestamp != nil {
+			last[i] = *record.Timestamp
+		}
+		heap.Push(&h, item{source: i, at: last[i], record: record})
+		return nil
+	}
+
+	for i := range sources {
+		if err := next(i); err != nil {
+			return err
+		}
+	}
+	for h.Len() > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		top := heap.Pop(&h).(item)
+		if err := fn(top.source, top.record); err != nil {
+			return err
+		}
+		if err := next(top.source); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// item is the current record of one source. at is the time it sorts by.
+type item struct {
+	source int
+	at     time.Time
+	record parser.Record
+}
+
+type recordHeap []item
+
+func (h recordHeap) Len() int { return len(h) }
+
+func (h recordHeap) Less(i, j int) bool {
+	if !h[i].at.Equal(h[j].at) {
+		return h[i].at.Before(h[j].at)
+	}
+	return h[i].source < h[j].source
+}
+
+func (h recordHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *recordHeap) Push(x any) { *h = append(*h, x.(item)) }
+
+func (h *recordHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// Format is a merge output format.
+type Format string
+
+const (
+	// FormatNDJSON writes each record as a JSON object with its source file.
+	FormatNDJSON Format = "ndjson"
+
+	// FormatText writes each original line prefixed with its file name.
+	FormatText Format = "text"
+)
+
+// Formats lists the supported formats.
+var Formats = []Format{FormatNDJSON, FormatText}
+
+// ContentType returns the MIME type of a format.
+func (f Format) ContentType() string {
+	if f == FormatNDJSON {
+		return "application/x-ndjson"
+	}
+	return "text/plain; charset=utf-8"
+}
+
+// Extension returns the file name extension of a format, including the
+// leading dot.
+func (f Format) Extension() string {
+	if f == FormatNDJSON {
+		return ".ndjson"
+	}
+	return ".log"
+}
+
+// File identifies the source file of a record in the output.
+type File struct {
+	ID   string
+	Name string
+}
+
+// Writer writes merged records annotated with their source file. Flush must
+// be called to complete the output.
+type Writer struct {
+	w      *bufio.Writer
+	format Format
+}
+
+func NewWriter(w io.Writer, format Format) *Writer {
+	return &Writer{w: bufio.NewWriter(w), format: format}
+}
+
+// line is the NDJSON form of a record.
+type line struct {
+	FileID    string         `json:"file_id"`
+	FileName  string         `json:"file_name"`
+	Line      int64          `json:"line"`
+	Timestamp *time.Time     `json:"timestamp,omitempty"`
+	Level     string         `json:"level,omitempty"`
+	Message   string         `json:"message"`
+	Source    string         `json:"source,omitempty"`
+	Fields    map[string]any `json:"fields,omitempty"`
+}
+
+func (w *Writer) Write(file File, record parser.Record) error {
+	if w.format == FormatText {
+		_, err := fmt.Fprintf(w.w, "[%s] %s\n", file.Name, record.Raw)
+		return err
+	}
+
+	timestamp := record.Timestamp
+	if timestamp != nil {
+		utc := timestamp.UTC()
+		timestamp = &utc
+	}
+	l := line{
+		FileID:    file.ID,
+		FileName:  file.Name,
+		Line:      record.Line,
+		Timestamp: timestamp,
+		Level:     record.Level,
+		Message:   record.Message,
+		Source:    record.Source,
+		Fields:    record.Fields,
+	}
+	encoded, err := json.Marshal(l)
+	if err != nil {
+		// Fields that can't be encoded are left out
+		l.Fields = nil
+		if encoded, err = json.Marshal(l); err != nil {
+			return err
+		}
+	}
+	if _, err := w.w.Write(encoded); err != nil {
+		return err
+	}
+	return w.w.WriteByte('\n')
+}
+
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
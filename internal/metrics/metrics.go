@@ -0,0 +1,126 @@
+// Package metrics defines the Prometheus metrics the service exposes on
+// /metrics. Metrics are registered on Registry, which also carries the Go
+// runtime and process collectors.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "analyticsai"
+
+// Registry holds every metric the service exposes.
+var Registry = prometheus.NewRegistry()
+
+var (
+	// HTTPRequests counts served requests by method, route and status.
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests served, by method, route and status.",
+	}, []string{"method", "route", "status"})
+
+	// HTTPRequestDuration observes how long requests take to serve.
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time taken to serve HTTP requests, by method, route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// UploadedBytes counts file bytes stored by uploads, URL imports,
+	// archive extraction and appends.
+	UploadedBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "file_uploaded_bytes_total",
+		Help:      "File bytes stored by uploads, URL imports, archive extraction and appends.",
+	})
+
+	// DownloadedBytes counts file bytes sent to clients by downloads.
+	DownloadedBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "file_downloaded_bytes_total",
+		Help:      "File bytes read by downloads.",
+	})
+
+	// StorageOperationDuration observes storage backend calls by backend and
+	// operation.
+	StorageOperationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "storage_operation_duration_seconds",
+		Help:      "Time taken by storage backend operations, by backend and operation.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"backend", "operation"})
+
+	// StorageOperationErrors counts failed storage backend calls.
+	StorageOperationErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "storage_operation_errors_total",
+		Help:      "Failed storage backend operations, by backend and operation.",
+	}, []string{"backend", "operation"})
+
+	// MongoCommandDuration observes MongoDB commands by command name.
+	MongoCommandDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "mongodb_command_duration_seconds",
+		Help:      "Time taken by MongoDB commands, by command.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"command"})
+
+	// MongoCommandErrors counts failed MongoDB commands.
+	MongoCommandErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mongodb_command_errors_total",
+		Help:      "Failed MongoDB commands, by command.",
+	}, []string{"command"})
+
+	// URLImports counts URL imports by result: success, or the error code
+	// of a failed import, such as INVALID_URL.
+	URLImports = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "url_imports_total",
+		Help:      "URL imports, by result: success or the error code of the failure.",
+	}, []string{"result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPRequestDuration,
+		UploadedBytes,
+		DownloadedBytes,
+		StorageOperationDuration,
+		StorageOperationErrors,
+		MongoCommandDuration,
+		MongoCommandErrors,
+		URLImports,
+	)
+}
+
+// WatchAnalysisQueue exposes the analysis queue's depth and capacity,
+// read from length and capacity whenever metrics are scraped.
+func WatchAnalysisQueue(length, capacity func() int) {
+	Registry.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "analysis_queue_depth",
+			Help:      "Files waiting for an analysis worker.",
+		}, func() float64 { return float64(length()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "analysis_queue_capacity",
+			Help:      "Files that can wait for an analysis worker.",
+		}, func() float64 { return float64(capacity()) }),
+	)
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"time"
+	"user-service/pkg/storage"
+)
+
+// InstrumentStorage wraps a storage backend so that every operation records
+// its latency and errors under the backend's name. The wrapper supports
+// ranged reads and appends exactly when the backend does. Download and
+// range operations are timed until the stream is open, not until it has
+// been read.
+func InstrumentStorage(s storage.Storage, backend string) storage.Storage {
+	base := &instrumentedStorage{storage: s, backend: backend}
+	rangeReader, canRange := s.(storage.RangeReader)
+	appender, canAppend := s.(storage.Appender)
+	switch {
+	case canRange && canAppend:
+		return &struct {
+			*instrumentedStorage
+			*instrumentedRangeReader
+			*instrumentedAppender
+		}{base, &instrumentedRangeReader{rangeReader, backend}, &instrumentedAppender{appender, backend}}
+	case canRange:
+		return &struct {
+			*instrumentedStorage
+			*instrumentedRangeReader
+		}{base, &instrumentedRangeReader{rangeReader, backend}}
+	case canAppend:
+		return &struct {
+			*instrumentedStorage
+			*instrumentedAppender
+		}{base, &instrumentedAppender{appender, backend}}
+	default:
+		return base
+	}
+}
+
+// observeStorage records a storage operation that started at start.
+func observeStorage(backend, operation string, start time.Time, err error) {
+	StorageOperationDuration.WithLabelValues(backend, operation).Observe(time.Since(start).Seconds())
+	if err != nil {
+		StorageOperationErrors.WithLabelValues(backend, operation).Inc()
+	}
+}
+
+type instrumentedStorage struct {
+	storage storage.Storage
+	backend string
+}
+
+func (s *instrumentedStorage) UploadFile(ctx context.Context, file io.Reader, fileName string, contentType string) (string, error) {
+	start := time.Now()
+	key, err := s.storage.UploadFile(ctx, file, fileName, contentType)
+	observeStorage(s.backend, "upload", start, err)
+	return key, err
+}
+
+func (s *instrumentedStorage) DownloadFile(ctx context.Context, fileName string) (io.ReadCloser, error) {
+	start := time.Now()
+	reader, err := s.storage.DownloadFile(ctx, fileName)
+	observeStorage(s.backend, "download", start, err)
+	return reader, err
+}
+
+func (s *instrumentedStorage) DeleteFile(ctx context.Context, fileName string) error {
+	start := time.Now()
+	err := s.storage.DeleteFile(ctx, fileName)
+	observeStorage(s.backend, "delete", start, err)
+	return err
+}
+
+func (s *instrumentedStorage) GetFileURL(fileName string) string {
+	return s.storage.GetFileURL(fileName)
+}
+
+type instrumentedRangeReader struct {
+	rangeReader storage.RangeReader
+	backend     string
+}
+
+func (s *instrumentedRangeReader) DownloadRange(ctx context.Context, fileName string, offset, length int64) (io.ReadCloser, error) {
+	start := time.Now()
+	reader, err := s.rangeReader.DownloadRange(ctx, fileName, offset, length)
+	observeStorage(s.backend, "download_range", start, err)
+	return reader, err
+}
+
+type instrumentedAppender struct {
+	appender storage.Appender
+	backend  string
+}
+
+func (s *instrumentedAppender) AppendFile(ctx context.Context, fileName string, data []byte) (int64, error) {
+	start := time.Now()
+	size, err := s.appender.AppendFile(ctx, fileName, data)
+	observeStorage(s.backend, "append", start, err)
+	return size, err
+}
@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"slices"
+	"user-service/internal/apperrors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireAdmin rejects requests from users other than the given admins.
+func RequireAdmin(adminIDs []uint) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := c.Get("user_id")
+		if !ok {
+			c.Error(apperrors.ErrUnauthorized)
+			c.Abort()
+			return
+		}
+		if id, _ := userID.(uint); !slices.Contains(adminIDs, id) {
+			c.Error(apperrors.New(apperrors.ErrForbidden, "admin access required"))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"user-service/internal/apperrors"
+	"user-service/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuditRecorder stores audit entries.
+type AuditRecorder interface {
+	Record(ctx context.Context, entry *models.AuditEntry) error
+}
+
+// Audit returns a function that makes middleware recording each request to
+// a route as the given action, once the handler has finished. The file is
+// the :id path parameter, or the "file_id" a handler sets in the context
+// for files it creates. Audit must run inside ErrorHandler so it sees the
+// handler's errors before they are rendered.
+func Audit(recorder AuditRecorder) func(action models.AuditAction) gin.HandlerFunc {
+	return func(action models.AuditAction) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			c.Next()
+
+			entry := &models.AuditEntry{
+				ActorID:   c.GetUint("user_id"),
+				Action:    action,
+				FileID:    c.GetString("file_id"),
+				IP:        c.ClientIP(),
+				UserAgent: c.Request.UserAgent(),
+				RequestID: c.GetString("request_id"),
+				Status:    c.Writer.Status(),
+				Outcome:   models.AuditOutcomeSuccess,
+			}
+			if entry.FileID == "" {
+				entry.FileID = c.Param("id")
+			}
+			if len(c.Errors) > 0 {
+				err := c.Errors.Last().Err
+				entry.ErrorCode = string(apperrors.From(err).Code)
+				if !c.Writer.Written() {
+					entry.Status = StatusFor(err)
+				}
+			}
+			switch {
+			case entry.Status == http.StatusUnauthorized || entry.Status == http.StatusForbidden:
+				entry.Outcome = models.AuditOutcomeDenied
+			case entry.Status >= http.StatusBadRequest || entry.ErrorCode != "":
+				entry.Outcome = models.AuditOutcomeFailure
+			}
+
+			// The request is over, but the entry must still be written
+			ctx := context.WithoutCancel(c.Request.Context())
+			if err := recorder.Record(ctx, entry); err != nil {
+				slog.ErrorContext(ctx, "Failed to record audit entry", "op", "Audit", "action", action, "actor_id", entry.ActorID, "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"user-service/internal/apperrors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// statusByKind maps error kinds to HTTP status codes. Kinds are checked in
+// order, so more specific kinds must come before their parents.
+var statusByKind = []struct {
+	kind   *apperrors.Error
+	status int
+}{
+	{apperrors.ErrInvalidRequest, http.StatusBadRequest},
+	{apperrors.ErrUnauthorized, http.StatusUnauthorized},
+	{apperrors.ErrForbidden, http.StatusForbidden},
+	{apperrors.ErrNotFound, http.StatusNotFound},
+	{apperrors.ErrInvalidState, http.StatusConflict},
+	{apperrors.ErrFileTooLarge, http.StatusRequestEntityTooLarge},
+	{apperrors.ErrQuotaExceeded, http.StatusRequestEntityTooLarge},
+}
+
+// ErrorResponse is the documented error envelope.
+type ErrorResponse struct {
+	Status string    `json:"status"`
+	Error  ErrorBody `json:"error"`
+}
+
+type ErrorBody struct {
+	Code    apperrors.Code `json:"code"`
+	Message string         `json:"message"`
+	Details map[string]any `json:"details,omitempty"`
+}
+
+// ErrorHandler renders the last error a handler attached with c.Error as the
+// documented error envelope. Only the client-safe message is returned; the
+// full error, including driver and storage causes, is logged.
+func ErrorHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 {
+			return
+		}
+
+		err := c.Errors.Last().Err
+		appErr := apperrors.From(err)
+		status := StatusFor(err)
+		level := slog.LevelWarn
+		if status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		slog.Log(c.Request.Context(), level, "Request failed", "op", "ErrorHandler", "method", c.Request.Method, "path", c.Request.URL.Path, "status", status, "code", appErr.Code, "error", err)
+
+		if c.Writer.Written() {
+			return
+		}
+		c.AbortWithStatusJSON(status, ErrorResponse{
+			Status: "error",
+			Error: ErrorBody{
+				Code:    appErr.Code,
+				Message: appErr.Message,
+				Details: appErr.Details,
+			},
+		})
+	}
+}
+
+// StatusFor returns the HTTP status code for an error.
+func StatusFor(err error) int {
+	for _, entry := range statusByKind {
+		if errors.Is(err, entry.kind) {
+			return entry.status
+		}
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+	"user-service/internal/apperrors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestLogger logs each request once it has been served. Only the path
+// is logged; query strings can carry credentials.
+func RequestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		slog.LogAttrs(c.Request.Context(), slog.LevelInfo, "Request served",
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.String("route", route),
+			slog.Int("status", c.Writer.Status()),
+			slog.Int("bytes", max(c.Writer.Size(), 0)),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("client_ip", c.ClientIP()),
+		)
+	}
+}
+
+// Recovery turns a panic in a handler into a 500 response with the
+// documented error envelope, and logs it with its stack.
+func Recovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+			slog.ErrorContext(c.Request.Context(), "Handler panicked", "op", "Recovery", "panic", recovered, "stack", string(debug.Stack()))
+			if c.Writer.Written() {
+				c.Abort()
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{
+				Status: "error",
+				Error:  ErrorBody{Code: apperrors.ErrInternal.Code, Message: apperrors.ErrInternal.Message},
+			})
+		}()
+		c.Next()
+	}
+}
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+	"user-service/internal/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Metrics counts and times each request by method, route and status.
+// Requests that match no route share the "unmatched" route, so unknown
+// paths can't add label values without bound.
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		metrics.HTTPRequests.WithLabelValues(c.Request.Method, route, status).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AuditAction names an audited request.
+type AuditAction string
+
+const (
+	AuditFileUpload    AuditAction = "file.upload"
+	AuditFileUploadURL AuditAction = "file.upload_url"
+	AuditFileList      AuditAction = "file.list"
+	AuditFileDelete    AuditAction = "file.delete"
+	AuditFileHide      AuditAction = "file.hide"
+	AuditFileDownload  AuditAction = "file.download"
+	AuditFilePreview   AuditAction = "file.preview"
+	AuditFileSearch    AuditAction = "file.search"
+	AuditFileAnalysis  AuditAction = "file.analysis"
+	AuditFilePatterns  AuditAction = "file.patterns"
+	AuditFileTimeline  AuditAction = "file.timeline"
+	AuditFileExport    AuditAction = "file.export"
+	AuditFileMerge     AuditAction = "file.merge"
+	AuditFileAppend    AuditAction = "file.append"
+	AuditFileTail      AuditAction = "file.tail"
+	AuditLogList       AuditAction = "audit.list"
+	AuditLogExport     AuditAction = "audit.export"
+	AuditLogVerify     AuditAction = "audit.verify"
+	AuditQuotaUpdate   AuditAction = "quota.update"
+)
+
+// AuditOutcome summarizes how an audited request ended.
+type AuditOutcome string
+
+const (
+	AuditOutcomeSuccess AuditOutcome = "success"
+	AuditOutcomeFailure AuditOutcome = "failure"
+
+	// AuditOutcomeDenied is a request rejected as unauthenticated or
+	// forbidden.
+	AuditOutcomeDenied AuditOutcome = "denied"
+)
+
+// AuditEntry records one audited request. Entries are never updated or
+// deleted.
+type AuditEntry struct {
+	ID primitive.ObjectID `bson:"_id" json:"id"`
+
+	// Seq, PrevHash and Hash link the entry into the hash chain when it
+	// is enabled. Hash covers the entry's other fields and PrevHash, so
+	// changing, removing or reordering entries breaks the chain.
+	Seq      int64  `bson:"seq,omitempty" json:"seq,omitempty"`
+	PrevHash string `bson:"prev_hash,omitempty" json:"prev_hash,omitempty"`
+	Hash     string `bson:"hash,omitempty" json:"hash,omitempty"`
+
+	Time      time.Time    `bson:"time" json:"time"`
+	ActorID   uint         `bson:"actor_id" json:"actor_id"`
+	Action    AuditAction  `bson:"action" json:"action"`
+	FileID    string       `bson:"file_id,omitempty" json:"file_id,omitempty"`
+	IP        string       `bson:"ip" json:"ip"`
+	UserAgent string       `bson:"user_agent" json:"user_agent"`
+	RequestID string       `bson:"request_id" json:"request_id"`
+	Outcome   AuditOutcome `bson:"outcome" json:"outcome"`
+
+	// Status is the HTTP status of the response, and ErrorCode the error
+	// code of a failed request.
+	Status    int    `bson:"status" json:"status"`
+	ErrorCode string `bson:"error_code,omitempty" json:"error_code,omitempty"`
+}
+
+// AuditListRequest filters audit entries. Limit defaults to 100 and is
+// ignored by exports; Before pages back from an entry ID.
+type AuditListRequest struct {
+	ActorID   *uint        `form:"actor_id"`
+	Action    AuditAction  `form:"action"`
+	FileID    string       `form:"file_id"`
+	Outcome   AuditOutcome `form:"outcome"`
+	RequestID string       `form:"request_id"`
+	From      *time.Time   `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To        *time.Time   `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+	Before    string       `form:"before"`
+	Limit     int          `form:"limit"`
+}
+
+// AuditVerification is the result of checking the hash chain.
+type AuditVerification struct {
+	Valid   bool  `json:"valid"`
+	Entries int64 `json:"entries"`
+
+	// BrokenAt is the sequence number of the first entry that does not
+	// match the chain, with the reason.
+	BrokenAt int64  `json:"broken_at,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
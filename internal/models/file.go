@@ -15,6 +15,32 @@ const (
 	FileStatusAnalyzing FileStatus = "analyzing"
 )
 
+// LogFormat identifies the structure of a log file's lines.
+type LogFormat string
+
+const (
+	LogFormatJSONLines  LogFormat = "jsonl"
+	LogFormatSyslog5424 LogFormat = "syslog_rfc5424"
+	LogFormatSyslog3164 LogFormat = "syslog_rfc3164"
+	LogFormatCombined   LogFormat = "combined"
+	LogFormatLogfmt     LogFormat = "logfmt"
+	LogFormatCSV        LogFormat = "csv"
+	LogFormatTSV        LogFormat = "tsv"
+	LogFormatText       LogFormat = "text"
+)
+
+// LogFormats lists every format the detector can report.
+var LogFormats = []LogFormat{
+	LogFormatJSONLines,
+	LogFormatSyslog5424,
+	LogFormatSyslog3164,
+	LogFormatCombined,
+	LogFormatLogfmt,
+	LogFormatCSV,
+	LogFormatTSV,
+	LogFormatText,
+}
+
 type File struct {
 	ID          primitive.ObjectID `bson:"_id" json:"id"`
 	UserID      uint               `bson:"user_id" json:"user_id"`
@@ -24,14 +50,137 @@ type File struct {
 	Size        int64              `bson:"size" json:"size"`
 	MimeType    string             `bson:"mime_type" json:"mime_type"`
 	Status      FileStatus         `bson:"status" json:"status"`
-	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
-	UpdatedAt   time.Time          `bson:"updated_at" json:"updated_at"`
+	Analysis    *FileAnalysis      `bson:"analysis,omitempty" json:"analysis,omitempty"`
+	Format      *FormatDetection   `bson:"format,omitempty" json:"format,omitempty"`
+	Redaction   *RedactionReport   `bson:"redaction,omitempty" json:"redaction,omitempty"`
+	Tags        []string           `bson:"tags,omitempty" json:"tags,omitempty"`
+
+	// Archive is set on files extracted from an archive upload.
+	Archive *ArchiveEntry `bson:"archive,omitempty" json:"archive,omitempty"`
+
+	// Extraction is set on an extracted archive upload, which has no content
+	// of its own; its entries are stored as separate files.
+	Extraction *Extraction `bson:"extraction,omitempty" json:"extraction,omitempty"`
+
+	// DerivedFrom is set on files produced from another file by a job.
+	DerivedFrom *DerivedFrom `bson:"derived_from,omitempty" json:"derived_from,omitempty"`
+
+	// Version starts at 1 and increases whenever the file's content changes.
+	Version int64 `bson:"version" json:"version"`
+
+	// Timelines caches computed timelines by bucket size. Entries computed
+	// for an older Version are stale.
+	Timelines map[string]*Timeline `bson:"timelines,omitempty" json:"-"`
+
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// FileAnalysis holds the results of the post-upload analysis pipeline.
+type FileAnalysis struct {
+	LineCount      int64       `bson:"line_count" json:"line_count"`
+	ByteCount      int64       `bson:"byte_count" json:"byte_count"`
+	Encoding       string      `bson:"encoding" json:"encoding"`
+	FirstTimestamp *time.Time  `bson:"first_timestamp,omitempty" json:"first_timestamp,omitempty"`
+	LastTimestamp  *time.Time  `bson:"last_timestamp,omitempty" json:"last_timestamp,omitempty"`
+	Parse          *ParseStats `bson:"parse,omitempty" json:"parse,omitempty"`
+	Error          string      `bson:"error,omitempty" json:"error,omitempty"`
+	CompletedAt    time.Time   `bson:"completed_at" json:"completed_at"`
+}
+
+// ParseStats summarizes a parse of a file into normalized records.
+type ParseStats struct {
+	Parsed  int64          `bson:"parsed" json:"parsed"`
+	Failed  int64          `bson:"failed" json:"failed"`
+	Samples []ParseFailure `bson:"samples,omitempty" json:"samples,omitempty"`
+}
+
+// ParseFailure is a sampled line that could not be parsed in the file's
+// format.
+type ParseFailure struct {
+	Line  int64  `bson:"line" json:"line"`
+	Text  string `bson:"text" json:"text"`
+	Error string `bson:"error" json:"error"`
+}
+
+// FormatDetection records the detected log format of a file and how
+// confident the detector is, from 0 to 1.
+type FormatDetection struct {
+	Format       LogFormat `bson:"format" json:"format"`
+	Confidence   float64   `bson:"confidence" json:"confidence"`
+	SampledLines int       `bson:"sampled_lines" json:"sampled_lines"`
+}
+
+// ArchiveEntry links a file to the archive upload it was extracted from.
+type ArchiveEntry struct {
+	ParentID primitive.ObjectID `bson:"parent_id" json:"parent_id"`
+	Path     string             `bson:"path" json:"path"`
+}
+
+// Extraction summarizes the expansion of an archive upload into files.
+type Extraction struct {
+	Kind      string         `bson:"kind" json:"kind"`
+	Extracted int            `bson:"extracted" json:"extracted"`
+	Skipped   []SkippedEntry `bson:"skipped,omitempty" json:"skipped,omitempty"`
+
+	// Error is set when extraction stopped early, such as when the archive
+	// expands beyond the allowed size.
+	Error string `bson:"error,omitempty" json:"error,omitempty"`
+}
+
+// SkippedEntry is an archive entry that was not stored as a file.
+type SkippedEntry struct {
+	Path   string `bson:"path" json:"path"`
+	Reason string `bson:"reason" json:"reason"`
+}
+
+// FileFilter narrows the files returned by a listing.
+type FileFilter struct {
+	Format   LogFormat
+	Status   FileStatus
+	ParentID *primitive.ObjectID
+	Tag      string
+}
+
+// PreviewRequest selects the lines returned by a preview. At most one of
+// Head, Tail and the FromLine/ToLine range may be set.
+type PreviewRequest struct {
+	Head     int64 `form:"head"`
+	Tail     int64 `form:"tail"`
+	FromLine int64 `form:"from_line"`
+	ToLine   int64 `form:"to_line"`
+}
+
+// TailRequest follows a file as it grows. Lines is the number of existing
+// lines sent first; unset sends the default.
+type TailRequest struct {
+	Lines *int64 `form:"lines"`
+}
+
+// SearchRequest is a grep-style search within a file.
+type SearchRequest struct {
+	Query      string `form:"q"`
+	Regex      bool   `form:"regex"`
+	IgnoreCase bool   `form:"ignore_case"`
+	Context    int    `form:"context"`
+	MaxMatches int    `form:"max_matches"`
 }
 
 type FileUploadRequest struct {
-	Name        string `json:"name" binding:"required"`
-	URL         string `json:"url,omitempty"`
-	ContentType string `json:"content_type,omitempty"`
+	Name        string        `json:"name" binding:"required"`
+	URL         string        `json:"url,omitempty"`
+	ContentType string        `json:"content_type,omitempty"`
+	Redaction   RedactionMode `json:"redaction,omitempty"`
+	Extract     bool          `json:"extract,omitempty"`
+	Tags        []string      `json:"tags,omitempty"`
+}
+
+// ImportFailure is the data of an import.failed event.
+type ImportFailure struct {
+	URL     string `json:"url"`
+	Name    string `json:"name"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
 }
 
 type FileResponse struct {
@@ -42,3 +191,26 @@ type FileResponse struct {
 	CreatedAt   time.Time  `json:"created_at"`
 	DownloadURL string     `json:"download_url,omitempty"`
 }
+
+// RedactionMode controls what happens to personal data found in uploads.
+type RedactionMode string
+
+const (
+	// RedactionModeOff skips detection.
+	RedactionModeOff RedactionMode = "off"
+
+	// RedactionModeReport counts findings but stores the content unchanged.
+	RedactionModeReport RedactionMode = "report"
+
+	// RedactionModeMask replaces findings in the stored content.
+	RedactionModeMask RedactionMode = "mask"
+)
+
+var RedactionModes = []RedactionMode{RedactionModeOff, RedactionModeReport, RedactionModeMask}
+
+// RedactionReport records what the redaction stage found in an upload.
+type RedactionReport struct {
+	Mode   RedactionMode    `bson:"mode" json:"mode"`
+	Counts map[string]int64 `bson:"counts" json:"counts"`
+	Total  int64            `bson:"total" json:"total"`
+}
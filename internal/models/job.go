@@ -0,0 +1,79 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type JobType string
+
+const (
+	JobTypeExport JobType = "export"
+	JobTypeMerge  JobType = "merge"
+)
+
+type JobStatus string
+
+const (
+	JobStatusQueued    JobStatus = "queued"
+	JobStatusRunning   JobStatus = "running"
+	JobStatusCompleted JobStatus = "completed"
+	JobStatusFailed    JobStatus = "failed"
+)
+
+// Job is a background task that produces a derived file.
+type Job struct {
+	ID     primitive.ObjectID `bson:"_id" json:"id"`
+	UserID uint               `bson:"user_id" json:"user_id"`
+	Type   JobType            `bson:"type" json:"type"`
+	Status JobStatus          `bson:"status" json:"status"`
+
+	// FileID is the source file of a single-file job.
+	FileID *primitive.ObjectID `bson:"file_id,omitempty" json:"file_id,omitempty"`
+
+	// Export holds the parameters of an export job.
+	Export *ExportRequest `bson:"export,omitempty" json:"export,omitempty"`
+
+	// Merge holds the parameters of a merge job, including its source files.
+	Merge *MergeRequest `bson:"merge,omitempty" json:"merge,omitempty"`
+
+	// ResultFileID is the derived file of a completed job.
+	ResultFileID *primitive.ObjectID `bson:"result_file_id,omitempty" json:"result_file_id,omitempty"`
+	Error        string              `bson:"error,omitempty" json:"error,omitempty"`
+
+	CreatedAt   time.Time  `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time  `bson:"updated_at" json:"updated_at"`
+	CompletedAt *time.Time `bson:"completed_at,omitempty" json:"completed_at,omitempty"`
+}
+
+// ExportRequest converts a file's normalized records to another format.
+// Fields is a comma-separated column selection and unset From and To times
+// leave the range open. Async asks for a background job even for small
+// files.
+type ExportRequest struct {
+	Format string     `form:"format" bson:"format" json:"format"`
+	Fields string     `form:"fields" bson:"fields,omitempty" json:"fields,omitempty"`
+	From   *time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00" bson:"from,omitempty" json:"from,omitempty"`
+	To     *time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00" bson:"to,omitempty" json:"to,omitempty"`
+	Async  bool       `form:"async" bson:"-" json:"-"`
+}
+
+// MergeRequest interleaves the records of several files by timestamp.
+// Format is "ndjson" or "text" and Save stores the result as a new file,
+// optionally named Name, instead of streaming it.
+type MergeRequest struct {
+	FileIDs []primitive.ObjectID `bson:"file_ids" json:"file_ids" binding:"required"`
+	Format  string               `bson:"format,omitempty" json:"format,omitempty"`
+	Name    string               `bson:"name,omitempty" json:"name,omitempty"`
+	Save    bool                 `bson:"-" json:"save,omitempty"`
+}
+
+// DerivedFrom links a file produced by a job to its source files. FileID is
+// set for single-file jobs and FileIDs for merges.
+type DerivedFrom struct {
+	FileID  *primitive.ObjectID  `bson:"file_id,omitempty" json:"file_id,omitempty"`
+	FileIDs []primitive.ObjectID `bson:"file_ids,omitempty" json:"file_ids,omitempty"`
+	JobID   primitive.ObjectID   `bson:"job_id" json:"job_id"`
+	Type    JobType              `bson:"type" json:"type"`
+}
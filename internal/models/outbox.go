@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OutboxEventType identifies a change to a file recorded in the outbox.
+type OutboxEventType string
+
+const (
+	OutboxFileCreated             OutboxEventType = "file.created"
+	OutboxFileStatusChanged       OutboxEventType = "file.status_changed"
+	OutboxFileAppended            OutboxEventType = "file.appended"
+	OutboxFileAnalysisCompleted   OutboxEventType = "file.analysis_completed"
+	OutboxFileExtractionCompleted OutboxEventType = "file.extraction_completed"
+	OutboxFileRemoved             OutboxEventType = "file.removed"
+	OutboxFileContentDeleted      OutboxEventType = "file.content_deleted"
+)
+
+// OutboxEvent is a domain event written in the same transaction as the
+// change it describes, waiting for the relay to publish it. ID doubles as
+// the deduplication ID, and Sequence orders the events of one file.
+type OutboxEvent struct {
+	ID       primitive.ObjectID `bson:"_id"`
+	Type     OutboxEventType    `bson:"type"`
+	FileID   primitive.ObjectID `bson:"file_id"`
+	UserID   uint               `bson:"user_id"`
+	Sequence int64              `bson:"sequence"`
+
+	// Payload is the event's data as JSON.
+	Payload string `bson:"payload"`
+
+	CreatedAt   time.Time  `bson:"created_at"`
+	PublishedAt *time.Time `bson:"published_at,omitempty"`
+
+	// Attempts and LastError record failed publishes.
+	Attempts  int    `bson:"attempts,omitempty"`
+	LastError string `bson:"last_error,omitempty"`
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// FilePatterns holds the message templates mined from a file during
+// analysis.
+type FilePatterns struct {
+	FileID primitive.ObjectID `bson:"file_id" json:"-"`
+	UserID uint               `bson:"user_id" json:"-"`
+
+	// TotalLines is the number of non-empty messages mined.
+	TotalLines int64 `bson:"total_lines" json:"total_lines"`
+
+	// TemplateCount is the number of distinct templates found, of which
+	// only the most frequent are stored.
+	TemplateCount int `bson:"template_count" json:"template_count"`
+
+	// Unmatched counts messages that arrived after the template limit was
+	// reached and matched no existing template.
+	Unmatched int64 `bson:"unmatched" json:"unmatched"`
+
+	Patterns    []LogPattern `bson:"patterns" json:"patterns"`
+	CompletedAt time.Time    `bson:"completed_at" json:"completed_at"`
+}
+
+// LogPattern is a message template with <*> in place of variable tokens.
+type LogPattern struct {
+	Template  string     `bson:"template" json:"template"`
+	Count     int64      `bson:"count" json:"count"`
+	Examples  []string   `bson:"examples" json:"examples"`
+	FirstSeen *time.Time `bson:"first_seen,omitempty" json:"first_seen,omitempty"`
+	LastSeen  *time.Time `bson:"last_seen,omitempty" json:"last_seen,omitempty"`
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SavedQuery is a search that runs against each of the user's files that
+// match its filter whenever the file finishes analysis. An alert fires when
+// more lines than Threshold match.
+type SavedQuery struct {
+	ID         primitive.ObjectID `bson:"_id" json:"id"`
+	UserID     uint               `bson:"user_id" json:"user_id"`
+	Name       string             `bson:"name" json:"name"`
+	Query      string             `bson:"query" json:"query"`
+	Regex      bool               `bson:"regex" json:"regex"`
+	IgnoreCase bool               `bson:"ignore_case" json:"ignore_case"`
+	Filter     QueryFilter        `bson:"filter" json:"filter"`
+	Threshold  int64              `bson:"threshold" json:"threshold"`
+	Enabled    bool               `bson:"enabled" json:"enabled"`
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt  time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// QueryFilter selects the files a saved query runs against: files with all
+// of Tags, in Format when it is set.
+type QueryFilter struct {
+	Tags   []string  `bson:"tags,omitempty" json:"tags,omitempty"`
+	Format LogFormat `bson:"format,omitempty" json:"format,omitempty"`
+}
+
+// SavedQueryRequest creates or replaces a saved query. Enabled defaults to
+// true.
+type SavedQueryRequest struct {
+	Name       string      `json:"name" binding:"required"`
+	Query      string      `json:"query" binding:"required"`
+	Regex      bool        `json:"regex"`
+	IgnoreCase bool        `json:"ignore_case"`
+	Filter     QueryFilter `json:"filter"`
+	Threshold  int64       `json:"threshold"`
+	Enabled    *bool       `json:"enabled"`
+}
+
+// Alert records that a saved query matched more lines of a file than its
+// threshold. A query alerts at most once per version of a file, and on a
+// later version only when it matches more lines than in its last alert.
+type Alert struct {
+	ID        primitive.ObjectID `bson:"_id" json:"id"`
+	UserID    uint               `bson:"user_id" json:"user_id"`
+	QueryID   primitive.ObjectID `bson:"query_id" json:"query_id"`
+	QueryName string             `bson:"query_name" json:"query_name"`
+	FileID    primitive.ObjectID `bson:"file_id" json:"file_id"`
+	FileName  string             `bson:"file_name" json:"file_name"`
+
+	// FileVersion is the version of the file that was searched.
+	FileVersion int64 `bson:"file_version" json:"file_version"`
+
+	Matches   int64 `bson:"matches" json:"matches"`
+	Threshold int64 `bson:"threshold" json:"threshold"`
+
+	// LimitReached is set when the search stopped counting before the end
+	// of the file, so Matches is a lower bound.
+	LimitReached bool `bson:"limit_reached,omitempty" json:"limit_reached,omitempty"`
+
+	// Samples are the first matching lines.
+	Samples []AlertSample `bson:"samples" json:"samples"`
+
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+}
+
+// AlertSample is a matching line of a file.
+type AlertSample struct {
+	Line int64  `bson:"line" json:"line"`
+	Text string `bson:"text" json:"text"`
+}
+
+// AlertListRequest filters the alerts returned by a listing. Limit defaults
+// to 50.
+type AlertListRequest struct {
+	QueryID string `form:"query_id"`
+	Limit   int    `form:"limit"`
+}
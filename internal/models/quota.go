@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// UserQuota tracks a user's storage consumption. MaxBytes and MaxFiles are
+// optional per-user overrides; when unset the service-wide defaults apply.
+type UserQuota struct {
+	UserID    uint      `bson:"user_id" json:"user_id"`
+	MaxBytes  *int64    `bson:"max_bytes,omitempty" json:"max_bytes,omitempty"`
+	MaxFiles  *int64    `bson:"max_files,omitempty" json:"max_files,omitempty"`
+	UsedBytes int64     `bson:"used_bytes" json:"used_bytes"`
+	UsedFiles int64     `bson:"used_files" json:"used_files"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// QuotaLimitsRequest sets a user's quota overrides. An omitted or null
+// limit removes the override, so the service-wide default applies again; 0
+// means unlimited.
+type QuotaLimitsRequest struct {
+	MaxBytes *int64 `json:"max_bytes"`
+	MaxFiles *int64 `json:"max_files"`
+}
+
+// UsageResponse reports current consumption against the effective limits.
+// A limit of 0 means unlimited.
+type UsageResponse struct {
+	UserID    uint  `json:"user_id"`
+	UsedBytes int64 `json:"used_bytes"`
+	UsedFiles int64 `json:"used_files"`
+	MaxBytes  int64 `json:"max_bytes"`
+	MaxFiles  int64 `json:"max_files"`
+}
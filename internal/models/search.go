@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// IndexChunk is an inverted-index entry holding the distinct terms of a run
+// of consecutive lines of one file. Offsets locate the run in the stored
+// file so matching lines can be read back without scanning the whole file.
+type IndexChunk struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty"`
+	FileID         primitive.ObjectID `bson:"file_id"`
+	UserID         uint               `bson:"user_id"`
+	StartLine      int64              `bson:"start_line"`
+	EndLine        int64              `bson:"end_line"`
+	StartOffset    int64              `bson:"start_offset"`
+	EndOffset      int64              `bson:"end_offset"`
+	FirstTimestamp *time.Time         `bson:"first_timestamp,omitempty"`
+	LastTimestamp  *time.Time         `bson:"last_timestamp,omitempty"`
+	Terms          []string           `bson:"terms,omitempty"`
+}
+
+// LibrarySearchRequest is a search across all of a user's active files.
+// Zero From and To times leave the range open.
+type LibrarySearchRequest struct {
+	Query string    `form:"q"`
+	From  time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To    time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+	Limit int       `form:"limit"`
+}
+
+// LibrarySearchResult lists the matching lines of one file.
+type LibrarySearchResult struct {
+	FileID   primitive.ObjectID `json:"file_id"`
+	FileName string             `json:"file_name"`
+	Hits     []SearchHit        `json:"hits"`
+}
+
+// SearchHit is a line that contains every search term.
+type SearchHit struct {
+	Line      int64      `json:"line"`
+	Offset    int64      `json:"offset"`
+	Text      string     `json:"text"`
+	Timestamp *time.Time `json:"timestamp,omitempty"`
+}
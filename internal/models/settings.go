@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// UserSettings holds per-user preferences. Unset fields fall back to the
+// service defaults.
+type UserSettings struct {
+	UserID        uint          `bson:"user_id" json:"user_id"`
+	RedactionMode RedactionMode `bson:"redaction_mode,omitempty" json:"redaction_mode,omitempty"`
+	UpdatedAt     time.Time     `bson:"updated_at" json:"updated_at"`
+}
+
+// UpdateSettingsRequest changes a user's settings. Omitted fields are left
+// unchanged; an empty string clears a setting.
+type UpdateSettingsRequest struct {
+	RedactionMode *RedactionMode `json:"redaction_mode"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// Timeline counts a file's records per time bucket, split by level.
+type Timeline struct {
+	Bucket string `bson:"bucket" json:"bucket"`
+
+	// Version is the file version the timeline was computed from.
+	Version int64            `bson:"version" json:"version"`
+	Buckets []TimelineBucket `bson:"buckets" json:"buckets"`
+
+	// Untimed counts records without a timestamp, which fall in no bucket.
+	Untimed    int64     `bson:"untimed" json:"untimed"`
+	ComputedAt time.Time `bson:"computed_at" json:"computed_at"`
+}
+
+// TimelineBucket holds the record counts of one bucket. Total includes
+// records without a recognized level.
+type TimelineBucket struct {
+	Start time.Time `bson:"start" json:"start"`
+	Total int64     `bson:"total" json:"total"`
+	Error int64     `bson:"error" json:"error"`
+	Warn  int64     `bson:"warn" json:"warn"`
+	Info  int64     `bson:"info" json:"info"`
+	Debug int64     `bson:"debug" json:"debug"`
+}
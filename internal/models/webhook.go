@@ -0,0 +1,83 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Webhook is an endpoint that receives a user's events. Secret signs every
+// delivery and is only returned when the webhook is created.
+type Webhook struct {
+	ID        primitive.ObjectID `bson:"_id" json:"id"`
+	UserID    uint               `bson:"user_id" json:"user_id"`
+	URL       string             `bson:"url" json:"url"`
+	Events    []string           `bson:"events" json:"events"`
+	Secret    string             `bson:"secret" json:"-"`
+	Enabled   bool               `bson:"enabled" json:"enabled"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// CreatedWebhook is the response to creating a webhook, the only one that
+// includes its secret.
+type CreatedWebhook struct {
+	*Webhook
+	Secret string `json:"secret"`
+}
+
+// WebhookRequest creates or replaces a webhook. Enabled defaults to true.
+type WebhookRequest struct {
+	URL     string   `json:"url" binding:"required"`
+	Events  []string `json:"events" binding:"required"`
+	Enabled *bool    `json:"enabled"`
+}
+
+// DeliveryStatus tracks a webhook delivery.
+type DeliveryStatus string
+
+const (
+	DeliveryStatusPending   DeliveryStatus = "pending"
+	DeliveryStatusSucceeded DeliveryStatus = "succeeded"
+	DeliveryStatusFailed    DeliveryStatus = "failed"
+)
+
+// WebhookDelivery is one event sent to one webhook, retried until the
+// receiver accepts it or the attempts run out.
+type WebhookDelivery struct {
+	ID        primitive.ObjectID `bson:"_id" json:"id"`
+	WebhookID primitive.ObjectID `bson:"webhook_id" json:"webhook_id"`
+	UserID    uint               `bson:"user_id" json:"user_id"`
+	EventID   string             `bson:"event_id" json:"event_id"`
+	EventType string             `bson:"event_type" json:"event_type"`
+
+	// Payload is the request body.
+	Payload string `bson:"payload" json:"payload"`
+
+	Status DeliveryStatus `bson:"status" json:"status"`
+
+	// NextAttemptAt is when a pending delivery is next sent.
+	NextAttemptAt time.Time           `bson:"next_attempt_at" json:"next_attempt_at"`
+	Attempts      []DeliveryAttempt   `bson:"attempts" json:"attempts"`
+	RedeliveryOf  *primitive.ObjectID `bson:"redelivery_of,omitempty" json:"redelivery_of,omitempty"`
+
+	CreatedAt   time.Time  `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time  `bson:"updated_at" json:"updated_at"`
+	CompletedAt *time.Time `bson:"completed_at,omitempty" json:"completed_at,omitempty"`
+}
+
+// DeliveryAttempt is one try at sending a delivery. StatusCode is 0 when no
+// response was received.
+type DeliveryAttempt struct {
+	At         time.Time `bson:"at" json:"at"`
+	StatusCode int       `bson:"status_code,omitempty" json:"status_code,omitempty"`
+	DurationMS int64     `bson:"duration_ms" json:"duration_ms"`
+	Error      string    `bson:"error,omitempty" json:"error,omitempty"`
+}
+
+// DeliveryListRequest filters the deliveries returned by a listing. Limit
+// defaults to 50.
+type DeliveryListRequest struct {
+	Status DeliveryStatus `form:"status"`
+	Limit  int            `form:"limit"`
+}
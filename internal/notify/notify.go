@@ -0,0 +1,74 @@
+// Package notify delivers events about users' data, such as fired alerts,
+// to the service's notification channels.
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// Event types.
+const (
+	EventFileCreated           = "file.created"
+	EventFileDeleted           = "file.deleted"
+	EventFileHidden            = "file.hidden"
+	EventFileAnalysisCompleted = "file.analysis_completed"
+	EventImportFailed          = "import.failed"
+	EventAlertFired            = "alert.fired"
+)
+
+// EventTypes lists every event type.
+var EventTypes = []string{
+	EventFileCreated,
+	EventFileDeleted,
+	EventFileHidden,
+	EventFileAnalysisCompleted,
+	EventImportFailed,
+	EventAlertFired,
+}
+
+// Event is something that happened to a user's data. ID is unique per event
+// so receivers can drop duplicate deliveries.
+//
+// File events carry the file as their data.
+type Event struct {
+	ID     string    `json:"id"`
+	Type   string    `json:"type"`
+	UserID uint      `json:"user_id"`
+	Time   time.Time `json:"time"`
+	Data   any       `json:"data"`
+}
+
+// Notifier is a notification channel.
+type Notifier interface {
+	Notify(ctx context.Context, event Event) error
+}
+
+// Multi sends each event to every notifier in turn. A failing notifier
+// doesn't keep the event from the others.
+type Multi []Notifier
+
+func (m Multi) Notify(ctx context.Context, event Event) error {
+	var errs []error
+	for _, notifier := range m {
+		if err := notifier.Notify(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Log writes events to the service log.
+type Log struct{}
+
+func (Log) Notify(ctx context.Context, event Event) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "Event", "op", "notify.Log", "type", event.Type, "event_id", event.ID, "user_id", event.UserID, "data", string(data))
+	return nil
+}
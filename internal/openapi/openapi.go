@@ -0,0 +1,77 @@
+// Package openapi serves the service's OpenAPI 3 document and an optional
+// Swagger UI, and checks that every registered API route is documented. The
+// Swagger UI assets are embedded, so the page works without internet access.
+package openapi
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BasePath is the route prefix the spec's paths are relative to.
+const BasePath = "/api/v1"
+
+//go:embed openapi.json
+var spec []byte
+
+//go:embed swagger.html
+var swaggerHTML []byte
+
+//go:embed swagger-ui/*.js swagger-ui/*.css swagger-ui/*.png
+var swaggerAssets embed.FS
+
+// Handler serves the OpenAPI document.
+func Handler(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json", spec)
+}
+
+// SwaggerUIHandler serves a Swagger UI page that renders /openapi.json.
+// The page loads its scripts and styles from SwaggerAssets, which must be
+// served at /docs/assets.
+func SwaggerUIHandler(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", swaggerHTML)
+}
+
+// SwaggerAssets returns the embedded Swagger UI scripts, styles and icon.
+func SwaggerAssets() http.FileSystem {
+	assets, err := fs.Sub(swaggerAssets, "swagger-ui")
+	if err != nil {
+		panic(err)
+	}
+	return http.FS(assets)
+}
+
+var paramPattern = regexp.MustCompile(`[:*]([A-Za-z0-9_]+)`)
+
+// MissingRoutes returns the routes under BasePath that have no matching
+// operation in the spec, formatted as "METHOD /path".
+func MissingRoutes(routes gin.RoutesInfo) ([]string, error) {
+	var doc struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse OpenAPI spec: %v", err)
+	}
+
+	var missing []string
+	for _, route := range routes {
+		if !strings.HasPrefix(route.Path, BasePath+"/") {
+			continue
+		}
+		// Gin's /files/:id becomes OpenAPI's /files/{id}
+		path := paramPattern.ReplaceAllString(strings.TrimPrefix(route.Path, BasePath), "{$1}")
+		if _, ok := doc.Paths[path][strings.ToLower(route.Method)]; !ok {
+			missing = append(missing, route.Method+" "+route.Path)
+		}
+	}
+	sort.Strings(missing)
+	return missing, nil
+}
@@ -0,0 +1,97 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// publishTimeout bounds a publish whose context has no deadline.
+const publishTimeout = 10 * time.Second
+
+// NATS message headers. Nats-Msg-Id lets JetStream streams drop duplicates.
+const (
+	headerFileID   = "File-ID"
+	headerSequence = "Sequence"
+)
+
+// NATSConfig configures a NATS publisher.
+type NATSConfig struct {
+	// URL is the server URL, such as nats://127.0.0.1:4222.
+	URL string
+
+	// SubjectPrefix is prepended to the event type to form the subject, as
+	// in "analyticsai.events.file.created".
+	SubjectPrefix string
+
+	// JetStream waits for a stream to store each message, and lets the
+	// stream drop duplicates by ID. Without it, Publish returns once the
+	// server has received the message.
+	JetStream bool
+}
+
+// NATS publishes messages to a NATS server.
+type NATS struct {
+	conn   *nats.Conn
+	js     nats.JetStreamContext
+	prefix string
+}
+
+// NewNATS connects to a NATS server.
+func NewNATS(config NATSConfig) (*NATS, error) {
+	conn, err := nats.Connect(config.URL, nats.Name("user-service outbox"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, fmt.Errorf("connecting to NATS: %w", err)
+	}
+	n := &NATS{conn: conn, prefix: config.SubjectPrefix}
+	if config.JetStream {
+		if n.js, err = conn.JetStream(); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("opening JetStream: %w", err)
+		}
+	}
+	return n, nil
+}
+
+func (n *NATS) Publish(ctx context.Context, msg Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	m := nats.NewMsg(n.subject(msg.Type))
+	m.Data = data
+	m.Header.Set(nats.MsgIdHdr, msg.ID)
+	m.Header.Set(headerFileID, msg.FileID)
+	m.Header.Set(headerSequence, strconv.FormatInt(msg.Sequence, 10))
+
+	if n.js != nil {
+		_, err := n.js.PublishMsg(m, nats.Context(ctx))
+		return err
+	}
+	if err := n.conn.PublishMsg(m); err != nil {
+		return err
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		// Flushing needs a deadline to give up on an unresponsive server
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, publishTimeout)
+		defer cancel()
+	}
+	return n.conn.FlushWithContext(ctx)
+}
+
+func (n *NATS) subject(eventType string) string {
+	if n.prefix == "" {
+		return eventType
+	}
+	return n.prefix + "." + eventType
+}
+
+// Close drains the connection.
+func (n *NATS) Close() error {
+	return n.conn.Drain()
+}
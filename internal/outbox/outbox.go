@@ -0,0 +1,64 @@
+// Package outbox publishes domain events recorded in the outbox collection
+// to other services. Each message carries a deduplication ID, which stays
+// the same when a message is published again, and a sequence number that
+// orders the events of one file.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Message is a published event.
+type Message struct {
+	// ID is unique per event; consumers drop messages they have seen.
+	ID     string `json:"id"`
+	Type   string `json:"type"`
+	FileID string `json:"file_id"`
+	UserID uint   `json:"user_id"`
+
+	// Sequence numbers the events of one file from 1 without gaps.
+	Sequence int64           `json:"sequence"`
+	Time     time.Time       `json:"time"`
+	Data     json.RawMessage `json:"data"`
+}
+
+// Publisher sends messages to consumers. Publish returns once the message
+// has been accepted; a message whose Publish fails is published again, so
+// publishers deliver each message at least once.
+type Publisher interface {
+	Publish(ctx context.Context, msg Message) error
+	Close() error
+}
+
+// Channel publishes messages to an in-process channel, for consumers in the
+// same process. Publish blocks while the channel is full.
+type Channel struct {
+	messages chan Message
+}
+
+// NewChannel returns a Channel that buffers up to size messages.
+func NewChannel(size int) *Channel {
+	return &Channel{messages: make(chan Message, size)}
+}
+
+func (c *Channel) Publish(ctx context.Context, msg Message) error {
+	select {
+	case c.messages <- msg:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Messages returns the channel messages are published to.
+func (c *Channel) Messages() <-chan Message {
+	return c.messages
+}
+
+// Close closes the channel. Publish must not be called after Close.
+func (c *Channel) Close() error {
+	close(c.messages)
+	return nil
+}
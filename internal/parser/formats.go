@@ -0,0 +1,272 @@
+package parser
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"user-service/internal/logtime"
+)
+
+var (
+	errNotJSONObject = errors.New("line is not a JSON object")
+	errNotLogfmt     = errors.New("line is not logfmt")
+	errNotSyslog     = errors.New("line is not syslog")
+	errNotCombined   = errors.New("line is not a combined access log entry")
+	errFieldCount    = errors.New("field count does not match header")
+)
+
+// jsonParser parses JSON Lines.
+type jsonParser struct{}
+
+func (jsonParser) Parse(line string) (Record, error) {
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(line), &fields); err != nil {
+		return Record{}, errNotJSONObject
+	}
+	return fromFields(fields), nil
+}
+
+// logfmtParser parses key=value pairs, with double-quoted values allowed.
+type logfmtParser struct{}
+
+var logfmtPair = regexp.MustCompile(`^([A-Za-z_][\w.\-]*)=("(?:[^"\\]|\\.)*"|\S*)`)
+
+func (logfmtParser) Parse(line string) (Record, error) {
+	fields := make(map[string]any)
+	rest := strings.TrimSpace(line)
+	for rest != "" {
+		match := logfmtPair.FindStringSubmatch(rest)
+		if match == nil {
+			return Record{}, errNotLogfmt
+		}
+		value := match[2]
+		if strings.HasPrefix(value, `"`) {
+			if unquoted, err := strconv.Unquote(value); err == nil {
+				value = unquoted
+			}
+		}
+		fields[match[1]] = value
+		rest = strings.TrimLeft(rest[len(match[0]):], " \t")
+	}
+	if len(fields) == 0 {
+		return Record{}, errNotLogfmt
+	}
+	return fromFields(fields), nil
+}
+
+// syslog5424Parser parses RFC 5424 syslog lines.
+type syslog5424Parser struct{}
+
+var syslog5424Line = regexp.MustCompile(`^<(\d{1,3})>\d{1,2} (\S+) (\S+) (\S+) (\S+) (\S+) (-|(?:\[(?:[^\]\\]|\\.)*\])+)(?: (.*))?$`)
+
+func (syslog5424Parser) Parse(line string) (Record, error) {
+	match := syslog5424Line.FindStringSubmatch(line)
+	if match == nil {
+		return Record{}, errNotSyslog
+	}
+
+	record := Record{
+		Level:   severityLevel(match[1]),
+		Source:  nilValue(match[4]),
+		Message: strings.TrimPrefix(match[8], "\ufeff"),
+		Fields:  map[string]any{"facility": facility(match[1])},
+	}
+	if t, ok := logtime.Parse(match[2]); ok {
+		t = t.UTC()
+		record.Timestamp = &t
+	}
+	for key, value := range map[string]string{"host": match[3], "proc_id": match[5], "msg_id": match[6], "structured_data": match[7]} {
+		if value = nilValue(value); value != "" {
+			record.Fields[key] = value
+		}
+	}
+	return record, nil
+}
+
+// syslog3164Parser parses BSD (RFC 3164) syslog lines.
+type syslog3164Parser struct{}
+
+var syslog3164Line = regexp.MustCompile(`^(?:<(\d{1,3})>)?([A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2}) (\S+) ([^:\[\s]+)(?:\[(\d+)\])?:? ?(.*)$`)
+
+func (syslog3164Parser) Parse(line string) (Record, error) {
+	match := syslog3164Line.FindStringSubmatch(line)
+	if match == nil {
+		return Record{}, errNotSyslog
+	}
+
+	record := Record{
+		Source:  match[4],
+		Message: match[6],
+		Fields:  map[string]any{"host": match[3]},
+	}
+	if match[1] != "" {
+		record.Level = severityLevel(match[1])
+		record.Fields["facility"] = facility(match[1])
+	} else {
+		record.Level = findLevel(match[6])
+	}
+	if match[5] != "" {
+		record.Fields["pid"] = match[5]
+	}
+	if t, ok := logtime.Extract(match[2]); ok {
+		record.Timestamp = &t
+	}
+	return record, nil
+}
+
+// combinedParser parses Apache/nginx common and combined access logs.
+type combinedParser struct{}
+
+var combinedLine = regexp.MustCompile(`^(\S+) (\S+) (\S+) \[([^\]]+)\] "([^"]*)" (\d{3}) (\d+|-)(?: "([^"]*)" "([^"]*)")?`)
+
+func (combinedParser) Parse(line string) (Record, error) {
+	match := combinedLine.FindStringSubmatch(line)
+	if match == nil {
+		return Record{}, errNotCombined
+	}
+
+	status, _ := strconv.Atoi(match[6])
+	record := Record{
+		Message: match[5],
+		Source:  match[1],
+		Fields:  map[string]any{"remote_addr": match[1], "status": status},
+	}
+	switch {
+	case status >= 500:
+		record.Level = LevelError
+	case status >= 400:
+		record.Level = LevelWarn
+	default:
+		record.Level = LevelInfo
+	}
+	if t, err := time.Parse("02/Jan/2006:15:04:05 -0700", match[4]); err == nil {
+		t = t.UTC()
+		record.Timestamp = &t
+	}
+	if user := nilValue(match[3]); user != "" {
+		record.Fields["user"] = user
+	}
+	if bytes, err := strconv.ParseInt(match[7], 10, 64); err == nil {
+		record.Fields["bytes"] = bytes
+	}
+	if parts := strings.Fields(match[5]); len(parts) == 3 {
+		record.Fields["method"], record.Fields["path"], record.Fields["protocol"] = parts[0], parts[1], parts[2]
+	}
+	if referer := nilValue(match[8]); referer != "" {
+		record.Fields["referer"] = referer
+	}
+	if match[9] != "" {
+		record.Fields["user_agent"] = match[9]
+	}
+	return record, nil
+}
+
+// delimitedParser parses CSV and TSV. The first line is taken as the header.
+type delimitedParser struct {
+	sep    rune
+	header []string
+}
+
+func (p *delimitedParser) Parse(line string) (Record, error) {
+	reader := csv.NewReader(strings.NewReader(line))
+	reader.Comma = p.sep
+	reader.LazyQuotes = true
+	reader.FieldsPerRecord = -1
+	values, err := reader.Read()
+	if err != nil {
+		return Record{}, err
+	}
+
+	if p.header == nil {
+		p.header = values
+		return Record{}, ErrSkip
+	}
+	if len(values) != len(p.header) {
+		return Record{}, errFieldCount
+	}
+
+	fields := make(map[string]any, len(values))
+	for i, name := range p.header {
+		fields[strings.ToLower(strings.TrimSpace(name))] = values[i]
+	}
+	return fromFields(fields), nil
+}
+
+// textParser extracts what it can from unstructured lines with regular
+// expressions. It never fails.
+type textParser struct{}
+
+var (
+	levelToken  = regexp.MustCompile(`(?i)\b(TRACE|DEBUG|INFO|NOTICE|WARN(?:ING)?|ERROR|ERR|FATAL|CRIT(?:ICAL)?|PANIC|SEVERE)\b`)
+	sourceToken = regexp.MustCompile(`^\s*[\[(]([\w.\-:/]+)[\])]`)
+)
+
+func (textParser) Parse(line string) (Record, error) {
+	record := Record{Message: line}
+	if t, ok := logtime.Extract(line); ok {
+		t = t.UTC()
+		record.Timestamp = &t
+	}
+
+	// "2024-01-01 10:00:00 ERROR [db] connection lost" keeps "connection lost"
+	// as the message when an upper-case level token appears near the start
+	if loc := levelToken.FindStringSubmatchIndex(line); loc != nil && loc[0] < 64 {
+		token := line[loc[2]:loc[3]]
+		record.Level = NormalizeLevel(token)
+		if token != strings.ToUpper(token) {
+			return record, nil
+		}
+		rest := strings.TrimLeft(line[loc[1]:], " :|-]")
+		if match := sourceToken.FindStringSubmatch(rest); match != nil {
+			record.Source = match[1]
+			rest = strings.TrimLeft(rest[len(match[0]):], " :|-")
+		}
+		if rest != "" {
+			record.Message = rest
+		}
+	}
+	return record, nil
+}
+
+// findLevel looks for a level keyword in free text.
+func findLevel(text string) string {
+	if match := levelToken.FindStringSubmatch(text); match != nil {
+		return NormalizeLevel(match[1])
+	}
+	return ""
+}
+
+// severityLevel maps a syslog PRI value onto a normalized level.
+func severityLevel(pri string) string {
+	n, err := strconv.Atoi(pri)
+	if err != nil {
+		return ""
+	}
+	switch severity := n % 8; {
+	case severity <= 3:
+		return LevelError
+	case severity == 4:
+		return LevelWarn
+	case severity <= 6:
+		return LevelInfo
+	default:
+		return LevelDebug
+	}
+}
+
+func facility(pri string) int {
+	n, _ := strconv.Atoi(pri)
+	return n / 8
+}
+
+// nilValue maps the "-" placeholder used by syslog and access logs to "".
+func nilValue(value string) string {
+	if value == "-" {
+		return ""
+	}
+	return value
+}
@@ -0,0 +1,181 @@
+// Package parser turns log lines into normalized records. Each supported
+// format has its own Parser; lines that fail to parse in their file's format
+// fall back to regex-based extraction so no line is lost.
+package parser
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+	"user-service/internal/logtime"
+	"user-service/internal/models"
+)
+
+// Normalized levels.
+const (
+	LevelError = "error"
+	LevelWarn  = "warn"
+	LevelInfo  = "info"
+	LevelDebug = "debug"
+)
+
+// Record is a normalized log record.
+type Record struct {
+	Line      int64          `json:"line"`
+	Timestamp *time.Time     `json:"timestamp,omitempty"`
+	Level     string         `json:"level,omitempty"`
+	Message   string         `json:"message"`
+	Source    string         `json:"source,omitempty"`
+	Fields    map[string]any `json:"fields,omitempty"`
+
+	// Raw is the original line.
+	Raw string `json:"-"`
+
+	// Offset and Length locate the line in the file, including its line
+	// ending.
+	Offset int64 `json:"-"`
+	Length int64 `json:"-"`
+}
+
+// Parser parses single lines of one format. Parsers may keep state between
+// lines, such as a CSV header, so each stream needs its own Parser.
+type Parser interface {
+	Parse(line string) (Record, error)
+}
+
+// New returns a parser for the given format. Unknown formats are parsed as
+// plain text.
+func New(format models.LogFormat) Parser {
+	switch format {
+	case models.LogFormatJSONLines:
+		return jsonParser{}
+	case models.LogFormatLogfmt:
+		return logfmtParser{}
+	case models.LogFormatSyslog5424:
+		return syslog5424Parser{}
+	case models.LogFormatSyslog3164:
+		return syslog3164Parser{}
+	case models.LogFormatCombined:
+		return combinedParser{}
+	case models.LogFormatCSV:
+		return &delimitedParser{sep: ','}
+	case models.LogFormatTSV:
+		return &delimitedParser{sep: '\t'}
+	default:
+		return textParser{}
+	}
+}
+
+// NormalizeLevel maps the many spellings of log levels onto error, warn, info
+// and debug. Unknown levels return "".
+func NormalizeLevel(level string) string {
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "error", "err", "fatal", "crit", "critical", "panic", "emerg", "emergency", "alert", "severe":
+		return LevelError
+	case "warn", "warning":
+		return LevelWarn
+	case "info", "information", "informational", "notice":
+		return LevelInfo
+	case "debug", "trace", "verbose", "fine", "finer", "finest":
+		return LevelDebug
+	}
+	return ""
+}
+
+// Well-known keys for structured formats, in order of preference.
+var (
+	timestampKeys = []string{"timestamp", "time", "ts", "@timestamp", "datetime", "date", "t"}
+	levelKeys     = []string{"level", "severity", "lvl", "loglevel", "log.level", "levelname"}
+	messageKeys   = []string{"message", "msg", "log", "text", "event"}
+	sourceKeys    = []string{"source", "logger", "service", "component", "app", "module", "caller"}
+)
+
+// fromFields fills a record from a map of structured fields, moving the
+// well-known keys into the record and leaving the rest in Fields.
+func fromFields(fields map[string]any) Record {
+	var record Record
+
+	if key, value := take(fields, timestampKeys); key != "" {
+		if t, ok := parseTimeValue(value); ok {
+			record.Timestamp = &t
+		} else {
+			fields[key] = value
+		}
+	}
+	if _, value := take(fields, levelKeys); value != nil {
+		record.Level = NormalizeLevel(stringValue(value))
+	}
+	if _, value := take(fields, messageKeys); value != nil {
+		record.Message = stringValue(value)
+	}
+	if _, value := take(fields, sourceKeys); value != nil {
+		record.Source = stringValue(value)
+	}
+
+	if len(fields) > 0 {
+		record.Fields = fields
+	}
+	return record
+}
+
+// take removes and returns the first of keys present in fields.
+func take(fields map[string]any, keys []string) (string, any) {
+	for _, key := range keys {
+		if value, ok := fields[key]; ok {
+			delete(fields, key)
+			return key, value
+		}
+	}
+	return "", nil
+}
+
+// parseTimeValue parses timestamps given as strings or as Unix epochs in
+// seconds, milliseconds, microseconds or nanoseconds.
+func parseTimeValue(value any) (time.Time, bool) {
+	var epoch float64
+	switch v := value.(type) {
+	case string:
+		if t, ok := logtime.Parse(v); ok {
+			return t.UTC(), true
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+		epoch = f
+	case float64:
+		epoch = v
+	default:
+		return time.Time{}, false
+	}
+
+	switch {
+	case epoch > 1e17:
+		return time.Unix(0, int64(epoch)).UTC(), true
+	case epoch > 1e14:
+		return time.UnixMicro(int64(epoch)).UTC(), true
+	case epoch > 1e11:
+		return time.UnixMilli(int64(epoch)).UTC(), true
+	case epoch > 0:
+		sec := int64(epoch)
+		return time.Unix(sec, int64((epoch-float64(sec))*1e9)).UTC(), true
+	}
+	return time.Time{}, false
+}
+
+func stringValue(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		encoded, _ := json.Marshal(v)
+		return string(encoded)
+	}
+}
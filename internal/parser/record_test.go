@@ -0,0 +1,41 @@
+package parser
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimeValue(t *testing.T) {
+	want := time.Date(2024, 3, 20, 10, 30, 45, 123456789, time.UTC)
+	tests := []struct {
+		name      string
+		value     any
+		want      time.Time
+		precision time.Duration
+	}{
+		{"seconds", float64(1710930645), want.Truncate(time.Second), 0},
+		{"fractional seconds", 1710930645.123, want.Truncate(time.Millisecond), time.Microsecond},
+		{"milliseconds", float64(1710930645123), want.Truncate(time.Millisecond), 0},
+		{"microseconds", float64(1710930645123456), want.Truncate(time.Microsecond), 0},
+		{"nanoseconds", float64(1710930645123456789), want, time.Microsecond},
+		{"string milliseconds", "1710930645123", want.Truncate(time.Millisecond), 0},
+		{"string microseconds", "1710930645123456", want.Truncate(time.Microsecond), 0},
+		{"RFC 3339", "2024-03-20T10:30:45.123456789Z", want, 0},
+	}
+	for _, tt := range tests {
+		got, ok := parseTimeValue(tt.value)
+		if !ok {
+			t.Errorf("%s: %v not parsed", tt.name, tt.value)
+			continue
+		}
+		if diff := got.Sub(tt.want).Abs(); diff > tt.precision {
+			t.Errorf("%s: parseTimeValue(%v) = %v, want %v", tt.name, tt.value, got, tt.want)
+		}
+	}
+
+	for _, value := range []any{float64(0), float64(-5), "not a time", true, nil} {
+		if got, ok := parseTimeValue(value); ok {
+			t.Errorf("parseTimeValue(%v) = %v, want no time", value, got)
+		}
+	}
+}
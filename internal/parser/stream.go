@@ -0,0 +1,170 @@
+package parser
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"user-service/internal/models"
+	"user-service/pkg/storage"
+)
+
+// ErrSkip is returned by parsers for lines that carry no record, such as a
+// CSV header.
+var ErrSkip = errors.New("line skipped")
+
+const (
+	// MaxLineLength is the longest line kept in memory. Longer lines are
+	// truncated and counted as failures.
+	MaxLineLength = 1 << 20
+
+	// maxFailureSamples is the number of failed lines kept in ParseStats.
+	maxFailureSamples = 10
+
+	// maxSampleText caps the text stored for each failed line.
+	maxSampleText = 200
+)
+
+// Stream parses r line by line in the given format and calls fn for each
+// record. Lines that fail to parse are counted and sampled, then passed to fn
+// as plain-text records so that callers see every line. Memory use is bounded
+// by MaxLineLength regardless of the size of r. Returning an error from fn
+// stops the stream.
+func Stream(ctx context.Context, r io.Reader, format models.LogFormat, fn func(Record) error) (*models.ParseStats, error) {
+	scanner := NewScanner(r, format)
+	for {
+		record, err := scanner.Next(ctx)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return scanner.Stats(), err
+		}
+		if err := fn(record); err != nil {
+			return scanner.Stats(), err
+		}
+	}
+	return scanner.Stats(), nil
+}
+
+// Scanner parses r one record at a time, for callers that pull records from
+// several streams at once. It applies the same rules as Stream.
+type Scanner struct {
+	reader   *bufio.Reader
+	parser   Parser
+	fallback textParser
+	stats    *models.ParseStats
+
+	lineNumber, offset int64
+	done               bool
+}
+
+func NewScanner(r io.Reader, format models.LogFormat) *Scanner {
+	return &Scanner{
+		reader: bufio.NewReaderSize(r, 64*1024),
+		parser: New(format),
+		stats:  &models.ParseStats{},
+	}
+}
+
+// Next returns the next record, or io.EOF when r is exhausted.
+func (s *Scanner) Next(ctx context.Context) (Record, error) {
+	for !s.done {
+		line, consumed, truncated, err := readLine(s.reader)
+		if err == io.EOF && line == "" {
+			break
+		}
+		if err != nil && err != io.EOF {
+			return Record{}, err
+		}
+		s.lineNumber++
+		offset := s.offset
+		s.offset += consumed
+		s.done = err == io.EOF
+
+		if s.lineNumber%10000 == 0 {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return Record{}, ctxErr
+			}
+		}
+
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		record, parseErr := s.parser.Parse(line)
+		if truncated {
+			parseErr = fmt.Errorf("line exceeds %d bytes", MaxLineLength)
+		}
+		if parseErr == ErrSkip {
+			continue
+		}
+		if parseErr != nil {
+			s.stats.Failed++
+			if len(s.stats.Samples) < maxFailureSamples {
+				s.stats.Samples = append(s.stats.Samples, models.ParseFailure{
+					Line:  s.lineNumber,
+					Text:  truncate(line, maxSampleText),
+					Error: parseErr.Error(),
+				})
+			}
+			record, _ = s.fallback.Parse(line)
+		} else {
+			s.stats.Parsed++
+		}
+
+		record.Line = s.lineNumber
+		record.Raw = line
+		record.Offset, record.Length = offset, consumed
+		return record, nil
+	}
+	s.done = true
+	return Record{}, io.EOF
+}
+
+// Stats returns the parse statistics of the records returned so far.
+func (s *Scanner) Stats() *models.ParseStats {
+	return s.stats
+}
+
+// StreamFile parses a stored file, streaming it from the storage backend.
+func StreamFile(ctx context.Context, store storage.Storage, storageKey string, format models.LogFormat, fn func(Record) error) (*models.ParseStats, error) {
+	reader, err := store.DownloadFile(ctx, storageKey)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return Stream(ctx, reader, format, fn)
+}
+
+// readLine reads one line without its line ending and reports how many bytes
+// it consumed. Lines longer than MaxLineLength are truncated and the rest of
+// the line is discarded.
+func readLine(reader *bufio.Reader) (string, int64, bool, error) {
+	var line []byte
+	var consumed int64
+	truncated := false
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		consumed += int64(len(chunk))
+		if !truncated {
+			if room := MaxLineLength - len(line); len(chunk) > room {
+				chunk, truncated = chunk[:room], true
+			}
+			line = append(line, chunk...)
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		return strings.TrimRight(string(line), "\r\n"), consumed, truncated, err
+	}
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
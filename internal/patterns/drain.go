@@ -0,0 +1,263 @@
+// Package patterns mines message templates from log lines with the Drain
+// algorithm (He et al., "Drain: An Online Log Parsing Approach with Fixed
+// Depth Tree", ICWS 2017). Lines are routed through a fixed-depth tree by
+// token count and leading tokens, then joined to the most similar template
+// in the leaf, whose differing tokens become wildcards.
+//
+// The miner is deterministic: the same lines in the same order always give
+// the same templates, counts and examples.
+package patterns
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"user-service/internal/models"
+)
+
+// Wildcard replaces the variable tokens of a template.
+const Wildcard = "<*>"
+
+// Config tunes the miner. Zero values select the defaults.
+type Config struct {
+	// Depth is the depth of the parse tree, counting the root, length and
+	// leaf layers, so Depth-3 leading tokens are used for routing. Default 4.
+	Depth int
+
+	// Similarity is the share of tokens a line must have in common with a
+	// template to join it. Default 0.4.
+	Similarity float64
+
+	// MaxChildren caps the children of a tree node; further tokens route to
+	// the wildcard child. Default 100.
+	MaxChildren int
+
+	// MaxClusters caps the number of templates. Lines that would start a new
+	// template beyond it are counted as unmatched. Default 5000.
+	MaxClusters int
+
+	// MaxTokens caps the tokens of a message; the rest are ignored.
+	// Default 100.
+	MaxTokens int
+
+	// Examples is the number of example lines kept per template. Default 3.
+	Examples int
+}
+
+const maxExampleLength = 500
+
+// variablePatterns mask tokens that are almost always variables before a
+// line is matched, which keeps such values from splitting templates.
+var variablePatterns = []*regexp.Regexp{
+	regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`),
+	regexp.MustCompile(`^\d{1,3}(\.\d{1,3}){3}(:\d+)?$`),
+	regexp.MustCompile(`^(0x)?[0-9a-fA-F]{8,}$`),
+	regexp.MustCompile(`^[-+]?\d+(\.\d+)?[a-zA-Z%]{0,3}$`),
+}
+
+type cluster struct {
+	id        int
+	template  []string
+	count     int64
+	examples  []string
+	firstSeen *time.Time
+	lastSeen  *time.Time
+}
+
+type node struct {
+	children map[string]*node
+	clusters []*cluster
+}
+
+// Miner clusters lines into templates. It is not safe for concurrent use.
+type Miner struct {
+	config    Config
+	root      *node
+	clusters  []*cluster
+	lines     int64
+	unmatched int64
+}
+
+// NewMiner returns a Miner with the given configuration.
+func NewMiner(config Config) *Miner {
+	if config.Depth < 3 {
+		config.Depth = 4
+	}
+	if config.Similarity <= 0 {
+		config.Similarity = 0.4
+	}
+	if config.MaxChildren <= 0 {
+		config.MaxChildren = 100
+	}
+	if config.MaxClusters <= 0 {
+		config.MaxClusters = 5000
+	}
+	if config.MaxTokens <= 0 {
+		config.MaxTokens = 100
+	}
+	if config.Examples <= 0 {
+		config.Examples = 3
+	}
+	return &Miner{config: config, root: &node{children: make(map[string]*node)}}
+}
+
+// Add mines one message. example is the line shown as an example of its
+// template and timestamp, when known, updates the template's first and last
+// seen times.
+func (m *Miner) Add(message, example string, timestamp *time.Time) {
+	tokens := Tokenize(message, m.config.MaxTokens)
+	if len(tokens) == 0 {
+		return
+	}
+	m.lines++
+
+	leaf := m.route(tokens)
+	c := m.match(leaf, tokens)
+	if c == nil {
+		if len(m.clusters) >= m.config.MaxClusters {
+			m.unmatched++
+			return
+		}
+		c = &cluster{id: len(m.clusters), template: append([]string(nil), tokens...)}
+		m.clusters = append(m.clusters, c)
+		leaf.clusters = append(leaf.clusters, c)
+	} else {
+		for i, token := range tokens {
+			if c.template[i] != token {
+				c.template[i] = Wildcard
+			}
+		}
+	}
+
+	c.count++
+	if len(c.examples) < m.config.Examples {
+		if len(example) > maxExampleLength {
+			example = strings.ToValidUTF8(example[:maxExampleLength], "")
+		}
+		c.examples = append(c.examples, example)
+	}
+	if timestamp != nil {
+		if c.firstSeen == nil || timestamp.Before(*c.firstSeen) {
+			c.firstSeen = timestamp
+		}
+		if c.lastSeen == nil || timestamp.After(*c.lastSeen) {
+			c.lastSeen = timestamp
+		}
+	}
+}
+
+// route walks the tree by token count and leading tokens, creating nodes as
+// needed, and returns the leaf for the line.
+func (m *Miner) route(tokens []string) *node {
+	current := m.child(m.root, strconv.Itoa(len(tokens)), true)
+	for depth := 0; depth < m.config.Depth-3 && depth < len(tokens); depth++ {
+		key := tokens[depth]
+		if hasDigit(key) {
+			key = Wildcard
+		}
+		current = m.child(current, key, false)
+	}
+	return current
+}
+
+// child returns the child of n for key. Once a node is full, unseen keys
+// share its wildcard child.
+func (m *Miner) child(n *node, key string, unbounded bool) *node {
+	if next, ok := n.children[key]; ok {
+		return next
+	}
+	if !unbounded && len(n.children) >= m.config.MaxChildren {
+		key = Wildcard
+		if next, ok := n.children[key]; ok {
+			return next
+		}
+	}
+	next := &node{children: make(map[string]*node)}
+	n.children[key] = next
+	return next
+}
+
+// match returns the most similar cluster in the leaf, or nil when none is
+// similar enough. Ties go to the template with more wildcards, then to the
+// older template.
+func (m *Miner) match(leaf *node, tokens []string) *cluster {
+	var best *cluster
+	bestSimilarity, bestWildcards := -1.0, -1
+	for _, c := range leaf.clusters {
+		same, wildcards := 0, 0
+		for i, token := range c.template {
+			switch token {
+			case Wildcard:
+				wildcards++
+			case tokens[i]:
+				same++
+			}
+		}
+		similarity := float64(same) / float64(len(tokens))
+		if similarity > bestSimilarity || (similarity == bestSimilarity && wildcards > bestWildcards) {
+			best, bestSimilarity, bestWildcards = c, similarity, wildcards
+		}
+	}
+	if best == nil || bestSimilarity < m.config.Similarity {
+		return nil
+	}
+	return best
+}
+
+// Result returns the top templates by count, ties broken by first
+// appearance.
+func (m *Miner) Result(top int) *models.FilePatterns {
+	sorted := append([]*cluster(nil), m.clusters...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].count != sorted[j].count {
+			return sorted[i].count > sorted[j].count
+		}
+		return sorted[i].id < sorted[j].id
+	})
+	if len(sorted) > top {
+		sorted = sorted[:top]
+	}
+
+	result := &models.FilePatterns{
+		TotalLines:    m.lines,
+		TemplateCount: len(m.clusters),
+		Unmatched:     m.unmatched,
+		Patterns:      make([]models.LogPattern, 0, len(sorted)),
+	}
+	for _, c := range sorted {
+		result.Patterns = append(result.Patterns, models.LogPattern{
+			Template:  strings.Join(c.template, " "),
+			Count:     c.count,
+			Examples:  c.examples,
+			FirstSeen: c.firstSeen,
+			LastSeen:  c.lastSeen,
+		})
+	}
+	return result
+}
+
+// Tokenize splits a message on whitespace and masks tokens that look like
+// numbers, IP addresses, UUIDs or hex identifiers.
+func Tokenize(message string, maxTokens int) []string {
+	tokens := strings.Fields(message)
+	if len(tokens) > maxTokens {
+		tokens = tokens[:maxTokens]
+	}
+	for i, token := range tokens {
+		trimmed := strings.TrimRight(token, ",;:.")
+		for _, pattern := range variablePatterns {
+			if pattern.MatchString(trimmed) {
+				tokens[i] = Wildcard
+				break
+			}
+		}
+	}
+	return tokens
+}
+
+func hasDigit(s string) bool {
+	return strings.IndexFunc(s, unicode.IsDigit) >= 0
+}
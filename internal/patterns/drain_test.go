@@ -0,0 +1,231 @@
+package patterns
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"user-service/internal/models"
+)
+
+// mineFixture mines a file under testdata whose lines start with an RFC 3339
+// timestamp, as the analysis pipeline does: the message is mined, the whole
+// line kept as the example.
+func mineFixture(t *testing.T, name string, config Config, top int) *models.FilePatterns {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	miner := NewMiner(config)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		var timestamp *time.Time
+		message := line
+		if prefix, rest, found := strings.Cut(line, " "); found {
+			if parsed, err := time.Parse(time.RFC3339, prefix); err == nil {
+				timestamp, message = &parsed, rest
+			}
+		}
+		miner.Add(message, line, timestamp)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return miner.Result(top)
+}
+
+func at(value string) *time.Time {
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		panic(err)
+	}
+	return &parsed
+}
+
+func TestMinerResult(t *testing.T) {
+	tests := []struct {
+		name    string
+		fixture string
+		config  Config
+		top     int
+		want    *models.FilePatterns
+	}{
+		{
+			name:    "templates, counts, examples and seen times",
+			fixture: "auth.log",
+			top:     10,
+			want: &models.FilePatterns{
+				TotalLines:    6,
+				TemplateCount: 2,
+				Patterns: []models.LogPattern{
+					{
+						Template: "User <*> logged in from <*>",
+						Count:    4,
+						Examples: []string{
+							"2024-03-20T10:00:05Z User alice logged in from 10.0.0.1",
+							"2024-03-20T10:00:00Z User bob logged in from 10.0.0.2",
+							"2024-03-20T10:02:00Z User carol logged in from 10.0.0.3",
+						},
+						// Seen times are the earliest and latest timestamps,
+						// not those of the first and last lines
+						FirstSeen: at("2024-03-20T10:00:00Z"),
+						LastSeen:  at("2024-03-20T10:04:00Z"),
+					},
+					{
+						Template: "Connection timeout after <*> to <*>",
+						Count:    2,
+						Examples: []string{
+							"2024-03-20T10:01:00Z Connection timeout after 30s to db-primary",
+							"2024-03-20T10:03:00Z Connection timeout after 45s to db-replica",
+						},
+						FirstSeen: at("2024-03-20T10:01:00Z"),
+						LastSeen:  at("2024-03-20T10:03:00Z"),
+					},
+				},
+			},
+		},
+		{
+			name:    "example limit",
+			fixture: "auth.log",
+			config:  Config{Examples: 1},
+			top:     1,
+			want: &models.FilePatterns{
+				TotalLines:    6,
+				TemplateCount: 2,
+				Patterns: []models.LogPattern{
+					{
+						Template:  "User <*> logged in from <*>",
+						Count:     4,
+						Examples:  []string{"2024-03-20T10:00:05Z User alice logged in from 10.0.0.1"},
+						FirstSeen: at("2024-03-20T10:00:00Z"),
+						LastSeen:  at("2024-03-20T10:04:00Z"),
+					},
+				},
+			},
+		},
+		{
+			name:    "tied counts keep order of first appearance",
+			fixture: "ties.log",
+			top:     10,
+			want: &models.FilePatterns{
+				TotalLines:    6,
+				TemplateCount: 3,
+				Patterns: []models.LogPattern{
+					{
+						Template: "Starting scheduler",
+						Count:    2,
+						Examples: []string{
+							"2024-03-20T09:00:00Z Starting scheduler",
+							"2024-03-20T09:00:05Z Starting scheduler",
+						},
+						FirstSeen: at("2024-03-20T09:00:00Z"),
+						LastSeen:  at("2024-03-20T09:00:05Z"),
+					},
+					{
+						Template: "Cache miss for key <*>",
+						Count:    2,
+						Examples: []string{
+							"2024-03-20T09:00:01Z Cache miss for key users",
+							"2024-03-20T09:00:02Z Cache miss for key orders",
+						},
+						FirstSeen: at("2024-03-20T09:00:01Z"),
+						LastSeen:  at("2024-03-20T09:00:02Z"),
+					},
+					{
+						Template: "Job finished status <*>",
+						Count:    2,
+						Examples: []string{
+							"2024-03-20T09:00:03Z Job finished status ok",
+							"2024-03-20T09:00:04Z Job finished status failed",
+						},
+						FirstSeen: at("2024-03-20T09:00:03Z"),
+						LastSeen:  at("2024-03-20T09:00:04Z"),
+					},
+				},
+			},
+		},
+		{
+			name:    "top cuts tied templates in order of first appearance",
+			fixture: "ties.log",
+			top:     2,
+			want: &models.FilePatterns{
+				TotalLines:    6,
+				TemplateCount: 3,
+				Patterns: []models.LogPattern{
+					{
+						Template: "Starting scheduler",
+						Count:    2,
+						Examples: []string{
+							"2024-03-20T09:00:00Z Starting scheduler",
+							"2024-03-20T09:00:05Z Starting scheduler",
+						},
+						FirstSeen: at("2024-03-20T09:00:00Z"),
+						LastSeen:  at("2024-03-20T09:00:05Z"),
+					},
+					{
+						Template: "Cache miss for key <*>",
+						Count:    2,
+						Examples: []string{
+							"2024-03-20T09:00:01Z Cache miss for key users",
+							"2024-03-20T09:00:02Z Cache miss for key orders",
+						},
+						FirstSeen: at("2024-03-20T09:00:01Z"),
+						LastSeen:  at("2024-03-20T09:00:02Z"),
+					},
+				},
+			},
+		},
+		{
+			name:    "lines beyond the template limit are unmatched",
+			fixture: "ties.log",
+			config:  Config{MaxClusters: 1},
+			top:     10,
+			want: &models.FilePatterns{
+				TotalLines:    6,
+				TemplateCount: 1,
+				Unmatched:     4,
+				Patterns: []models.LogPattern{
+					{
+						Template: "Starting scheduler",
+						Count:    2,
+						Examples: []string{
+							"2024-03-20T09:00:00Z Starting scheduler",
+							"2024-03-20T09:00:05Z Starting scheduler",
+						},
+						FirstSeen: at("2024-03-20T09:00:00Z"),
+						LastSeen:  at("2024-03-20T09:00:05Z"),
+					},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mineFixture(t, tt.fixture, tt.config, tt.top)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Result(%d) =\n%+v\nwant\n%+v", tt.top, got, tt.want)
+			}
+
+			// Mining the same lines again gives the same result
+			if again := mineFixture(t, tt.fixture, tt.config, tt.top); !reflect.DeepEqual(again, got) {
+				t.Errorf("second run =\n%+v\nfirst run\n%+v", again, got)
+			}
+		})
+	}
+}
+
+func TestTokenizeMasksVariables(t *testing.T) {
+	got := Tokenize("request 7f3c9a2e-1b4d-4c8e-9f0a-2b3c4d5e6f70 from 192.168.1.20:8080 took 12ms, id 0xdeadbeef", 100)
+	want := []string{"request", Wildcard, "from", Wildcard, "took", Wildcard, "id", Wildcard}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Tokenize = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,243 @@
+// Package preview reads numbered lines from the start, end or middle of a
+// log file and decodes them to valid UTF-8 for display.
+package preview
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"unicode/utf8"
+	"user-service/internal/analysis"
+
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+const (
+	// MaxLineLength is the number of bytes of each line that are returned.
+	// Longer lines are cut and marked as truncated.
+	MaxLineLength = 16 * 1024
+
+	readBufferSize = 64 * 1024
+
+	// maxTailBytes bounds how far back a ranged tail read goes.
+	maxTailBytes = 8 << 20
+)
+
+// Line is a numbered line of a file. Numbers start at 1.
+type Line struct {
+	Number    int64  `json:"number"`
+	Text      string `json:"text"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+// RangeOpener opens length bytes of a file starting at offset.
+type RangeOpener func(ctx context.Context, offset, length int64) (io.ReadCloser, error)
+
+// Range returns lines from through to of r, inclusive.
+func Range(ctx context.Context, r io.Reader, encoding string, from, to int64) ([]Line, error) {
+	var lines []Line
+	err := scan(ctx, r, encoding, func(line Line) bool {
+		if line.Number >= from {
+			lines = append(lines, line)
+		}
+		return line.Number < to
+	})
+	return lines, err
+}
+
+// Head returns the first n lines of r.
+func Head(ctx context.Context, r io.Reader, encoding string, n int64) ([]Line, error) {
+	return Range(ctx, r, encoding, 1, n)
+}
+
+// Tail returns the last n lines of r by reading all of it. TailRange is
+// preferred when the backend supports ranged reads.
+func Tail(ctx context.Context, r io.Reader, encoding string, n int64) ([]Line, error) {
+	ring := make([]Line, 0, n)
+	var next int
+	err := scan(ctx, r, encoding, func(line Line) bool {
+		if int64(len(ring)) < n {
+			ring = append(ring, line)
+		} else {
+			ring[next] = line
+			next = (next + 1) % len(ring)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append(ring[next:], ring[:next]...), nil
+}
+
+// TailRange returns the last n lines of a file of the given size by reading
+// backwards from its end in chunks. totalLines is the number of lines in the
+// file and is used to number the result. Encodings that are not
+// byte-oriented, such as UTF-16, must use Tail instead.
+func TailRange(ctx context.Context, open RangeOpener, size, totalLines int64, encoding string, n int64) ([]Line, error) {
+	var chunks [][]byte
+	var newlines int64
+	offset := size
+	for offset > 0 && size-offset < maxTailBytes {
+		start := max(0, offset-readBufferSize)
+		chunk, err := readRange(ctx, open, start, offset-start)
+		if err != nil {
+			return nil, err
+		}
+		// A newline ending the file closes the last line rather than
+		// starting another one
+		counted := chunk
+		if offset == size {
+			counted = bytes.TrimSuffix(counted, []byte("\n"))
+		}
+		newlines += int64(bytes.Count(counted, []byte("\n")))
+		chunks = append(chunks, chunk)
+		offset = start
+
+		// n newlines guarantee n complete lines after the first one
+		if newlines >= n {
+			break
+		}
+	}
+
+	var data []byte
+	for i := len(chunks) - 1; i >= 0; i-- {
+		data = append(data, chunks[i]...)
+	}
+	if len(data) == 0 {
+		return []Line{}, nil
+	}
+	data = bytes.TrimSuffix(data, []byte("\n"))
+
+	segments := bytes.Split(data, []byte("\n"))
+	partial := false
+	if offset > 0 {
+		if int64(len(segments)) > n {
+			segments = segments[1:]
+		} else {
+			// Gave up before reaching the start of the earliest line
+			partial = true
+		}
+	}
+	if int64(len(segments)) > n {
+		segments = segments[int64(len(segments))-n:]
+	}
+
+	lines := make([]Line, len(segments))
+	first := totalLines - int64(len(segments)) + 1
+	for i, segment := range segments {
+		lines[i] = decodeLine(first+int64(i), segment, encoding, len(segment) > MaxLineLength)
+	}
+	if partial && len(lines) > 0 {
+		lines[0].Truncated = true
+	}
+	return lines, nil
+}
+
+// Each calls fn with each line of r, numbering them from first, such as data
+// appended to a file whose earlier lines were already read. Returning an
+// error from fn stops the scan.
+func Each(ctx context.Context, r io.Reader, encoding string, first int64, fn func(Line) error) error {
+	var fnErr error
+	err := scan(ctx, r, encoding, func(line Line) bool {
+		line.Number += first - 1
+		fnErr = fn(line)
+		return fnErr == nil
+	})
+	if fnErr != nil {
+		return fnErr
+	}
+	return err
+}
+
+// Ranged reports whether TailRange can be used for the encoding.
+func Ranged(encoding string) bool {
+	return encoding != analysis.EncodingUTF16LE && encoding != analysis.EncodingUTF16BE
+}
+
+func readRange(ctx context.Context, open RangeOpener, offset, length int64) ([]byte, error) {
+	reader, err := open(ctx, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// scan calls fn with each line of r until fn returns false. Only the first
+// MaxLineLength bytes of each line are kept in memory.
+func scan(ctx context.Context, r io.Reader, encoding string, fn func(Line) bool) error {
+	if !Ranged(encoding) {
+		// UTF-16 is decoded to UTF-8 before splitting into lines
+		endianness := unicode.LittleEndian
+		if encoding == analysis.EncodingUTF16BE {
+			endianness = unicode.BigEndian
+		}
+		r = transform.NewReader(r, unicode.UTF16(endianness, unicode.UseBOM).NewDecoder())
+		encoding = analysis.EncodingUTF8
+	}
+
+	reader := bufio.NewReaderSize(r, readBufferSize)
+	var current []byte
+	truncated := false
+	var number int64
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if !truncated {
+			if room := MaxLineLength - len(current); len(chunk) > room {
+				chunk, truncated = chunk[:room], true
+			}
+			current = append(current, chunk...)
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if len(current) == 0 && err == io.EOF {
+			return nil
+		}
+
+		number++
+		if number%10000 == 0 {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+		}
+		if !fn(decodeLine(number, bytes.TrimSuffix(current, []byte("\n")), encoding, truncated)) || err == io.EOF {
+			return nil
+		}
+		current, truncated = current[:0], false
+	}
+}
+
+// decodeLine builds a Line from raw line bytes, cutting it at MaxLineLength.
+func decodeLine(number int64, raw []byte, encoding string, truncated bool) Line {
+	raw = bytes.TrimSuffix(raw, []byte("\r"))
+	if number == 1 {
+		raw = bytes.TrimPrefix(raw, []byte("\xef\xbb\xbf"))
+	}
+	if len(raw) > MaxLineLength {
+		raw, truncated = raw[:MaxLineLength], true
+	}
+	return Line{Number: number, Text: Decode(raw, encoding), Truncated: truncated}
+}
+
+// Decode converts raw bytes in the given encoding to valid UTF-8. ISO-8859-1
+// is mapped byte for byte and invalid sequences in other encodings are
+// replaced with U+FFFD.
+func Decode(raw []byte, encoding string) string {
+	if encoding != analysis.EncodingLatin1 {
+		return strings.ToValidUTF8(string(raw), string(utf8.RuneError))
+	}
+	var b strings.Builder
+	b.Grow(len(raw))
+	for _, c := range raw {
+		b.WriteRune(rune(c))
+	}
+	return b.String()
+}
@@ -0,0 +1,146 @@
+package redact
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+)
+
+// Detector finds one category of sensitive data in a line.
+type Detector interface {
+	// Category names what the detector finds, such as "email". It is used
+	// in reports and masks.
+	Category() string
+
+	// Find returns the [start, end) byte ranges of the matches in line.
+	Find(line []byte) [][]int
+}
+
+// regexDetector reports the matches of a regular expression, or of its
+// first capture group when it has one, that pass an optional check.
+type regexDetector struct {
+	category string
+	re       *regexp.Regexp
+	valid    func([]byte) bool
+}
+
+func (d *regexDetector) Category() string {
+	return d.category
+}
+
+func (d *regexDetector) Find(line []byte) [][]int {
+	var ranges [][]int
+	for _, match := range d.re.FindAllSubmatchIndex(line, -1) {
+		start, end := match[0], match[1]
+		if len(match) > 2 && match[2] >= 0 {
+			start, end = match[2], match[3]
+		}
+		if d.valid == nil || d.valid(line[start:end]) {
+			ranges = append(ranges, []int{start, end})
+		}
+	}
+	return ranges
+}
+
+// NewRegexDetector returns a detector for a custom category. When re has
+// capture groups only the first group is reported.
+func NewRegexDetector(category string, re *regexp.Regexp) Detector {
+	return &regexDetector{category: category, re: re}
+}
+
+// Built-in categories.
+const (
+	CategoryEmail       = "email"
+	CategoryIPAddress   = "ip_address"
+	CategoryCreditCard  = "credit_card"
+	CategoryBearerToken = "bearer_token"
+)
+
+var builtin = map[string]func() []Detector{
+	CategoryEmail: func() []Detector {
+		return []Detector{&regexDetector{
+			category: CategoryEmail,
+			re:       regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)*\.[A-Za-z]{2,}`),
+		}}
+	},
+	CategoryIPAddress: func() []Detector {
+		return []Detector{
+			&regexDetector{
+				category: CategoryIPAddress,
+				re:       regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)\.){3}(?:25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)\b`),
+			},
+			&regexDetector{
+				category: CategoryIPAddress,
+				re:       regexp.MustCompile(`(?:[0-9A-Fa-f]{1,4}:|::)[0-9A-Fa-f:]*:[0-9A-Fa-f]{0,4}`),
+				valid:    isIPv6,
+			},
+		}
+	},
+	CategoryCreditCard: func() []Detector {
+		return []Detector{&regexDetector{
+			category: CategoryCreditCard,
+			re:       regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`),
+			valid:    luhn,
+		}}
+	},
+	CategoryBearerToken: func() []Detector {
+		return []Detector{
+			&regexDetector{
+				category: CategoryBearerToken,
+				re:       regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9\-._~+/]+=*)`),
+			},
+			&regexDetector{
+				category: CategoryBearerToken,
+				re:       regexp.MustCompile(`\beyJ[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]+`),
+			},
+		}
+	},
+}
+
+// Categories lists the built-in categories.
+var Categories = []string{CategoryEmail, CategoryIPAddress, CategoryCreditCard, CategoryBearerToken}
+
+// DefaultDetectors returns the detectors of every built-in category.
+func DefaultDetectors() []Detector {
+	detectors, _ := Lookup(Categories)
+	return detectors
+}
+
+// Lookup returns the detectors of the named built-in categories.
+func Lookup(categories []string) ([]Detector, error) {
+	var detectors []Detector
+	for _, category := range categories {
+		build, ok := builtin[category]
+		if !ok {
+			return nil, fmt.Errorf("unknown redaction category %q", category)
+		}
+		detectors = append(detectors, build()...)
+	}
+	return detectors, nil
+}
+
+// luhn reports whether the digits of a candidate card number, ignoring
+// spaces and dashes, pass the Luhn checksum.
+func luhn(candidate []byte) bool {
+	sum, digits := 0, 0
+	for i := len(candidate) - 1; i >= 0; i-- {
+		c := candidate[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if digits%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		digits++
+	}
+	return digits >= 13 && digits <= 19 && sum%10 == 0
+}
+
+func isIPv6(candidate []byte) bool {
+	ip := net.ParseIP(string(candidate))
+	return ip != nil && ip.To4() == nil
+}
@@ -0,0 +1,149 @@
+// Package redact finds personal data such as email addresses, IP addresses,
+// card numbers and bearer tokens in uploaded logs, and either masks it or
+// only reports it.
+package redact
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"sort"
+	"user-service/internal/models"
+)
+
+// maxChunk bounds the bytes read at once. Longer lines are inspected in
+// pieces.
+const maxChunk = 64 * 1024
+
+// overlap is the tail of a piece that is held back and inspected again with
+// the next piece, so a match spanning two pieces is still found unless it is
+// longer than this.
+const overlap = 1024
+
+// Reader redacts a stream line by line. In mask mode every match is replaced
+// with [REDACTED:<category>]; in report mode the content passes through
+// unchanged. Either way matches are counted per category.
+type Reader struct {
+	src       *bufio.Reader
+	detectors []Detector
+	mode      models.RedactionMode
+	report    *models.RedactionReport
+	pending   []byte
+	carry     []byte
+	err       error
+}
+
+// NewReader returns a Reader that redacts r with the given detectors.
+func NewReader(r io.Reader, detectors []Detector, mode models.RedactionMode) *Reader {
+	return &Reader{
+		src:       bufio.NewReaderSize(r, maxChunk),
+		detectors: detectors,
+		mode:      mode,
+		report:    &models.RedactionReport{Mode: mode, Counts: make(map[string]int64)},
+	}
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		chunk, err := r.src.ReadSlice('\n')
+		full := err == bufio.ErrBufferFull
+		if full {
+			err = nil
+		}
+		r.err = err
+		if len(r.carry) > 0 {
+			chunk = append(r.carry, chunk...)
+			r.carry = nil
+		}
+		if full {
+			chunk, r.carry = r.split(chunk)
+		}
+		if len(chunk) > 0 {
+			r.pending = r.redact(chunk)
+		}
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// Report returns the findings so far. It is complete once Read has returned
+// io.EOF.
+func (r *Reader) Report() *models.RedactionReport {
+	return r.report
+}
+
+// redact counts the matches in chunk and returns the chunk to pass on. The
+// returned slice may alias chunk only until the next read from src, so it
+// is always copied.
+func (r *Reader) redact(chunk []byte) []byte {
+	matches := r.find(chunk)
+	for _, m := range matches {
+		r.report.Counts[m.category]++
+		r.report.Total++
+	}
+	if r.mode != models.RedactionModeMask || len(matches) == 0 {
+		return append([]byte(nil), chunk...)
+	}
+
+	var out bytes.Buffer
+	last := 0
+	for _, m := range matches {
+		out.Write(chunk[last:m.start])
+		out.WriteString("[REDACTED:" + m.category + "]")
+		last = m.end
+	}
+	out.Write(chunk[last:])
+	return out.Bytes()
+}
+
+// split cuts a piece of a long line about overlap bytes before its end, or
+// earlier where a match crosses that point, and returns the part to redact
+// now and a copy of the rest to inspect again with the next piece.
+func (r *Reader) split(chunk []byte) ([]byte, []byte) {
+	cut := len(chunk) - overlap
+	if cut <= 0 {
+		return nil, append([]byte(nil), chunk...)
+	}
+	for _, m := range r.find(chunk) {
+		if m.start < cut && m.end > cut && m.start >= cut-overlap {
+			cut = m.start
+		}
+	}
+	return chunk[:cut], append([]byte(nil), chunk[cut:]...)
+}
+
+type match struct {
+	start, end int
+	category   string
+}
+
+// find returns the matches of every detector in chunk, in order and without
+// overlaps. Where matches overlap the earliest, then longest, wins.
+func (r *Reader) find(chunk []byte) []match {
+	var all []match
+	for _, detector := range r.detectors {
+		for _, rng := range detector.Find(chunk) {
+			all = append(all, match{start: rng[0], end: rng[1], category: detector.Category()})
+		}
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		if all[i].start != all[j].start {
+			return all[i].start < all[j].start
+		}
+		return all[i].end > all[j].end
+	})
+
+	kept := all[:0]
+	end := 0
+	for _, m := range all {
+		if m.start >= end && m.end > m.start {
+			kept = append(kept, m)
+			end = m.end
+		}
+	}
+	return kept
+}
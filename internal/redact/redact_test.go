@@ -0,0 +1,157 @@
+package redact
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"user-service/internal/models"
+)
+
+func TestLuhn(t *testing.T) {
+	tests := []struct {
+		candidate string
+		want      bool
+	}{
+		{"4111111111111111", true},
+		{"4111 1111 1111 1111", true},
+		{"4111-1111-1111-1111", true},
+		{"378282246310005", true},
+		{"4111111111111112", false},
+		{"1234567890123", false},
+		{"411111111111", false},
+		{"41111111111111111111", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := luhn([]byte(tt.candidate)); got != tt.want {
+			t.Errorf("luhn(%q) = %v, want %v", tt.candidate, got, tt.want)
+		}
+	}
+}
+
+func TestDetectors(t *testing.T) {
+	tests := []struct {
+		category string
+		line     string
+		want     []string
+	}{
+		{CategoryEmail, "sent to jane.doe+logs@mail.example.com today", []string{"jane.doe+logs@mail.example.com"}},
+		{CategoryEmail, "user root@localhost logged in", nil},
+		{CategoryIPAddress, "client 192.168.1.10 and 10.0.0.255", []string{"192.168.1.10", "10.0.0.255"}},
+		{CategoryIPAddress, "peer 2001:db8::1 connected", []string{"2001:db8::1"}},
+		{CategoryIPAddress, "address 999.1.1.1 at 12:30:45", nil},
+		{CategoryCreditCard, "card 4111 1111 1111 1111 charged", []string{"4111 1111 1111 1111"}},
+		{CategoryCreditCard, "amex 378282246310005", []string{"378282246310005"}},
+		{CategoryCreditCard, "order 4111111111111112", nil},
+		{CategoryBearerToken, "Authorization: Bearer abc.DEF-123_x=", []string{"abc.DEF-123_x="}},
+		{CategoryBearerToken, "token=eyJhbGciOi.eyJzdWIiOi.c2lnbmF0dXJl", []string{"eyJhbGciOi.eyJzdWIiOi.c2lnbmF0dXJl"}},
+		{CategoryBearerToken, "eyJ is not a token", nil},
+	}
+	for _, tt := range tests {
+		detectors, err := Lookup([]string{tt.category})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, detector := range detectors {
+			for _, rng := range detector.Find([]byte(tt.line)) {
+				got = append(got, tt.line[rng[0]:rng[1]])
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s in %q = %q, want %q", tt.category, tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestLookupUnknownCategory(t *testing.T) {
+	if _, err := Lookup([]string{CategoryEmail, "phone"}); err == nil {
+		t.Error("Lookup accepted an unknown category")
+	}
+}
+
+const input = "login jane@example.com from 192.168.1.10\n" +
+	"paid with 4111 1111 1111 1111, not 4111111111111112\n" +
+	"Authorization: Bearer abc123\n" +
+	"nothing to see here"
+
+func TestReader(t *testing.T) {
+	tests := []struct {
+		mode models.RedactionMode
+		want string
+	}{
+		{
+			models.RedactionModeMask,
+			"login [REDACTED:email] from [REDACTED:ip_address]\n" +
+				"paid with [REDACTED:credit_card], not 4111111111111112\n" +
+				"Authorization: Bearer [REDACTED:bearer_token]\n" +
+				"nothing to see here",
+		},
+		{models.RedactionModeReport, input},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			r := NewReader(strings.NewReader(input), DefaultDetectors(), tt.mode)
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("content = %q, want %q", got, tt.want)
+			}
+			want := &models.RedactionReport{
+				Mode: tt.mode,
+				Counts: map[string]int64{
+					CategoryEmail:       1,
+					CategoryIPAddress:   1,
+					CategoryCreditCard:  1,
+					CategoryBearerToken: 1,
+				},
+				Total: 4,
+			}
+			if report := r.Report(); !reflect.DeepEqual(report, want) {
+				t.Errorf("report = %+v, want %+v", report, want)
+			}
+		})
+	}
+}
+
+// TestReaderSmallReads checks that matches are found whatever the sizes of
+// the reads on either side of the Reader.
+func TestReaderSmallReads(t *testing.T) {
+	r := NewReader(iotest.OneByteReader(strings.NewReader(input)), DefaultDetectors(), models.RedactionModeMask)
+	got, err := io.ReadAll(iotest.OneByteReader(r))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "login [REDACTED:email] from [REDACTED:ip_address]\n"; !strings.HasPrefix(string(got), want) {
+		t.Errorf("content = %q, want prefix %q", got, want)
+	}
+	if r.Report().Total != 4 {
+		t.Errorf("total = %d, want 4", r.Report().Total)
+	}
+}
+
+// TestReaderMatchAcrossPieces checks that a match on a line longer than the
+// read buffer is found where the line is cut into pieces.
+func TestReaderMatchAcrossPieces(t *testing.T) {
+	for _, offset := range []int{-30, -10, -1, 0, 1, 10} {
+		prefix := strings.Repeat("x", maxChunk+offset) + " "
+		line := prefix + "jane@example.com " + strings.Repeat("y", maxChunk) + " 10.0.0.1\n"
+		r := NewReader(strings.NewReader(line), DefaultDetectors(), models.RedactionModeMask)
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := prefix + "[REDACTED:email] " + strings.Repeat("y", maxChunk) + " [REDACTED:ip_address]\n"
+		if string(got) != want {
+			t.Errorf("offset %d: content differs around %q", offset, got[maxChunk-40:maxChunk+40])
+		}
+		counts := map[string]int64{CategoryEmail: 1, CategoryIPAddress: 1}
+		if report := r.Report(); !reflect.DeepEqual(report.Counts, counts) {
+			t.Errorf("offset %d: counts = %v, want %v", offset, report.Counts, counts)
+		}
+	}
+}
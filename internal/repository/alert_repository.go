@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+	"user-service/internal/apperrors"
+	"user-service/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type AlertRepository struct {
+	collection *mongo.Collection
+}
+
+func NewAlertRepository(db *mongo.Database) *AlertRepository {
+	return &AlertRepository{
+		collection: db.Collection("alerts"),
+	}
+}
+
+// legacyAlertIndex is the unique (query_id, file_id) index that allowed a
+// query a single alert per file, whatever its version.
+const legacyAlertIndex = "query_id_1_file_id_1"
+
+// Server error codes for dropping an index that, or whose collection, does
+// not exist.
+const (
+	codeNamespaceNotFound = 26
+	codeIndexNotFound     = 27
+)
+
+// EnsureIndexes creates the unique (query_id, file_id, file_version) index,
+// which keeps a query from alerting twice on one version of a file and finds
+// a query's latest alert on a file, and the index used to list a user's
+// alerts. The legacy per-file index is dropped.
+func (r *AlertRepository) EnsureIndexes(ctx context.Context) error {
+	var cmdErr mongo.CommandError
+	if _, err := r.collection.Indexes().DropOne(ctx, legacyAlertIndex); err != nil &&
+		!(errors.As(err, &cmdErr) && (cmdErr.Code == codeNamespaceNotFound || cmdErr.Code == codeIndexNotFound)) {
+		return err
+	}
+	_, err := r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "query_id", Value: 1}, {Key: "file_id", Value: 1}, {Key: "file_version", Value: -1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+	})
+	return err
+}
+
+// Create stores an alert. It reports false when the query has already
+// alerted on this version of the file.
+func (r *AlertRepository) Create(ctx context.Context, alert *models.Alert) (bool, error) {
+	alert.ID = primitive.NewObjectID()
+	alert.CreatedAt = time.Now()
+
+	if _, err := r.collection.InsertOne(ctx, alert); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		slog.ErrorContext(ctx, "Failed to insert alert", "op", "AlertRepository.Create", "error", err)
+		return false, apperrors.Database(err)
+	}
+	return true, nil
+}
+
+// Latest returns a query's alert on the newest version of a file, or nil
+// when the query has not alerted on the file.
+func (r *AlertRepository) Latest(ctx context.Context, queryID, fileID primitive.ObjectID) (*models.Alert, error) {
+	var alert models.Alert
+	err := r.collection.FindOne(ctx, bson.M{"query_id": queryID, "file_id": fileID}, options.FindOne().
+		SetSort(bson.D{{Key: "file_version", Value: -1}})).Decode(&alert)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to fetch latest alert", "op", "AlertRepository.Latest", "query_id", queryID.Hex(), "file_id", fileID.Hex(), "error", err)
+		return nil, apperrors.Database(err)
+	}
+	return &alert, nil
+}
+
+// List returns a user's most recent alerts, optionally only those of one
+// query.
+func (r *AlertRepository) List(ctx context.Context, userID uint, queryID *primitive.ObjectID, limit int) ([]models.Alert, error) {
+	filter := bson.M{"user_id": userID}
+	if queryID != nil {
+		filter["query_id"] = *queryID
+	}
+	cursor, err := r.collection.Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetLimit(int64(limit)))
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to fetch alerts", "op", "AlertRepository.List", "error", err)
+		return nil, apperrors.Database(err)
+	}
+	defer cursor.Close(ctx)
+
+	alerts := []models.Alert{}
+	if err := cursor.All(ctx, &alerts); err != nil {
+		slog.ErrorContext(ctx, "Failed to decode alerts", "op", "AlertRepository.List", "error", err)
+		return nil, apperrors.Database(err)
+	}
+	return alerts, nil
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestAlertRepositoryLatest(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("no alert", func(mt *mtest.T) {
+		repo := NewAlertRepository(mt.DB)
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "analyticsai.alerts", mtest.FirstBatch))
+
+		alert, err := repo.Latest(context.Background(), primitive.NewObjectID(), primitive.NewObjectID())
+		if err != nil || alert != nil {
+			mt.Fatalf("Latest = %v, %v, want no alert", alert, err)
+		}
+	})
+
+	mt.Run("newest version first", func(mt *mtest.T) {
+		repo := NewAlertRepository(mt.DB)
+		queryID, fileID := primitive.NewObjectID(), primitive.NewObjectID()
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "analyticsai.alerts", mtest.FirstBatch, bson.D{
+			{Key: "_id", Value: primitive.NewObjectID()},
+			{Key: "query_id", Value: queryID},
+			{Key: "file_id", Value: fileID},
+			{Key: "file_version", Value: int64(3)},
+			{Key: "matches", Value: int64(12)},
+		}))
+
+		alert, err := repo.Latest(context.Background(), queryID, fileID)
+		if err != nil {
+			mt.Fatal(err)
+		}
+		if alert.FileVersion != 3 || alert.Matches != 12 {
+			mt.Errorf("Latest = version %d, %d matches, want version 3, 12 matches", alert.FileVersion, alert.Matches)
+		}
+
+		sort, err := mt.GetStartedEvent().Command.LookupErr("sort")
+		if err != nil {
+			mt.Fatal(err)
+		}
+		want := bson.D{{Key: "file_version", Value: int32(-1)}}
+		var got bson.D
+		if err := sort.Unmarshal(&got); err != nil || len(got) != 1 || got[0].Key != want[0].Key {
+			mt.Errorf("sort = %v, want %v", got, want)
+		}
+	})
+}
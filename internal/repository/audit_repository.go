@@ -0,0 +1,163 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"user-service/internal/apperrors"
+	"user-service/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AuditRepository stores the audit log. It only inserts and reads entries;
+// nothing in the service updates or deletes them.
+type AuditRepository struct {
+	collection *mongo.Collection
+}
+
+func NewAuditRepository(db *mongo.Database) *AuditRepository {
+	return &AuditRepository{
+		collection: db.Collection("audit_log"),
+	}
+}
+
+// EnsureIndexes creates the unique index on chain sequence numbers, which
+// keeps two instances from appending the same link, and the indexes used to
+// filter entries.
+func (r *AuditRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "seq", Value: 1}},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{"seq": bson.M{"$exists": true}}),
+		},
+		{Keys: bson.D{{Key: "actor_id", Value: 1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "file_id", Value: 1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "action", Value: 1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "request_id", Value: 1}}},
+	})
+	return err
+}
+
+// Insert appends an entry. It reports false when a chained entry's
+// sequence number has already been taken.
+func (r *AuditRepository) Insert(ctx context.Context, entry *models.AuditEntry) (bool, error) {
+	if _, err := r.collection.InsertOne(ctx, entry); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		slog.ErrorContext(ctx, "Failed to insert audit entry", "op", "AuditRepository.Insert", "error", err)
+		return false, apperrors.Database(err)
+	}
+	return true, nil
+}
+
+// LastChained returns the chained entry with the highest sequence number,
+// or nil when the chain is empty.
+func (r *AuditRepository) LastChained(ctx context.Context) (*models.AuditEntry, error) {
+	var entry models.AuditEntry
+	err := r.collection.FindOne(ctx, bson.M{"seq": bson.M{"$exists": true}}, options.FindOne().
+		SetSort(bson.D{{Key: "seq", Value: -1}})).Decode(&entry)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to fetch audit entry", "op", "AuditRepository.LastChained", "error", err)
+		return nil, apperrors.Database(err)
+	}
+	return &entry, nil
+}
+
+// List returns the most recent entries matching req, newest first.
+func (r *AuditRepository) List(ctx context.Context, req models.AuditListRequest, limit int) ([]models.AuditEntry, error) {
+	cursor, err := r.collection.Find(ctx, auditFilter(req), options.Find().
+		SetSort(bson.D{{Key: "_id", Value: -1}}).
+		SetLimit(int64(limit)))
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to fetch audit entries", "op", "AuditRepository.List", "error", err)
+		return nil, apperrors.Database(err)
+	}
+	defer cursor.Close(ctx)
+
+	entries := []models.AuditEntry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		slog.ErrorContext(ctx, "Failed to decode audit entries", "op", "AuditRepository.List", "error", err)
+		return nil, apperrors.Database(err)
+	}
+	return entries, nil
+}
+
+// Each calls fn with every entry matching req, oldest first, until fn
+// returns an error.
+func (r *AuditRepository) Each(ctx context.Context, req models.AuditListRequest, fn func(*models.AuditEntry) error) error {
+	return r.each(ctx, "Each", auditFilter(req), bson.D{{Key: "_id", Value: 1}}, fn)
+}
+
+// EachChained calls fn with every chained entry in sequence order, until
+// fn returns an error.
+func (r *AuditRepository) EachChained(ctx context.Context, fn func(*models.AuditEntry) error) error {
+	return r.each(ctx, "EachChained", bson.M{"seq": bson.M{"$exists": true}}, bson.D{{Key: "seq", Value: 1}}, fn)
+}
+
+func (r *AuditRepository) each(ctx context.Context, method string, filter bson.M, sort bson.D, fn func(*models.AuditEntry) error) error {
+	cursor, err := r.collection.Find(ctx, filter, options.Find().SetSort(sort))
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to fetch audit entries", "op", "AuditRepository."+method, "error", err)
+		return apperrors.Database(err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var entry models.AuditEntry
+		if err := cursor.Decode(&entry); err != nil {
+			slog.ErrorContext(ctx, "Failed to decode audit entry", "op", "AuditRepository."+method, "error", err)
+			return apperrors.Database(err)
+		}
+		if err := fn(&entry); err != nil {
+			return err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		slog.ErrorContext(ctx, "Failed to read audit entries", "op", "AuditRepository."+method, "error", err)
+		return apperrors.Database(err)
+	}
+	return nil
+}
+
+// auditFilter translates a validated request into a query.
+func auditFilter(req models.AuditListRequest) bson.M {
+	filter := bson.M{}
+	if req.ActorID != nil {
+		filter["actor_id"] = *req.ActorID
+	}
+	if req.Action != "" {
+		filter["action"] = req.Action
+	}
+	if req.FileID != "" {
+		filter["file_id"] = req.FileID
+	}
+	if req.Outcome != "" {
+		filter["outcome"] = req.Outcome
+	}
+	if req.RequestID != "" {
+		filter["request_id"] = req.RequestID
+	}
+	if req.From != nil || req.To != nil {
+		time := bson.M{}
+		if req.From != nil {
+			time["$gte"] = *req.From
+		}
+		if req.To != nil {
+			time["$lt"] = *req.To
+		}
+		filter["time"] = time
+	}
+	if before, err := primitive.ObjectIDFromHex(req.Before); err == nil {
+		filter["_id"] = bson.M{"$lt": before}
+	}
+	return filter
+}
@@ -0,0 +1,150 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+	"user-service/internal/apperrors"
+	"user-service/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var errDeliveryNotFound = apperrors.New(apperrors.ErrNotFound, "delivery not found")
+
+// deliveryRetention is how long the delivery log is kept.
+const deliveryRetention = 30 * 24 * time.Hour
+
+type DeliveryRepository struct {
+	collection *mongo.Collection
+}
+
+func NewDeliveryRepository(db *mongo.Database) *DeliveryRepository {
+	return &DeliveryRepository{
+		collection: db.Collection("webhook_deliveries"),
+	}
+}
+
+// EnsureIndexes creates the index used to find due deliveries, the index
+// used to list a webhook's deliveries and the TTL index that expires the
+// delivery log.
+func (r *DeliveryRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}}},
+		{Keys: bson.D{{Key: "webhook_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{
+			Keys:    bson.D{{Key: "created_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(deliveryRetention / time.Second)),
+		},
+	})
+	return err
+}
+
+// Create stores new deliveries, due now.
+func (r *DeliveryRepository) Create(ctx context.Context, deliveries []*models.WebhookDelivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	now := time.Now()
+	documents := make([]any, len(deliveries))
+	for i, delivery := range deliveries {
+		delivery.ID = primitive.NewObjectID()
+		delivery.Status = models.DeliveryStatusPending
+		delivery.NextAttemptAt = now
+		delivery.Attempts = []models.DeliveryAttempt{}
+		delivery.CreatedAt = now
+		delivery.UpdatedAt = now
+		documents[i] = delivery
+	}
+	if _, err := r.collection.InsertMany(ctx, documents); err != nil {
+		slog.ErrorContext(ctx, "Failed to insert deliveries", "op", "DeliveryRepository.Create", "error", err)
+		return apperrors.Database(err)
+	}
+	return nil
+}
+
+func (r *DeliveryRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&delivery)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, errDeliveryNotFound
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to fetch delivery", "op", "DeliveryRepository.GetByID", "delivery_id", id.Hex(), "error", err)
+		return nil, apperrors.Database(err)
+	}
+	return &delivery, nil
+}
+
+// ListByWebhook returns a webhook's most recent deliveries, optionally only
+// those in one status.
+func (r *DeliveryRepository) ListByWebhook(ctx context.Context, webhookID primitive.ObjectID, status models.DeliveryStatus, limit int) ([]models.WebhookDelivery, error) {
+	filter := bson.M{"webhook_id": webhookID}
+	if status != "" {
+		filter["status"] = status
+	}
+	cursor, err := r.collection.Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetLimit(int64(limit)))
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to fetch deliveries", "op", "DeliveryRepository.ListByWebhook", "error", err)
+		return nil, apperrors.Database(err)
+	}
+	defer cursor.Close(ctx)
+
+	deliveries := []models.WebhookDelivery{}
+	if err := cursor.All(ctx, &deliveries); err != nil {
+		slog.ErrorContext(ctx, "Failed to decode deliveries", "op", "DeliveryRepository.ListByWebhook", "error", err)
+		return nil, apperrors.Database(err)
+	}
+	return deliveries, nil
+}
+
+// ClaimDue takes the pending delivery that has been due the longest and
+// pushes its next attempt back by lease, so no other worker sends it while
+// it is in flight. A delivery whose worker dies is sent again once the lease
+// runs out. It returns nil when nothing is due.
+func (r *DeliveryRepository) ClaimDue(ctx context.Context, lease time.Duration) (*models.WebhookDelivery, error) {
+	now := time.Now()
+	var delivery models.WebhookDelivery
+	err := r.collection.FindOneAndUpdate(
+		ctx,
+		bson.M{"status": models.DeliveryStatusPending, "next_attempt_at": bson.M{"$lte": now}},
+		bson.M{"$set": bson.M{"next_attempt_at": now.Add(lease)}},
+		options.FindOneAndUpdate().
+			SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).
+			SetReturnDocument(options.After),
+	).Decode(&delivery)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to claim delivery", "op", "DeliveryRepository.ClaimDue", "error", err)
+		return nil, apperrors.Database(err)
+	}
+	return &delivery, nil
+}
+
+// RecordAttempt appends an attempt to a delivery and moves it to status. A
+// pending delivery is next sent at next.
+func (r *DeliveryRepository) RecordAttempt(ctx context.Context, id primitive.ObjectID, attempt models.DeliveryAttempt, status models.DeliveryStatus, next time.Time) error {
+	set := bson.M{"status": status, "updated_at": attempt.At}
+	if status == models.DeliveryStatusPending {
+		set["next_attempt_at"] = next
+	} else {
+		set["completed_at"] = attempt.At
+	}
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$set":  set,
+		"$push": bson.M{"attempts": attempt},
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to update delivery", "op", "DeliveryRepository.RecordAttempt", "delivery_id", id.Hex(), "error", err)
+		return apperrors.Database(err)
+	}
+	return nil
+}
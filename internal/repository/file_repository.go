@@ -2,107 +2,379 @@ package repository
 
 import (
 	"context"
-	"log"
+	"errors"
+	"log/slog"
 	"time"
+	"user-service/internal/apperrors"
 	"user-service/internal/models"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// FileRepository stores file records. Every change to a file is recorded
+// as an event in the outbox.
 type FileRepository struct {
 	collection *mongo.Collection
+	outbox     *OutboxRepository
 }
 
-func NewFileRepository(db *mongo.Database) *FileRepository {
+func NewFileRepository(db *mongo.Database, outbox *OutboxRepository) *FileRepository {
 	return &FileRepository{
 		collection: db.Collection("files"),
+		outbox:     outbox,
 	}
 }
 
+// EnsureIndexes creates the indexes used by file listings.
+func (r *FileRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "format.format", Value: 1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "updated_at", Value: 1}}},
+		{Keys: bson.D{{Key: "archive.parent_id", Value: 1}}},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "tags", Value: 1}}},
+	})
+	return err
+}
+
 func (r *FileRepository) Create(ctx context.Context, file *models.File) error {
-	log.Printf("[FileRepository.Create] Starting file creation")
+	slog.DebugContext(ctx, "Starting file creation", "op", "FileRepository.Create")
 
 	file.CreatedAt = time.Now()
 	file.UpdatedAt = time.Now()
+	file.Version = 1
 
 	// Create a new ObjectID
 	file.ID = primitive.NewObjectID()
-	log.Printf("[FileRepository.Create] Generated new ID: %s", file.ID.Hex())
+	slog.DebugContext(ctx, "Generated new ID", "op", "FileRepository.Create", "file_id", file.ID.Hex())
 
-	result, err := r.collection.InsertOne(ctx, file)
+	err := r.outbox.apply(ctx, func(ctx context.Context) (*outboxEntry, error) {
+		result, err := r.collection.InsertOne(ctx, file)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to insert file", "op", "FileRepository.Create", "error", err)
+			return nil, apperrors.Database(err)
+		}
+		slog.DebugContext(ctx, "Inserted file", "op", "FileRepository.Create", "inserted_id", result.InsertedID)
+		return &outboxEntry{eventType: models.OutboxFileCreated, fileID: file.ID, userID: file.UserID, data: file}, nil
+	})
 	if err != nil {
-		log.Printf("[FileRepository.Create] Failed to insert file: %v", err)
 		return err
 	}
-	log.Printf("Results: %s", result)
 
-	log.Printf("[FileRepository.Create] File created successfully with ID: %s", file.ID.Hex())
+	slog.DebugContext(ctx, "File created", "op", "FileRepository.Create", "file_id", file.ID.Hex())
 	return nil
 }
 
 func (r *FileRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.File, error) {
-	log.Printf("[FileRepository.GetByID] Fetching file with ID: %s", id.Hex())
+	slog.DebugContext(ctx, "Fetching file", "op", "FileRepository.GetByID", "file_id", id.Hex())
 
 	var file models.File
 	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&file)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		slog.DebugContext(ctx, "File not found", "op", "FileRepository.GetByID", "file_id", id.Hex())
+		return nil, apperrors.ErrFileNotFound
+	}
 	if err != nil {
-		log.Printf("[FileRepository.GetByID] Failed to fetch file: %v", err)
-		return nil, err
+		slog.ErrorContext(ctx, "Failed to fetch file", "op", "FileRepository.GetByID", "error", err)
+		return nil, apperrors.Database(err)
 	}
-	log.Printf("[FileRepository.GetByID] Successfully fetched file: %s", file.ID.Hex())
+	slog.DebugContext(ctx, "Fetched file", "op", "FileRepository.GetByID", "file_id", file.ID.Hex())
 	return &file, nil
 }
 
-func (r *FileRepository) GetByUserID(ctx context.Context, userID uint) ([]models.File, error) {
-	log.Printf("[FileRepository.GetByUserID] Fetching files for user: %d", userID)
+func (r *FileRepository) GetByUserID(ctx context.Context, userID uint, filter models.FileFilter) ([]models.File, error) {
+	slog.DebugContext(ctx, "Fetching files for user", "op", "FileRepository.GetByUserID", "user_id", userID)
 
-	cursor, err := r.collection.Find(ctx, bson.M{"user_id": userID})
+	query := bson.M{"user_id": userID}
+	if filter.Format != "" {
+		query["format.format"] = filter.Format
+	}
+	if filter.Status != "" {
+		query["status"] = filter.Status
+	}
+	if filter.ParentID != nil {
+		query["archive.parent_id"] = *filter.ParentID
+	}
+	if filter.Tag != "" {
+		query["tags"] = filter.Tag
+	}
+
+	// Cached timelines are only served by the timeline endpoint
+	cursor, err := r.collection.Find(ctx, query, options.Find().SetProjection(bson.M{"timelines": 0}))
 	if err != nil {
-		log.Printf("[FileRepository.GetByUserID] Failed to fetch files: %v", err)
-		return nil, err
+		slog.ErrorContext(ctx, "Failed to fetch files", "op", "FileRepository.GetByUserID", "error", err)
+		return nil, apperrors.Database(err)
 	}
 	defer cursor.Close(ctx)
 
 	var files []models.File
 	if err := cursor.All(ctx, &files); err != nil {
-		log.Printf("[FileRepository.GetByUserID] Failed to decode files: %v", err)
-		return nil, err
+		slog.ErrorContext(ctx, "Failed to decode files", "op", "FileRepository.GetByUserID", "error", err)
+		return nil, apperrors.Database(err)
 	}
-	log.Printf("[FileRepository.GetByUserID] Successfully fetched %d files", len(files))
+	slog.DebugContext(ctx, "Fetched files", "op", "FileRepository.GetByUserID", "count", len(files))
 	return files, nil
 }
 
 func (r *FileRepository) UpdateStatus(ctx context.Context, id primitive.ObjectID, status models.FileStatus) error {
-	log.Printf("[FileRepository.UpdateStatus] Updating status for file: %s to: %s", id.Hex(), status)
+	slog.DebugContext(ctx, "Updating file status", "op", "FileRepository.UpdateStatus", "file_id", id.Hex(), "status", status)
 
-	_, err := r.collection.UpdateOne(
-		ctx,
-		bson.M{"_id": id},
-		bson.M{
-			"$set": bson.M{
-				"status":     status,
-				"updated_at": time.Now(),
+	err := r.outbox.apply(ctx, func(ctx context.Context) (*outboxEntry, error) {
+		var previous models.File
+		err := r.collection.FindOneAndUpdate(
+			ctx,
+			bson.M{"_id": id},
+			bson.M{
+				"$set": bson.M{
+					"status":     status,
+					"updated_at": time.Now(),
+				},
 			},
-		},
-	)
+			options.FindOneAndUpdate().SetProjection(bson.M{"user_id": 1, "status": 1}),
+		).Decode(&previous)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			slog.DebugContext(ctx, "File not found", "op", "FileRepository.UpdateStatus", "file_id", id.Hex())
+			return nil, apperrors.ErrFileNotFound
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to update status", "op", "FileRepository.UpdateStatus", "error", err)
+			return nil, apperrors.Database(err)
+		}
+		return &outboxEntry{
+			eventType: models.OutboxFileStatusChanged,
+			fileID:    id,
+			userID:    previous.UserID,
+			data:      bson.M{"status": status, "previous_status": previous.Status},
+		}, nil
+	})
 	if err != nil {
-		log.Printf("[FileRepository.UpdateStatus] Failed to update status: %v", err)
 		return err
 	}
-	log.Printf("[FileRepository.UpdateStatus] Successfully updated status")
+	slog.DebugContext(ctx, "Updated file status", "op", "FileRepository.UpdateStatus")
 	return nil
 }
 
 func (r *FileRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
-	log.Printf("[FileRepository.Delete] Deleting file: %s", id.Hex())
+	slog.DebugContext(ctx, "Deleting file", "op", "FileRepository.Delete", "file_id", id.Hex())
 
-	_, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
+	err := r.outbox.apply(ctx, func(ctx context.Context) (*outboxEntry, error) {
+		var deleted models.File
+		err := r.collection.FindOneAndDelete(ctx, bson.M{"_id": id}, options.FindOneAndDelete().SetProjection(bson.M{"user_id": 1})).Decode(&deleted)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			slog.DebugContext(ctx, "File not found", "op", "FileRepository.Delete", "file_id", id.Hex())
+			return nil, apperrors.ErrFileNotFound
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to delete file", "op", "FileRepository.Delete", "error", err)
+			return nil, apperrors.Database(err)
+		}
+		return &outboxEntry{eventType: models.OutboxFileRemoved, fileID: id, userID: deleted.UserID, data: bson.M{}}, nil
+	})
 	if err != nil {
-		log.Printf("[FileRepository.Delete] Failed to delete file: %v", err)
 		return err
 	}
-	log.Printf("[FileRepository.Delete] Successfully deleted file")
+	slog.DebugContext(ctx, "Deleted file", "op", "FileRepository.Delete")
+	return nil
+}
+
+// ErrFileChanged is returned by updates conditional on a file's version
+// when the file has moved on to another version, or by Append when the file
+// has been deleted.
+var ErrFileChanged = apperrors.New(apperrors.ErrInvalidState, "file changed during the update")
+
+// versionFilter matches a file while it is at version.
+func versionFilter(id primitive.ObjectID, version int64) bson.M {
+	filter := bson.M{"_id": id, "version": version}
+	if version == 0 {
+		// Files stored before versioning have no version field
+		filter["version"] = bson.M{"$in": bson.A{0, nil}}
+	}
+	return filter
+}
+
+// missingOrChanged tells why an update conditional on a file's version
+// matched nothing: ErrFileNotFound when the file doesn't exist, and
+// ErrFileChanged when it does.
+func (r *FileRepository) missingOrChanged(ctx context.Context, id primitive.ObjectID, op string) error {
+	exists, err := r.collection.CountDocuments(ctx, bson.M{"_id": id}, options.Count().SetLimit(1))
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to look up file", "op", op, "file_id", id.Hex(), "error", err)
+		return apperrors.Database(err)
+	}
+	if exists == 0 {
+		slog.DebugContext(ctx, "File not found", "op", op, "file_id", id.Hex())
+		return apperrors.ErrFileNotFound
+	}
+	return ErrFileChanged
+}
+
+// CompleteAnalysis stores analysis results and the detected format on a
+// file. The results only apply while the file is still at version, the one
+// that was analyzed; otherwise it fails with ErrFileChanged and the file
+// should be analyzed again. A file that is still analyzing goes back to
+// active; a file the user hid or deleted meanwhile keeps its status.
+func (r *FileRepository) CompleteAnalysis(ctx context.Context, id primitive.ObjectID, version int64, analysis *models.FileAnalysis, format *models.FormatDetection) error {
+	slog.DebugContext(ctx, "Storing analysis", "op", "FileRepository.CompleteAnalysis", "file_id", id.Hex())
+
+	return r.outbox.apply(ctx, func(ctx context.Context) (*outboxEntry, error) {
+		var file models.File
+		err := r.collection.FindOneAndUpdate(
+			ctx,
+			versionFilter(id, version),
+			mongo.Pipeline{{{Key: "$set", Value: bson.M{
+				"analysis": analysis,
+				"format":   format,
+				"status": bson.M{"$cond": bson.A{
+					bson.M{"$eq": bson.A{"$status", models.FileStatusAnalyzing}},
+					models.FileStatusActive,
+					"$status",
+				}},
+				"updated_at": time.Now(),
+			}}}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After).SetProjection(bson.M{"user_id": 1, "status": 1, "version": 1}),
+		).Decode(&file)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, r.missingOrChanged(ctx, id, "FileRepository.CompleteAnalysis")
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to store analysis", "op", "FileRepository.CompleteAnalysis", "error", err)
+			return nil, apperrors.Database(err)
+		}
+		return &outboxEntry{
+			eventType: models.OutboxFileAnalysisCompleted,
+			fileID:    id,
+			userID:    file.UserID,
+			data:      bson.M{"status": file.Status, "version": file.Version, "analysis": analysis, "format": format},
+		}, nil
+	})
+}
+
+// SetExtraction stores the extraction summary of an archive upload.
+func (r *FileRepository) SetExtraction(ctx context.Context, id primitive.ObjectID, extraction *models.Extraction) error {
+	return r.outbox.apply(ctx, func(ctx context.Context) (*outboxEntry, error) {
+		var file models.File
+		err := r.collection.FindOneAndUpdate(
+			ctx,
+			bson.M{"_id": id},
+			bson.M{"$set": bson.M{"extraction": extraction, "updated_at": time.Now()}},
+			options.FindOneAndUpdate().SetProjection(bson.M{"user_id": 1}),
+		).Decode(&file)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, apperrors.ErrFileNotFound
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to store extraction for file", "op", "FileRepository.SetExtraction", "file_id", id.Hex(), "error", err)
+			return nil, apperrors.Database(err)
+		}
+		return &outboxEntry{eventType: models.OutboxFileExtractionCompleted, fileID: id, userID: file.UserID, data: extraction}, nil
+	})
+}
+
+// Append records data appended to a file's blob. The update only applies
+// while the file is at version and not deleted; otherwise it fails with
+// ErrFileChanged, and the caller can re-read the file and try again. size
+// is the blob's size after the append as reported by storage; it only ever
+// grows the stored size, so a record left behind by a failed update catches
+// up on the next append. Cached timelines are dropped and the version moves
+// on. Matches found by redacting the data are added to the file's redaction
+// report.
+func (r *FileRepository) Append(ctx context.Context, id primitive.ObjectID, version, size int64, redaction *models.RedactionReport) (*models.File, error) {
+	update := bson.M{
+		"$max":   bson.M{"size": size},
+		"$inc":   bson.M{"version": 1},
+		"$set":   bson.M{"updated_at": time.Now()},
+		"$unset": bson.M{"timelines": ""},
+	}
+	if redaction != nil {
+		inc := update["$inc"].(bson.M)
+		inc["redaction.total"] = redaction.Total
+		for category, count := range redaction.Counts {
+			inc["redaction.counts."+category] = count
+		}
+		update["$set"].(bson.M)["redaction.mode"] = redaction.Mode
+	}
+
+	filter := versionFilter(id, version)
+	filter["status"] = bson.M{"$ne": models.FileStatusDeleted}
+
+	var file models.File
+	err := r.outbox.apply(ctx, func(ctx context.Context) (*outboxEntry, error) {
+		err := r.collection.FindOneAndUpdate(
+			ctx,
+			filter,
+			update,
+			options.FindOneAndUpdate().SetReturnDocument(options.After).SetProjection(bson.M{"timelines": 0}),
+		).Decode(&file)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, r.missingOrChanged(ctx, id, "FileRepository.Append")
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to record append to file", "op", "FileRepository.Append", "file_id", id.Hex(), "error", err)
+			return nil, apperrors.Database(err)
+		}
+		return &outboxEntry{
+			eventType: models.OutboxFileAppended,
+			fileID:    id,
+			userID:    file.UserID,
+			data:      bson.M{"size": file.Size, "version": file.Version},
+		}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// ContentDeleted records that a file's content has been deleted from
+// storage, which happens outside the database.
+func (r *FileRepository) ContentDeleted(ctx context.Context, file *models.File) error {
+	return r.outbox.apply(ctx, func(ctx context.Context) (*outboxEntry, error) {
+		return &outboxEntry{
+			eventType: models.OutboxFileContentDeleted,
+			fileID:    file.ID,
+			userID:    file.UserID,
+			data:      bson.M{"storage_key": file.StorageKey},
+		}, nil
+	})
+}
+
+// SaveTimeline caches a timeline on a file. Nothing is stored when the file
+// has moved on to a newer version than the one the timeline was computed
+// from.
+func (r *FileRepository) SaveTimeline(ctx context.Context, id primitive.ObjectID, timeline *models.Timeline) error {
+	_, err := r.collection.UpdateOne(ctx, versionFilter(id, timeline.Version), bson.M{"$set": bson.M{"timelines." + timeline.Bucket: timeline}})
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to cache timeline for file", "op", "FileRepository.SaveTimeline", "file_id", id.Hex(), "error", err)
+		return apperrors.Database(err)
+	}
 	return nil
 }
+
+// GetStaleAnalyzing returns the IDs of files that have been analyzing since
+// before the given time, such as files whose worker died with the process.
+func (r *FileRepository) GetStaleAnalyzing(ctx context.Context, before time.Time) ([]primitive.ObjectID, error) {
+	cursor, err := r.collection.Find(
+		ctx,
+		bson.M{"status": models.FileStatusAnalyzing, "updated_at": bson.M{"$lt": before}},
+		options.Find().SetProjection(bson.M{"_id": 1}),
+	)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to fetch files", "op", "FileRepository.GetStaleAnalyzing", "error", err)
+		return nil, apperrors.Database(err)
+	}
+	defer cursor.Close(ctx)
+
+	var files []models.File
+	if err := cursor.All(ctx, &files); err != nil {
+		slog.ErrorContext(ctx, "Failed to decode files", "op", "FileRepository.GetStaleAnalyzing", "error", err)
+		return nil, apperrors.Database(err)
+	}
+
+	ids := make([]primitive.ObjectID, len(files))
+	for i, file := range files {
+		ids[i] = file.ID
+	}
+	return ids, nil
+}
@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"user-service/internal/apperrors"
+	"user-service/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// Server replies to a standalone server's hello, a find that matches
+// nothing, and a findAndModify that matches nothing.
+var (
+	helloReply          = bson.D{{Key: "ok", Value: 1}, {Key: "isWritablePrimary", Value: true}}
+	noDocumentsReply    = mtest.CreateCursorResponse(0, "analyticsai.files", mtest.FirstBatch)
+	matchedNothingReply = bson.D{
+		{Key: "ok", Value: 1},
+		{Key: "lastErrorObject", Value: bson.D{{Key: "n", Value: 0}, {Key: "updatedExisting", Value: false}}},
+		{Key: "value", Value: nil},
+	}
+)
+
+func TestFileRepositoryMapsMissingFilesToFileNotFound(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	tests := []struct {
+		name    string
+		replies []bson.D
+		call    func(r *FileRepository, id primitive.ObjectID) error
+	}{
+		{
+			name:    "GetByID",
+			replies: []bson.D{noDocumentsReply},
+			call: func(r *FileRepository, id primitive.ObjectID) error {
+				_, err := r.GetByID(context.Background(), id)
+				return err
+			},
+		},
+		{
+			name:    "UpdateStatus",
+			replies: []bson.D{helloReply, matchedNothingReply},
+			call: func(r *FileRepository, id primitive.ObjectID) error {
+				return r.UpdateStatus(context.Background(), id, models.FileStatusHidden)
+			},
+		},
+		{
+			name:    "Delete",
+			replies: []bson.D{helloReply, matchedNothingReply},
+			call: func(r *FileRepository, id primitive.ObjectID) error {
+				return r.Delete(context.Background(), id)
+			},
+		},
+		{
+			name:    "CompleteAnalysis",
+			replies: []bson.D{helloReply, matchedNothingReply, noDocumentsReply},
+			call: func(r *FileRepository, id primitive.ObjectID) error {
+				return r.CompleteAnalysis(context.Background(), id, 1, &models.FileAnalysis{}, nil)
+			},
+		},
+		{
+			name:    "SetExtraction",
+			replies: []bson.D{helloReply, matchedNothingReply},
+			call: func(r *FileRepository, id primitive.ObjectID) error {
+				return r.SetExtraction(context.Background(), id, &models.Extraction{})
+			},
+		},
+		{
+			name:    "Append",
+			replies: []bson.D{helloReply, matchedNothingReply, noDocumentsReply},
+			call: func(r *FileRepository, id primitive.ObjectID) error {
+				_, err := r.Append(context.Background(), id, 1, 10, nil)
+				return err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			repo := NewFileRepository(mt.DB, NewOutboxRepository(mt.DB))
+			mt.AddMockResponses(tt.replies...)
+
+			err := tt.call(repo, primitive.NewObjectID())
+			if !errors.Is(err, apperrors.ErrFileNotFound) {
+				mt.Fatalf("error = %v, want %v", err, apperrors.ErrFileNotFound)
+			}
+			if code := apperrors.From(err).Code; code != apperrors.CodeFileNotFound {
+				mt.Errorf("code = %s, want %s", code, apperrors.CodeFileNotFound)
+			}
+		})
+	}
+}
+
+func TestFileRepositoryAppendIsConditionalOnVersion(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("changed", func(mt *mtest.T) {
+		repo := NewFileRepository(mt.DB, NewOutboxRepository(mt.DB))
+		mt.AddMockResponses(helloReply, matchedNothingReply,
+			mtest.CreateCursorResponse(0, "analyticsai.files", mtest.FirstBatch, bson.D{{Key: "n", Value: 1}}))
+
+		_, err := repo.Append(context.Background(), primitive.NewObjectID(), 3, 10, nil)
+		if !errors.Is(err, ErrFileChanged) {
+			mt.Fatalf("error = %v, want %v", err, ErrFileChanged)
+		}
+		if code := apperrors.From(err).Code; code != apperrors.CodeInvalidState {
+			mt.Errorf("code = %s, want %s", code, apperrors.CodeInvalidState)
+		}
+	})
+
+	mt.Run("filter", func(mt *mtest.T) {
+		repo := NewFileRepository(mt.DB, NewOutboxRepository(mt.DB))
+		id := primitive.NewObjectID()
+		mt.AddMockResponses(helloReply, bson.D{
+			{Key: "ok", Value: 1},
+			{Key: "value", Value: bson.D{{Key: "_id", Value: id}, {Key: "size", Value: int64(10)}, {Key: "version", Value: int64(4)}}},
+		})
+
+		file, err := repo.Append(context.Background(), id, 3, 10, nil)
+		if err != nil {
+			mt.Fatal(err)
+		}
+		if file.Version != 4 {
+			mt.Errorf("version = %d, want 4", file.Version)
+		}
+
+		event := mt.GetStartedEvent()
+		for event != nil && event.CommandName != "findAndModify" {
+			event = mt.GetStartedEvent()
+		}
+		if event == nil {
+			mt.Fatal("no findAndModify command was sent")
+		}
+		if version, ok := event.Command.Lookup("query", "version").AsInt64OK(); !ok || version != 3 {
+			mt.Errorf("query version = %v, want 3", event.Command.Lookup("query", "version"))
+		}
+	})
+}
+
+func TestFileRepositoryReportsOtherErrorsAsDatabaseErrors(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("GetByID", func(mt *mtest.T) {
+		repo := NewFileRepository(mt.DB, NewOutboxRepository(mt.DB))
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 11600, Message: "interrupted at shutdown"}))
+
+		_, err := repo.GetByID(context.Background(), primitive.NewObjectID())
+		if err == nil || errors.Is(err, apperrors.ErrNotFound) {
+			mt.Fatalf("error = %v, want a database error", err)
+		}
+	})
+}
@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+	"user-service/internal/apperrors"
+	"user-service/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var errJobNotFound = apperrors.New(apperrors.ErrNotFound, "job not found")
+
+type JobRepository struct {
+	collection *mongo.Collection
+}
+
+func NewJobRepository(db *mongo.Database) *JobRepository {
+	return &JobRepository{
+		collection: db.Collection("jobs"),
+	}
+}
+
+// EnsureIndexes creates the index used to find unfinished jobs.
+func (r *JobRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "status", Value: 1}, {Key: "updated_at", Value: 1}},
+	})
+	return err
+}
+
+// Create stores a new job in the queued status.
+func (r *JobRepository) Create(ctx context.Context, job *models.Job) error {
+	job.ID = primitive.NewObjectID()
+	job.Status = models.JobStatusQueued
+	job.CreatedAt = time.Now()
+	job.UpdatedAt = job.CreatedAt
+
+	if _, err := r.collection.InsertOne(ctx, job); err != nil {
+		slog.ErrorContext(ctx, "Failed to insert job", "op", "JobRepository.Create", "error", err)
+		return apperrors.Database(err)
+	}
+	return nil
+}
+
+func (r *JobRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.Job, error) {
+	var job models.Job
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&job)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, errJobNotFound
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to fetch job", "op", "JobRepository.GetByID", "job_id", id.Hex(), "error", err)
+		return nil, apperrors.Database(err)
+	}
+	return &job, nil
+}
+
+// Start moves a queued or stale running job to running. It reports false
+// when the job has already finished.
+func (r *JobRepository) Start(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	result, err := r.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": id, "status": bson.M{"$in": bson.A{models.JobStatusQueued, models.JobStatusRunning}}},
+		bson.M{"$set": bson.M{"status": models.JobStatusRunning, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to start job", "op", "JobRepository.Start", "job_id", id.Hex(), "error", err)
+		return false, apperrors.Database(err)
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// Complete records the file a job produced.
+func (r *JobRepository) Complete(ctx context.Context, id, resultFileID primitive.ObjectID) error {
+	now := time.Now()
+	return r.finish(ctx, id, bson.M{
+		"status":         models.JobStatusCompleted,
+		"result_file_id": resultFileID,
+		"updated_at":     now,
+		"completed_at":   now,
+	})
+}
+
+// Fail records why a job failed.
+func (r *JobRepository) Fail(ctx context.Context, id primitive.ObjectID, message string) error {
+	now := time.Now()
+	return r.finish(ctx, id, bson.M{
+		"status":       models.JobStatusFailed,
+		"error":        message,
+		"updated_at":   now,
+		"completed_at": now,
+	})
+}
+
+func (r *JobRepository) finish(ctx context.Context, id primitive.ObjectID, set bson.M) error {
+	if _, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": set}); err != nil {
+		slog.ErrorContext(ctx, "Failed to update job", "op", "JobRepository.finish", "job_id", id.Hex(), "error", err)
+		return apperrors.Database(err)
+	}
+	return nil
+}
+
+// GetStale returns the IDs of jobs that have been queued or running since
+// before the given time, such as jobs whose worker died with the process.
+func (r *JobRepository) GetStale(ctx context.Context, before time.Time) ([]primitive.ObjectID, error) {
+	cursor, err := r.collection.Find(
+		ctx,
+		bson.M{
+			"status":     bson.M{"$in": bson.A{models.JobStatusQueued, models.JobStatusRunning}},
+			"updated_at": bson.M{"$lt": before},
+		},
+		options.Find().SetProjection(bson.M{"_id": 1}),
+	)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to fetch jobs", "op", "JobRepository.GetStale", "error", err)
+		return nil, apperrors.Database(err)
+	}
+	defer cursor.Close(ctx)
+
+	var jobs []models.Job
+	if err := cursor.All(ctx, &jobs); err != nil {
+		slog.ErrorContext(ctx, "Failed to decode jobs", "op", "JobRepository.GetStale", "error", err)
+		return nil, apperrors.Database(err)
+	}
+
+	ids := make([]primitive.ObjectID, len(jobs))
+	for i, job := range jobs {
+		ids[i] = job.ID
+	}
+	return ids, nil
+}
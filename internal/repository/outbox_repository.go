@@ -0,0 +1,275 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+	"time"
+	"user-service/internal/apperrors"
+	"user-service/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// outboxRetention is how long published events are kept.
+const outboxRetention = 7 * 24 * time.Hour
+
+// relayLease names the lease that elects the instance running the relay.
+const relayLease = "relay"
+
+// OutboxRepository stores domain events alongside the changes they
+// describe. Repositories make changes through apply, which writes the
+// change and its event in one MongoDB transaction. Transactions need a
+// replica set or sharded cluster; on a standalone server the change and
+// the event are written one after the other instead, so an event can be
+// lost if the process dies in between.
+type OutboxRepository struct {
+	client    *mongo.Client
+	events    *mongo.Collection
+	sequences *mongo.Collection
+	leases    *mongo.Collection
+
+	// transactions is 0 until the server has been asked whether it
+	// supports transactions, then 1 if it does and -1 if it doesn't
+	transactions atomic.Int32
+}
+
+func NewOutboxRepository(db *mongo.Database) *OutboxRepository {
+	return &OutboxRepository{
+		client:    db.Client(),
+		events:    db.Collection("outbox"),
+		sequences: db.Collection("outbox_sequences"),
+		leases:    db.Collection("outbox_leases"),
+	}
+}
+
+// EnsureIndexes creates the index used to find unpublished events and the
+// TTL index that expires published ones.
+func (r *OutboxRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.events.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "published_at", Value: 1}, {Key: "_id", Value: 1}}},
+		{
+			Keys:    bson.D{{Key: "published_at", Value: 1}},
+			Options: options.Index().SetName("published_at_ttl").SetExpireAfterSeconds(int32(outboxRetention / time.Second)),
+		},
+	})
+	return err
+}
+
+// outboxEntry is an event about a file waiting to be recorded.
+type outboxEntry struct {
+	eventType models.OutboxEventType
+	fileID    primitive.ObjectID
+	userID    uint
+	data      any
+}
+
+// apply runs change and records the event it returns, if any, in one
+// transaction when the server supports them. change may be called more
+// than once when a transaction is retried. Without transactions the event
+// is recorded after the change, and failing to record it is only logged
+// since the change has already been made.
+func (r *OutboxRepository) apply(ctx context.Context, change func(ctx context.Context) (*outboxEntry, error)) error {
+	if !r.supportsTransactions(ctx) {
+		entry, err := change(ctx)
+		if err != nil || entry == nil {
+			return err
+		}
+		if err := r.record(ctx, entry); err != nil {
+			slog.ErrorContext(ctx, "Lost outbox event", "op", "OutboxRepository.apply", "event_type", entry.eventType, "file_id", entry.fileID.Hex(), "error", err)
+		}
+		return nil
+	}
+
+	session, err := r.client.StartSession()
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to start session", "op", "OutboxRepository.apply", "error", err)
+		return apperrors.Database(err)
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (any, error) {
+		entry, err := change(sc)
+		if err != nil || entry == nil {
+			return nil, err
+		}
+		return nil, r.record(sc, entry)
+	})
+	var appErr *apperrors.Error
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Transaction failed", "op", "OutboxRepository.apply", "error", err)
+		return apperrors.Database(err)
+	}
+	return nil
+}
+
+// supportsTransactions asks the server once whether it is part of a
+// replica set or sharded cluster. Until the server answers, changes are
+// written without a transaction.
+func (r *OutboxRepository) supportsTransactions(ctx context.Context) bool {
+	switch r.transactions.Load() {
+	case 1:
+		return true
+	case -1:
+		return false
+	}
+
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	if err := r.client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return false
+	}
+	if hello.SetName != "" || hello.Msg == "isdbgrid" {
+		r.transactions.Store(1)
+		return true
+	}
+	r.transactions.Store(-1)
+	slog.WarnContext(ctx, "MongoDB is standalone; outbox events are written without transactions", "op", "OutboxRepository")
+	return false
+}
+
+// record writes an event with its data as the JSON payload, taking the
+// file's next sequence number.
+func (r *OutboxRepository) record(ctx context.Context, entry *outboxEntry) error {
+	eventType, fileID := entry.eventType, entry.fileID
+	payload, err := json.Marshal(entry.data)
+	if err != nil {
+		return apperrors.Wrap(apperrors.ErrInternal, err, "")
+	}
+
+	var sequence struct {
+		Seq int64 `bson:"seq"`
+	}
+	err = r.sequences.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": fileID},
+		bson.M{"$inc": bson.M{"seq": 1}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&sequence)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to take sequence for file", "op", "OutboxRepository.record", "file_id", fileID.Hex(), "error", err)
+		return apperrors.Database(err)
+	}
+
+	event := models.OutboxEvent{
+		ID:        primitive.NewObjectID(),
+		Type:      eventType,
+		FileID:    fileID,
+		UserID:    entry.userID,
+		Sequence:  sequence.Seq,
+		Payload:   string(payload),
+		CreatedAt: time.Now(),
+	}
+	if _, err := r.events.InsertOne(ctx, event); err != nil {
+		slog.ErrorContext(ctx, "Failed to insert event for file", "op", "OutboxRepository.record", "event_type", eventType, "file_id", fileID.Hex(), "error", err)
+		return apperrors.Database(err)
+	}
+	return nil
+}
+
+// Pending returns the oldest unpublished events.
+func (r *OutboxRepository) Pending(ctx context.Context, limit int) ([]models.OutboxEvent, error) {
+	cursor, err := r.events.Find(ctx, bson.M{"published_at": nil}, options.Find().
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetLimit(int64(limit)))
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to fetch events", "op", "OutboxRepository.Pending", "error", err)
+		return nil, apperrors.Database(err)
+	}
+	defer cursor.Close(ctx)
+
+	var events []models.OutboxEvent
+	if err := cursor.All(ctx, &events); err != nil {
+		slog.ErrorContext(ctx, "Failed to decode events", "op", "OutboxRepository.Pending", "error", err)
+		return nil, apperrors.Database(err)
+	}
+	return events, nil
+}
+
+// PublishedSequences returns the sequence number of the last event
+// published for each of the given files. Files with nothing published yet
+// are left out.
+func (r *OutboxRepository) PublishedSequences(ctx context.Context, fileIDs []primitive.ObjectID) (map[primitive.ObjectID]int64, error) {
+	cursor, err := r.sequences.Find(ctx, bson.M{"_id": bson.M{"$in": fileIDs}})
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to fetch sequences", "op", "OutboxRepository.PublishedSequences", "error", err)
+		return nil, apperrors.Database(err)
+	}
+	defer cursor.Close(ctx)
+
+	var docs []struct {
+		FileID    primitive.ObjectID `bson:"_id"`
+		Published int64              `bson:"published"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		slog.ErrorContext(ctx, "Failed to decode sequences", "op", "OutboxRepository.PublishedSequences", "error", err)
+		return nil, apperrors.Database(err)
+	}
+	published := make(map[primitive.ObjectID]int64, len(docs))
+	for _, doc := range docs {
+		published[doc.FileID] = doc.Published
+	}
+	return published, nil
+}
+
+// MarkPublished records that an event has been published.
+func (r *OutboxRepository) MarkPublished(ctx context.Context, event *models.OutboxEvent) error {
+	now := time.Now()
+	if _, err := r.events.UpdateOne(ctx, bson.M{"_id": event.ID}, bson.M{"$set": bson.M{"published_at": now}}); err != nil {
+		slog.ErrorContext(ctx, "Failed to update event", "op", "OutboxRepository.MarkPublished", "event_id", event.ID.Hex(), "error", err)
+		return apperrors.Database(err)
+	}
+	_, err := r.sequences.UpdateOne(ctx, bson.M{"_id": event.FileID}, bson.M{"$max": bson.M{"published": event.Sequence}})
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to update sequence of file", "op", "OutboxRepository.MarkPublished", "file_id", event.FileID.Hex(), "error", err)
+		return apperrors.Database(err)
+	}
+	return nil
+}
+
+// MarkFailed records a failed attempt to publish an event.
+func (r *OutboxRepository) MarkFailed(ctx context.Context, id primitive.ObjectID, message string) error {
+	_, err := r.events.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$inc": bson.M{"attempts": 1},
+		"$set": bson.M{"last_error": message},
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to update event", "op", "OutboxRepository.MarkFailed", "event_id", id.Hex(), "error", err)
+		return apperrors.Database(err)
+	}
+	return nil
+}
+
+// AcquireLease takes or renews the relay lease for owner until ttl from
+// now. It reports false while another owner holds an unexpired lease.
+func (r *OutboxRepository) AcquireLease(ctx context.Context, owner string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	_, err := r.leases.UpdateOne(
+		ctx,
+		bson.M{"_id": relayLease, "$or": bson.A{
+			bson.M{"owner": owner},
+			bson.M{"expires_at": bson.M{"$lt": now}},
+		}},
+		bson.M{"$set": bson.M{"owner": owner, "expires_at": now.Add(ttl)}},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		// Another owner holds the lease, so the upsert collided with it
+		return false, nil
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to take relay lease", "op", "OutboxRepository.AcquireLease", "error", err)
+		return false, apperrors.Database(err)
+	}
+	return true, nil
+}
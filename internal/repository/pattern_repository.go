@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"user-service/internal/apperrors"
+	"user-service/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type PatternRepository struct {
+	collection *mongo.Collection
+}
+
+func NewPatternRepository(db *mongo.Database) *PatternRepository {
+	return &PatternRepository{
+		collection: db.Collection("file_patterns"),
+	}
+}
+
+// EnsureIndexes creates the unique file_id index; each file has one set of
+// patterns, replaced whenever the file is analyzed again.
+func (r *PatternRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "file_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// Save stores the patterns of a file, replacing any stored earlier.
+func (r *PatternRepository) Save(ctx context.Context, patterns *models.FilePatterns) error {
+	_, err := r.collection.ReplaceOne(ctx, bson.M{"file_id": patterns.FileID}, patterns, options.Replace().SetUpsert(true))
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to save patterns for file", "op", "PatternRepository.Save", "file_id", patterns.FileID.Hex(), "error", err)
+		return apperrors.Database(err)
+	}
+	return nil
+}
+
+// GetByFile returns the patterns of a file, or nil when none have been mined
+// yet.
+func (r *PatternRepository) GetByFile(ctx context.Context, fileID primitive.ObjectID) (*models.FilePatterns, error) {
+	var patterns models.FilePatterns
+	err := r.collection.FindOne(ctx, bson.M{"file_id": fileID}).Decode(&patterns)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to fetch patterns for file", "op", "PatternRepository.GetByFile", "file_id", fileID.Hex(), "error", err)
+		return nil, apperrors.Database(err)
+	}
+	return &patterns, nil
+}
+
+func (r *PatternRepository) DeleteByFile(ctx context.Context, fileID primitive.ObjectID) error {
+	if _, err := r.collection.DeleteOne(ctx, bson.M{"file_id": fileID}); err != nil {
+		slog.ErrorContext(ctx, "Failed to delete patterns for file", "op", "PatternRepository.DeleteByFile", "file_id", fileID.Hex(), "error", err)
+		return apperrors.Database(err)
+	}
+	return nil
+}
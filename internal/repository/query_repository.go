@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+	"user-service/internal/apperrors"
+	"user-service/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var errQueryNotFound = apperrors.New(apperrors.ErrNotFound, "saved query not found")
+
+type SavedQueryRepository struct {
+	collection *mongo.Collection
+}
+
+func NewSavedQueryRepository(db *mongo.Database) *SavedQueryRepository {
+	return &SavedQueryRepository{
+		collection: db.Collection("saved_queries"),
+	}
+}
+
+// EnsureIndexes creates the index used to list a user's queries and to find
+// the ones to run against a file.
+func (r *SavedQueryRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: 1}},
+	})
+	return err
+}
+
+func (r *SavedQueryRepository) Create(ctx context.Context, query *models.SavedQuery) error {
+	query.ID = primitive.NewObjectID()
+	query.CreatedAt = time.Now()
+	query.UpdatedAt = query.CreatedAt
+
+	if _, err := r.collection.InsertOne(ctx, query); err != nil {
+		slog.ErrorContext(ctx, "Failed to insert query", "op", "SavedQueryRepository.Create", "error", err)
+		return apperrors.Database(err)
+	}
+	return nil
+}
+
+func (r *SavedQueryRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.SavedQuery, error) {
+	var query models.SavedQuery
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&query)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, errQueryNotFound
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to fetch query", "op", "SavedQueryRepository.GetByID", "query_id", id.Hex(), "error", err)
+		return nil, apperrors.Database(err)
+	}
+	return &query, nil
+}
+
+// ListByUser returns a user's queries, oldest first.
+func (r *SavedQueryRepository) ListByUser(ctx context.Context, userID uint) ([]models.SavedQuery, error) {
+	return r.find(ctx, "ListByUser", bson.M{"user_id": userID})
+}
+
+// CountByUser returns the number of queries a user has saved.
+func (r *SavedQueryRepository) CountByUser(ctx context.Context, userID uint) (int64, error) {
+	n, err := r.collection.CountDocuments(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to count queries for user", "op", "SavedQueryRepository.CountByUser", "user_id", userID, "error", err)
+		return 0, apperrors.Database(err)
+	}
+	return n, nil
+}
+
+// FindMatching returns a user's enabled queries whose filter selects a file
+// in the given format with the given tags: queries without a format or with
+// the file's format, whose tags are all among the file's.
+func (r *SavedQueryRepository) FindMatching(ctx context.Context, userID uint, format models.LogFormat, tags []string) ([]models.SavedQuery, error) {
+	if tags == nil {
+		tags = []string{}
+	}
+	return r.find(ctx, "FindMatching", bson.M{
+		"user_id":       userID,
+		"enabled":       true,
+		"filter.format": bson.M{"$in": bson.A{nil, "", format}},
+		"filter.tags":   bson.M{"$not": bson.M{"$elemMatch": bson.M{"$nin": tags}}},
+	})
+}
+
+func (r *SavedQueryRepository) find(ctx context.Context, method string, filter bson.M) ([]models.SavedQuery, error) {
+	cursor, err := r.collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to fetch queries", "op", "SavedQueryRepository."+method, "error", err)
+		return nil, apperrors.Database(err)
+	}
+	defer cursor.Close(ctx)
+
+	queries := []models.SavedQuery{}
+	if err := cursor.All(ctx, &queries); err != nil {
+		slog.ErrorContext(ctx, "Failed to decode queries", "op", "SavedQueryRepository."+method, "error", err)
+		return nil, apperrors.Database(err)
+	}
+	return queries, nil
+}
+
+// Update replaces a stored query, keeping its owner and creation time.
+func (r *SavedQueryRepository) Update(ctx context.Context, query *models.SavedQuery) error {
+	query.UpdatedAt = time.Now()
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": query.ID}, bson.M{"$set": bson.M{
+		"name":        query.Name,
+		"query":       query.Query,
+		"regex":       query.Regex,
+		"ignore_case": query.IgnoreCase,
+		"filter":      query.Filter,
+		"threshold":   query.Threshold,
+		"enabled":     query.Enabled,
+		"updated_at":  query.UpdatedAt,
+	}})
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to update query", "op", "SavedQueryRepository.Update", "query_id", query.ID.Hex(), "error", err)
+		return apperrors.Database(err)
+	}
+	if result.MatchedCount == 0 {
+		return errQueryNotFound
+	}
+	return nil
+}
+
+func (r *SavedQueryRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to delete query", "op", "SavedQueryRepository.Delete", "query_id", id.Hex(), "error", err)
+		return apperrors.Database(err)
+	}
+	if result.DeletedCount == 0 {
+		return errQueryNotFound
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+	"user-service/internal/apperrors"
+	"user-service/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type QuotaRepository struct {
+	collection *mongo.Collection
+}
+
+func NewQuotaRepository(db *mongo.Database) *QuotaRepository {
+	return &QuotaRepository{
+		collection: db.Collection("quotas"),
+	}
+}
+
+// EnsureIndexes creates the unique user_id index that keeps usage upserts
+// from producing duplicate quota documents.
+func (r *QuotaRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// Get returns the quota document for a user. Users without a document get a
+// zero-usage quota with no overrides.
+func (r *QuotaRepository) Get(ctx context.Context, userID uint) (*models.UserQuota, error) {
+	var quota models.UserQuota
+	err := r.collection.FindOne(ctx, bson.M{"user_id": userID}).Decode(&quota)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return &models.UserQuota{UserID: userID}, nil
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to fetch quota for user", "op", "QuotaRepository.Get", "user_id", userID, "error", err)
+		return nil, apperrors.Database(err)
+	}
+	return &quota, nil
+}
+
+// SetLimits stores a user's quota overrides, creating the quota document if
+// needed. A nil limit removes the override.
+func (r *QuotaRepository) SetLimits(ctx context.Context, userID uint, maxBytes, maxFiles *int64) (*models.UserQuota, error) {
+	set := bson.M{"updated_at": time.Now()}
+	unset := bson.M{}
+	for field, limit := range map[string]*int64{"max_bytes": maxBytes, "max_files": maxFiles} {
+		if limit != nil {
+			set[field] = *limit
+		} else {
+			unset[field] = ""
+		}
+	}
+	update := bson.M{
+		"$set":         set,
+		"$setOnInsert": bson.M{"used_bytes": int64(0), "used_files": int64(0)},
+	}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	var quota models.UserQuota
+	err := r.collection.FindOneAndUpdate(ctx, bson.M{"user_id": userID}, update, options.FindOneAndUpdate().
+		SetUpsert(true).
+		SetReturnDocument(options.After)).Decode(&quota)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to set quota limits for user", "op", "QuotaRepository.SetLimits", "user_id", userID, "error", err)
+		return nil, apperrors.Database(err)
+	}
+	return &quota, nil
+}
+
+// Reserve atomically adds bytes and files to the user's usage as long as the
+// result stays within the per-user overrides, or the given defaults when no
+// override is stored. A limit of 0 means unlimited. It reports false when the
+// reservation would exceed the quota.
+func (r *QuotaRepository) Reserve(ctx context.Context, userID uint, bytes, files, defaultMaxBytes, defaultMaxFiles int64) (bool, error) {
+	now := time.Now()
+
+	// Make sure the usage document exists so the conditional update below
+	// has something to match against.
+	_, err := r.collection.UpdateOne(
+		ctx,
+		bson.M{"user_id": userID},
+		bson.M{"$setOnInsert": bson.M{
+			"user_id":    userID,
+			"used_bytes": int64(0),
+			"used_files": int64(0),
+			"updated_at": now,
+		}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to initialize quota for user", "op", "QuotaRepository.Reserve", "user_id", userID, "error", err)
+		return false, apperrors.Database(err)
+	}
+
+	result, err := r.collection.UpdateOne(
+		ctx,
+		bson.M{
+			"user_id": userID,
+			"$expr": bson.M{"$and": bson.A{
+				withinLimit("$used_bytes", "$max_bytes", bytes, defaultMaxBytes),
+				withinLimit("$used_files", "$max_files", files, defaultMaxFiles),
+			}},
+		},
+		bson.M{
+			"$inc": bson.M{"used_bytes": bytes, "used_files": files},
+			"$set": bson.M{"updated_at": now},
+		},
+	)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to reserve quota for user", "op", "QuotaRepository.Reserve", "user_id", userID, "error", err)
+		return false, apperrors.Database(err)
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// Release gives bytes and files back to the user's quota, never letting usage
+// drop below zero.
+func (r *QuotaRepository) Release(ctx context.Context, userID uint, bytes, files int64) error {
+	_, err := r.collection.UpdateOne(
+		ctx,
+		bson.M{"user_id": userID},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{
+			"used_bytes": bson.M{"$max": bson.A{0, bson.M{"$subtract": bson.A{"$used_bytes", bytes}}}},
+			"used_files": bson.M{"$max": bson.A{0, bson.M{"$subtract": bson.A{"$used_files", files}}}},
+			"updated_at": time.Now(),
+		}}}},
+	)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to release quota for user", "op", "QuotaRepository.Release", "user_id", userID, "error", err)
+		return apperrors.Database(err)
+	}
+	return nil
+}
+
+// withinLimit builds an aggregation expression that is true when used+delta
+// fits under the stored override, falling back to the default limit.
+func withinLimit(usedField, limitField string, delta, defaultLimit int64) bson.M {
+	limit := bson.M{"$ifNull": bson.A{limitField, defaultLimit}}
+	return bson.M{"$or": bson.A{
+		bson.M{"$lte": bson.A{limit, 0}},
+		bson.M{"$lte": bson.A{bson.M{"$add": bson.A{usedField, delta}}, limit}},
+	}}
+}
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"log/slog"
+	"time"
+	"user-service/internal/apperrors"
+	"user-service/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type SearchIndexRepository struct {
+	collection *mongo.Collection
+}
+
+func NewSearchIndexRepository(db *mongo.Database) *SearchIndexRepository {
+	return &SearchIndexRepository{
+		collection: db.Collection("search_index"),
+	}
+}
+
+// EnsureIndexes creates the multikey term index used by searches and the
+// file index used to drop a file's entries.
+func (r *SearchIndexRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "terms", Value: 1}}},
+		{Keys: bson.D{{Key: "file_id", Value: 1}}},
+	})
+	return err
+}
+
+func (r *SearchIndexRepository) Insert(ctx context.Context, chunk *models.IndexChunk) error {
+	if _, err := r.collection.InsertOne(ctx, chunk); err != nil {
+		slog.ErrorContext(ctx, "Failed to insert chunk for file", "op", "SearchIndexRepository.Insert", "file_id", chunk.FileID.Hex(), "error", err)
+		return apperrors.Database(err)
+	}
+	return nil
+}
+
+// DeleteByFile removes every index entry of a file.
+func (r *SearchIndexRepository) DeleteByFile(ctx context.Context, fileID primitive.ObjectID) error {
+	result, err := r.collection.DeleteMany(ctx, bson.M{"file_id": fileID})
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to delete entries for file", "op", "SearchIndexRepository.DeleteByFile", "file_id", fileID.Hex(), "error", err)
+		return apperrors.Database(err)
+	}
+	slog.DebugContext(ctx, "Deleted index entries", "op", "SearchIndexRepository.DeleteByFile", "deleted", result.DeletedCount, "file_id", fileID.Hex())
+	return nil
+}
+
+// Find returns up to limit chunks of the given files that contain all of
+// terms, most recent first. When from or to is set only chunks with
+// timestamps overlapping the range are returned. Terms are not loaded.
+func (r *SearchIndexRepository) Find(ctx context.Context, userID uint, fileIDs []primitive.ObjectID, terms []string, from, to time.Time, limit int64) ([]models.IndexChunk, error) {
+	query := bson.M{
+		"user_id": userID,
+		"file_id": bson.M{"$in": fileIDs},
+		"terms":   bson.M{"$all": terms},
+	}
+	if !from.IsZero() {
+		query["last_timestamp"] = bson.M{"$gte": from}
+	}
+	if !to.IsZero() {
+		query["first_timestamp"] = bson.M{"$lte": to}
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "last_timestamp", Value: -1}, {Key: "_id", Value: -1}}).
+		SetProjection(bson.M{"terms": 0}).
+		SetLimit(limit)
+	cursor, err := r.collection.Find(ctx, query, opts)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to search index", "op", "SearchIndexRepository.Find", "error", err)
+		return nil, apperrors.Database(err)
+	}
+	defer cursor.Close(ctx)
+
+	var chunks []models.IndexChunk
+	if err := cursor.All(ctx, &chunks); err != nil {
+		slog.ErrorContext(ctx, "Failed to decode chunks", "op", "SearchIndexRepository.Find", "error", err)
+		return nil, apperrors.Database(err)
+	}
+	return chunks, nil
+}
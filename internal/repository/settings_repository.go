@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"user-service/internal/apperrors"
+	"user-service/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type SettingsRepository struct {
+	collection *mongo.Collection
+}
+
+func NewSettingsRepository(db *mongo.Database) *SettingsRepository {
+	return &SettingsRepository{
+		collection: db.Collection("user_settings"),
+	}
+}
+
+// EnsureIndexes creates the unique user_id index; each user has at most one
+// settings document.
+func (r *SettingsRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// Get returns the settings of a user. Users without a document get empty
+// settings.
+func (r *SettingsRepository) Get(ctx context.Context, userID uint) (*models.UserSettings, error) {
+	var settings models.UserSettings
+	err := r.collection.FindOne(ctx, bson.M{"user_id": userID}).Decode(&settings)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return &models.UserSettings{UserID: userID}, nil
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to fetch settings for user", "op", "SettingsRepository.Get", "user_id", userID, "error", err)
+		return nil, apperrors.Database(err)
+	}
+	return &settings, nil
+}
+
+// Save stores the settings of a user, replacing any stored earlier.
+func (r *SettingsRepository) Save(ctx context.Context, settings *models.UserSettings) error {
+	_, err := r.collection.ReplaceOne(ctx, bson.M{"user_id": settings.UserID}, settings, options.Replace().SetUpsert(true))
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to save settings for user", "op", "SettingsRepository.Save", "user_id", settings.UserID, "error", err)
+		return apperrors.Database(err)
+	}
+	return nil
+}
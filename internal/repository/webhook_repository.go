@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+	"user-service/internal/apperrors"
+	"user-service/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var errWebhookNotFound = apperrors.New(apperrors.ErrNotFound, "webhook not found")
+
+type WebhookRepository struct {
+	collection *mongo.Collection
+}
+
+func NewWebhookRepository(db *mongo.Database) *WebhookRepository {
+	return &WebhookRepository{
+		collection: db.Collection("webhooks"),
+	}
+}
+
+// EnsureIndexes creates the index used to find a user's webhooks for an
+// event.
+func (r *WebhookRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "events", Value: 1}},
+	})
+	return err
+}
+
+func (r *WebhookRepository) Create(ctx context.Context, webhook *models.Webhook) error {
+	webhook.ID = primitive.NewObjectID()
+	webhook.CreatedAt = time.Now()
+	webhook.UpdatedAt = webhook.CreatedAt
+
+	if _, err := r.collection.InsertOne(ctx, webhook); err != nil {
+		slog.ErrorContext(ctx, "Failed to insert webhook", "op", "WebhookRepository.Create", "error", err)
+		return apperrors.Database(err)
+	}
+	return nil
+}
+
+func (r *WebhookRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.Webhook, error) {
+	var webhook models.Webhook
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&webhook)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, errWebhookNotFound
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to fetch webhook", "op", "WebhookRepository.GetByID", "webhook_id", id.Hex(), "error", err)
+		return nil, apperrors.Database(err)
+	}
+	return &webhook, nil
+}
+
+// ListByUser returns a user's webhooks, oldest first.
+func (r *WebhookRepository) ListByUser(ctx context.Context, userID uint) ([]models.Webhook, error) {
+	return r.find(ctx, "ListByUser", bson.M{"user_id": userID})
+}
+
+// FindSubscribed returns a user's enabled webhooks that receive an event
+// type.
+func (r *WebhookRepository) FindSubscribed(ctx context.Context, userID uint, eventType string) ([]models.Webhook, error) {
+	return r.find(ctx, "FindSubscribed", bson.M{"user_id": userID, "events": eventType, "enabled": true})
+}
+
+func (r *WebhookRepository) find(ctx context.Context, method string, filter bson.M) ([]models.Webhook, error) {
+	cursor, err := r.collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to fetch webhooks", "op", "WebhookRepository."+method, "error", err)
+		return nil, apperrors.Database(err)
+	}
+	defer cursor.Close(ctx)
+
+	webhooks := []models.Webhook{}
+	if err := cursor.All(ctx, &webhooks); err != nil {
+		slog.ErrorContext(ctx, "Failed to decode webhooks", "op", "WebhookRepository."+method, "error", err)
+		return nil, apperrors.Database(err)
+	}
+	return webhooks, nil
+}
+
+// CountByUser returns the number of webhooks a user has registered.
+func (r *WebhookRepository) CountByUser(ctx context.Context, userID uint) (int64, error) {
+	n, err := r.collection.CountDocuments(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to count webhooks for user", "op", "WebhookRepository.CountByUser", "user_id", userID, "error", err)
+		return 0, apperrors.Database(err)
+	}
+	return n, nil
+}
+
+// Update replaces a webhook's URL, events and enabled flag. The secret is
+// kept.
+func (r *WebhookRepository) Update(ctx context.Context, webhook *models.Webhook) error {
+	webhook.UpdatedAt = time.Now()
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": webhook.ID}, bson.M{"$set": bson.M{
+		"url":        webhook.URL,
+		"events":     webhook.Events,
+		"enabled":    webhook.Enabled,
+		"updated_at": webhook.UpdatedAt,
+	}})
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to update webhook", "op", "WebhookRepository.Update", "webhook_id", webhook.ID.Hex(), "error", err)
+		return apperrors.Database(err)
+	}
+	if result.MatchedCount == 0 {
+		return errWebhookNotFound
+	}
+	return nil
+}
+
+func (r *WebhookRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to delete webhook", "op", "WebhookRepository.Delete", "webhook_id", id.Hex(), "error", err)
+		return apperrors.Database(err)
+	}
+	if result.DeletedCount == 0 {
+		return errWebhookNotFound
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+// Package search finds the lines of a log file that match a literal or RE2
+// regular expression query, with grep-style context lines.
+package search
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"user-service/internal/preview"
+)
+
+const (
+	// MaxPatternLength is the longest accepted query.
+	MaxPatternLength = 1024
+
+	// MaxContext is the largest number of context lines around a match.
+	MaxContext = 10
+
+	// MaxLineLength is the number of bytes of each line that are searched
+	// and returned. Longer lines are cut and marked as truncated.
+	MaxLineLength = 64 * 1024
+
+	// maxSubmatches caps the match positions reported for one line.
+	maxSubmatches = 100
+
+	readBufferSize = 64 * 1024
+)
+
+// Result types.
+const (
+	ResultMatch   = "match"
+	ResultContext = "context"
+	ResultSummary = "summary"
+)
+
+// Query describes a search.
+type Query struct {
+	Pattern    string
+	Regex      bool
+	IgnoreCase bool
+	Context    int
+	MaxMatches int
+}
+
+// Result is a matching line or a context line around one.
+type Result struct {
+	Type string `json:"type"`
+	Line int64  `json:"line"`
+
+	// Offset is the byte offset of the start of the line in the file.
+	Offset int64  `json:"offset"`
+	Text   string `json:"text"`
+
+	// Submatches are the [start, end) byte ranges of the matches in Text.
+	Submatches [][]int `json:"submatches,omitempty"`
+	Truncated  bool    `json:"truncated,omitempty"`
+}
+
+// Summary reports how a search ended.
+type Summary struct {
+	Type         string `json:"type"`
+	Matches      int64  `json:"matches"`
+	LinesScanned int64  `json:"lines_scanned"`
+	BytesScanned int64  `json:"bytes_scanned"`
+
+	// LimitReached is set when more matches exist than MaxMatches.
+	LimitReached bool `json:"limit_reached"`
+
+	// TimedOut is set when the search ran out of time before reaching the
+	// end of the file.
+	TimedOut bool `json:"timed_out"`
+}
+
+// Compile validates a query and compiles it to a regular expression. Literal
+// queries are quoted, so both kinds run on the linear-time RE2 engine.
+func Compile(q Query) (*regexp.Regexp, error) {
+	switch {
+	case q.Pattern == "":
+		return nil, errors.New("query must not be empty")
+	case len(q.Pattern) > MaxPatternLength:
+		return nil, fmt.Errorf("query must be at most %d bytes", MaxPatternLength)
+	case q.Context < 0 || q.Context > MaxContext:
+		return nil, fmt.Errorf("context must be between 0 and %d", MaxContext)
+	case q.MaxMatches <= 0:
+		return nil, errors.New("max_matches must be positive")
+	}
+
+	pattern := q.Pattern
+	if !q.Regex {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if q.IgnoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression: %v", err)
+	}
+	return re, nil
+}
+
+// Search scans r line by line and calls fn with each matching line and the
+// context lines around it, in file order. Lines are decoded from encoding
+// before matching. The scan stops early once MaxMatches lines have matched
+// and another match is found, or with ctx's error when ctx is done.
+func Search(ctx context.Context, r io.Reader, re *regexp.Regexp, q Query, encoding string, fn func(Result) error) (*Summary, error) {
+	reader := bufio.NewReaderSize(r, readBufferSize)
+	summary := &Summary{Type: ResultSummary}
+
+	// before holds up to q.Context lines preceding the next match; after
+	// counts the context lines still owed to the last one
+	var before []Result
+	after := 0
+
+	var current []byte
+	truncated := false
+	var lineOffset, number int64
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		summary.BytesScanned += int64(len(chunk))
+		if !truncated {
+			if room := MaxLineLength - len(current); len(chunk) > room {
+				chunk, truncated = chunk[:room], true
+			}
+			current = append(current, chunk...)
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil && err != io.EOF {
+			return summary, err
+		}
+		if len(current) == 0 && err == io.EOF {
+			return summary, nil
+		}
+
+		number++
+		summary.LinesScanned = number
+		if number%1000 == 0 {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return summary, ctxErr
+			}
+		}
+
+		raw := bytes.TrimSuffix(bytes.TrimSuffix(current, []byte("\n")), []byte("\r"))
+		if number == 1 {
+			raw = bytes.TrimPrefix(raw, []byte("\xef\xbb\xbf"))
+		}
+		line := Result{Line: number, Offset: lineOffset, Text: preview.Decode(raw, encoding), Truncated: truncated}
+
+		if submatches := re.FindAllStringIndex(line.Text, maxSubmatches); submatches != nil {
+			if summary.Matches >= int64(q.MaxMatches) {
+				summary.LimitReached = true
+				return summary, nil
+			}
+			for _, preceding := range before {
+				if err := fn(preceding); err != nil {
+					return summary, err
+				}
+			}
+			before = before[:0]
+
+			line.Type, line.Submatches = ResultMatch, submatches
+			if err := fn(line); err != nil {
+				return summary, err
+			}
+			summary.Matches++
+			after = q.Context
+		} else if after > 0 {
+			line.Type = ResultContext
+			if err := fn(line); err != nil {
+				return summary, err
+			}
+			after--
+		} else if q.Context > 0 {
+			line.Type = ResultContext
+			if len(before) == q.Context {
+				before = append(before[:0], before[1:]...)
+			}
+			before = append(before, line)
+		}
+
+		if err == io.EOF {
+			return summary, nil
+		}
+		lineOffset = summary.BytesScanned
+		current, truncated = current[:0], false
+	}
+}
@@ -0,0 +1,293 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+	"user-service/internal/analysis"
+	"user-service/internal/index"
+	"user-service/internal/models"
+	"user-service/internal/parser"
+	"user-service/internal/patterns"
+	"user-service/internal/preview"
+	"user-service/internal/repository"
+	"user-service/pkg/storage"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AnalysisConfig controls the analysis worker pool.
+type AnalysisConfig struct {
+	// Workers is the number of files analyzed concurrently.
+	Workers int
+
+	// QueueSize is the number of files that can wait for a worker.
+	QueueSize int
+
+	// SampleLines is the number of lines sampled for format detection.
+	SampleLines int
+
+	// SweepInterval is how often files stuck in the analyzing status are
+	// re-queued, and how long a file must have been waiting to count as stuck.
+	SweepInterval time.Duration
+}
+
+// AnalysisService runs the post-upload analysis pipeline on a pool of
+// background workers.
+type AnalysisService struct {
+	repo     *repository.FileRepository
+	index    *repository.SearchIndexRepository
+	patterns *repository.PatternRepository
+	storage  storage.Storage
+	config   AnalysisConfig
+	queue    chan primitive.ObjectID
+
+	// inFlight holds IDs that are queued or being analyzed so the sweeper
+	// doesn't queue them twice.
+	inFlight sync.Map
+
+	onComplete []func(ctx context.Context, id primitive.ObjectID)
+}
+
+func NewAnalysisService(repo *repository.FileRepository, index *repository.SearchIndexRepository, patterns *repository.PatternRepository, storage storage.Storage, config AnalysisConfig) *AnalysisService {
+	if config.Workers <= 0 {
+		config.Workers = 1
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = 100
+	}
+	if config.SampleLines <= 0 {
+		config.SampleLines = 200
+	}
+	if config.SweepInterval <= 0 {
+		config.SweepInterval = 5 * time.Minute
+	}
+	return &AnalysisService{
+		repo:     repo,
+		index:    index,
+		patterns: patterns,
+		storage:  storage,
+		config:   config,
+		queue:    make(chan primitive.ObjectID, config.QueueSize),
+	}
+}
+
+// maxStoredPatterns is the number of most frequent templates stored per file.
+const maxStoredPatterns = 100
+
+// Start launches the workers and the sweeper. They stop when ctx is done.
+func (s *AnalysisService) Start(ctx context.Context) {
+	slog.InfoContext(ctx, "Starting analysis workers", "op", "AnalysisService.Start", "workers", s.config.Workers)
+	for i := 0; i < s.config.Workers; i++ {
+		go s.worker(ctx)
+	}
+	go s.sweep(ctx)
+}
+
+// OnComplete adds a function called with the ID of each file whose analysis
+// has been stored. Functions must be added before Start.
+func (s *AnalysisService) OnComplete(fn func(ctx context.Context, id primitive.ObjectID)) {
+	s.onComplete = append(s.onComplete, fn)
+}
+
+// Enqueue queues a file for analysis. When the queue is full the file is left
+// in the analyzing status and picked up by the next sweep.
+func (s *AnalysisService) Enqueue(id primitive.ObjectID) {
+	if _, queued := s.inFlight.LoadOrStore(id, struct{}{}); queued {
+		return
+	}
+	select {
+	case s.queue <- id:
+		slog.Debug("Queued file for analysis", "op", "AnalysisService.Enqueue", "file_id", id.Hex())
+	default:
+		s.inFlight.Delete(id)
+		slog.Warn("Queue full, deferring analysis of file", "op", "AnalysisService.Enqueue", "file_id", id.Hex())
+	}
+}
+
+// QueueLength returns the number of files waiting for a worker.
+func (s *AnalysisService) QueueLength() int {
+	return len(s.queue)
+}
+
+// QueueCapacity returns the number of files that can wait for a worker.
+func (s *AnalysisService) QueueCapacity() int {
+	return cap(s.queue)
+}
+
+func (s *AnalysisService) worker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-s.queue:
+			// A file that changed while it was analyzed, such as by an
+			// append whose Enqueue found it in flight, is analyzed again
+			for s.process(ctx, id) && ctx.Err() == nil {
+			}
+			s.inFlight.Delete(id)
+		}
+	}
+}
+
+// sweep periodically re-queues files that have been analyzing for longer than
+// the sweep interval, including files left over from a previous process.
+func (s *AnalysisService) sweep(ctx context.Context) {
+	ticker := time.NewTicker(s.config.SweepInterval)
+	defer ticker.Stop()
+
+	for {
+		ids, err := s.repo.GetStaleAnalyzing(ctx, time.Now().Add(-s.config.SweepInterval))
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to fetch stale files", "op", "AnalysisService.sweep", "error", err)
+		}
+		for _, id := range ids {
+			s.Enqueue(id)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// process analyzes a file and stores the results. It reports whether the
+// file moved on to a newer version meanwhile, so the results were dropped
+// and the file must be analyzed again.
+func (s *AnalysisService) process(ctx context.Context, id primitive.ObjectID) bool {
+	slog.InfoContext(ctx, "Analyzing file", "op", "AnalysisService.process", "file_id", id.Hex())
+
+	file, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to fetch file", "op", "AnalysisService.process", "error", err)
+		return false
+	}
+	if file.Status == models.FileStatusDeleted {
+		slog.InfoContext(ctx, "File was deleted, skipping analysis", "file_id", id.Hex(), "op", "AnalysisService.process")
+		return false
+	}
+
+	format, err := s.detectFormat(ctx, file)
+	if err != nil {
+		slog.WarnContext(ctx, "Format detection failed", "op", "AnalysisService.process", "error", err)
+	}
+
+	result, err := s.analyze(ctx, file)
+	if err != nil {
+		slog.WarnContext(ctx, "Analysis failed", "op", "AnalysisService.process", "error", err)
+		result = &models.FileAnalysis{Error: "analysis failed"}
+	}
+	// Parsers work on bytes, so binary and UTF-16 content is not parsed
+	if result.Error == "" && result.Encoding != analysis.EncodingBinary && preview.Ranged(result.Encoding) {
+		result.Parse, err = s.parse(ctx, file, format, result.Encoding)
+		if err != nil {
+			slog.WarnContext(ctx, "Parsing failed", "op", "AnalysisService.process", "error", err)
+		}
+	}
+	result.CompletedAt = time.Now()
+
+	err = s.repo.CompleteAnalysis(ctx, id, file.Version, result, format)
+	if errors.Is(err, repository.ErrFileChanged) {
+		slog.InfoContext(ctx, "File changed during analysis, analyzing again", "op", "AnalysisService.process", "file_id", id.Hex(), "version", file.Version)
+		return true
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to store analysis", "op", "AnalysisService.process", "error", err)
+		return false
+	}
+	slog.InfoContext(ctx, "Analysis complete", "op", "AnalysisService.process", "file_id", id.Hex(), "lines", result.LineCount, "bytes", result.ByteCount, "encoding", result.Encoding)
+
+	for _, fn := range s.onComplete {
+		fn(ctx, id)
+	}
+	return false
+}
+
+func (s *AnalysisService) analyze(ctx context.Context, file *models.File) (*models.FileAnalysis, error) {
+	reader, err := s.storage.DownloadFile(ctx, file.StorageKey)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return analysis.Analyze(ctx, reader)
+}
+
+// detectFormat classifies the file from a sample of its first lines.
+func (s *AnalysisService) detectFormat(ctx context.Context, file *models.File) (*models.FormatDetection, error) {
+	reader, err := s.storage.DownloadFile(ctx, file.StorageKey)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	format, err := analysis.DetectFormat(reader, s.config.SampleLines)
+	if err != nil {
+		return nil, err
+	}
+	slog.InfoContext(ctx, "Detected format", "op", "AnalysisService.detectFormat", "format", format.Format, "confidence", format.Confidence)
+	return format, nil
+}
+
+// parse runs every line of the file through the parser for its detected
+// format, rebuilds the file's search index entries and message templates
+// from the records and reports how many lines parsed cleanly.
+func (s *AnalysisService) parse(ctx context.Context, file *models.File, format *models.FormatDetection, encoding string) (*models.ParseStats, error) {
+	logFormat := models.LogFormatText
+	if format != nil {
+		logFormat = format.Format
+	}
+
+	// Entries from an earlier, interrupted analysis are replaced
+	if err := s.index.DeleteByFile(ctx, file.ID); err != nil {
+		return nil, err
+	}
+	builder := index.NewBuilder(file.ID, file.UserID, encoding, func(chunk *models.IndexChunk) error {
+		return s.index.Insert(ctx, chunk)
+	})
+	miner := patterns.NewMiner(patterns.Config{})
+
+	stats, err := parser.StreamFile(ctx, s.storage, file.StorageKey, logFormat, func(record parser.Record) error {
+		line := preview.Decode([]byte(record.Raw), encoding)
+		message := record.Message
+		if message == "" {
+			message = line
+		}
+		miner.Add(message, line, record.Timestamp)
+		return builder.Add(record)
+	})
+	if err == nil {
+		err = builder.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	mined := miner.Result(maxStoredPatterns)
+	mined.FileID, mined.UserID, mined.CompletedAt = file.ID, file.UserID, time.Now()
+	if err := s.patterns.Save(ctx, mined); err != nil {
+		return nil, err
+	}
+	slog.DebugContext(ctx, "Mined templates", "op", "AnalysisService.parse", "templates", mined.TemplateCount)
+	slog.InfoContext(ctx, "Parsed lines", "op", "AnalysisService.parse", "log_format", logFormat, "parsed", stats.Parsed, "failed", stats.Failed)
+	return stats, nil
+}
+
+// Patterns returns the message templates mined from a file, or nil when the
+// file has not been mined yet.
+func (s *AnalysisService) Patterns(ctx context.Context, id primitive.ObjectID) (*models.FilePatterns, error) {
+	return s.patterns.GetByFile(ctx, id)
+}
+
+// RemoveResults deletes the data derived from a file during analysis: its
+// search index entries and message templates.
+func (s *AnalysisService) RemoveResults(ctx context.Context, id primitive.ObjectID) error {
+	if err := s.index.DeleteByFile(ctx, id); err != nil {
+		return err
+	}
+	return s.patterns.DeleteByFile(ctx, id)
+}
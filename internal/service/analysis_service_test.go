@@ -0,0 +1,128 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+	"user-service/internal/models"
+	"user-service/internal/repository"
+	"user-service/pkg/storage"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// snapshotStorage hands out copies of a file's content, so reads don't see
+// later appends, and calls afterRead after the nth download.
+type snapshotStorage struct {
+	storage.Storage
+	reads     int
+	nth       int
+	afterRead func()
+}
+
+func (s *snapshotStorage) DownloadFile(ctx context.Context, fileName string) (io.ReadCloser, error) {
+	reader, err := s.Storage.DownloadFile(ctx, fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	if s.reads++; s.reads == s.nth {
+		s.afterRead()
+	}
+	return io.NopCloser(bytes.NewReader(content)), nil
+}
+
+func TestAnalysisRunsAgainAfterAppendDuringAnalysis(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("append", func(mt *mtest.T) {
+		local, err := storage.NewLocalStorage(storage.LocalStorageConfig{BaseDir: t.TempDir()})
+		if err != nil {
+			mt.Fatal(err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		key, err := local.UploadFile(ctx, strings.NewReader("first line\nsecond line\n"), "app.log", "text/plain")
+		if err != nil {
+			mt.Fatal(err)
+		}
+
+		id := primitive.NewObjectID()
+		var analyses *AnalysisService
+		store := &snapshotStorage{Storage: local, nth: 3}
+		// The file is appended to after the last read of the first analysis;
+		// the append's Enqueue finds the file in flight
+		store.afterRead = func() {
+			if _, err := local.AppendFile(ctx, key, []byte("third line\n")); err != nil {
+				mt.Error(err)
+			}
+			analyses.Enqueue(id)
+		}
+
+		files := repository.NewFileRepository(mt.DB, repository.NewOutboxRepository(mt.DB))
+		analyses = NewAnalysisService(files, repository.NewSearchIndexRepository(mt.DB), repository.NewPatternRepository(mt.DB), store, AnalysisConfig{})
+		done := make(chan struct{})
+		analyses.OnComplete(func(context.Context, primitive.ObjectID) { close(done) })
+
+		file := func(version int64) bson.D {
+			return mtest.CreateCursorResponse(0, "analyticsai.files", mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: id},
+				{Key: "user_id", Value: 1},
+				{Key: "storage_key", Value: key},
+				{Key: "status", Value: models.FileStatusActive},
+				{Key: "version", Value: version},
+			})
+		}
+		written := bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}}
+		mt.AddMockResponses(
+			// First analysis, of version 1: the results are dropped
+			file(1), written, written, written,
+			bson.D{{Key: "ok", Value: 1}, {Key: "isWritablePrimary", Value: true}},
+			bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: nil}},
+			mtest.CreateCursorResponse(0, "analyticsai.files", mtest.FirstBatch, bson.D{{Key: "n", Value: 1}}),
+			// Second analysis, of version 2 with the appended line
+			file(2), written, written, written,
+			bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: bson.D{{Key: "_id", Value: id}, {Key: "user_id", Value: 1}, {Key: "version", Value: int64(2)}}}},
+			// The outbox event's sequence number and the event
+			bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: bson.D{{Key: "_id", Value: id}, {Key: "seq", Value: int64(1)}}}},
+			written,
+		)
+
+		analyses.Enqueue(id)
+		go analyses.worker(ctx)
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			mt.Fatal("analysis was not stored")
+		}
+
+		var stored []bson.Raw
+		for _, event := range mt.GetAllStartedEvents() {
+			if event.CommandName == "findAndModify" && event.Command.Lookup("findAndModify").StringValue() == "files" {
+				stored = append(stored, event.Command)
+			}
+		}
+		if len(stored) != 2 {
+			mt.Fatalf("analysis stored %d times, want 2", len(stored))
+		}
+		for i, want := range []struct{ version, lines int64 }{{1, 2}, {2, 3}} {
+			version := stored[i].Lookup("query", "version").AsInt64()
+			lines := stored[i].Lookup("update").Array().Index(0).Value().Document().Lookup("$set", "analysis", "line_count").AsInt64()
+			if version != want.version || lines != want.lines {
+				mt.Errorf("analysis %d = %d lines at version %d, want %d lines at version %d", i+1, lines, version, want.lines, want.version)
+			}
+		}
+		if n := analyses.QueueLength(); n != 0 {
+			mt.Errorf("queue length = %d, want 0", n)
+		}
+	})
+}
@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+	"user-service/internal/apperrors"
+	"user-service/internal/models"
+	"user-service/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+
+	// maxChainAttempts bounds the retries of an append that lost the race
+	// for a sequence number to another instance.
+	maxChainAttempts = 5
+)
+
+// AuditService records audited requests and serves the audit log to
+// admins. With the hash chain enabled, each entry stores the hash of the
+// entry before it, so an entry that is changed, removed or reordered after
+// it was written shows up in Verify.
+type AuditService struct {
+	repo  *repository.AuditRepository
+	chain bool
+
+	// mu serializes chained appends within the instance, and head caches
+	// the last link this instance appended or read.
+	mu   sync.Mutex
+	head *models.AuditEntry
+}
+
+// NewAuditService returns an AuditService that links entries into a hash
+// chain when chain is set.
+func NewAuditService(repo *repository.AuditRepository, chain bool) *AuditService {
+	return &AuditService{repo: repo, chain: chain}
+}
+
+// Record appends an entry to the audit log.
+func (s *AuditService) Record(ctx context.Context, entry *models.AuditEntry) error {
+	entry.ID = primitive.NewObjectID()
+	// MongoDB keeps milliseconds, and the hash must cover the stored time
+	entry.Time = time.Now().UTC().Truncate(time.Millisecond)
+	if !s.chain {
+		_, err := s.repo.Insert(ctx, entry)
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for attempt := 0; attempt < maxChainAttempts; attempt++ {
+		if s.head == nil {
+			head, err := s.repo.LastChained(ctx)
+			if err != nil {
+				return err
+			}
+			s.head = head
+		}
+		entry.Seq, entry.PrevHash = 1, ""
+		if s.head != nil {
+			entry.Seq, entry.PrevHash = s.head.Seq+1, s.head.Hash
+		}
+		entry.Hash = hashAuditEntry(entry)
+
+		inserted, err := s.repo.Insert(ctx, entry)
+		if err != nil {
+			return err
+		}
+		if inserted {
+			head := *entry
+			s.head = &head
+			return nil
+		}
+		// Another instance appended first; link to its entry instead
+		s.head = nil
+	}
+	return apperrors.New(apperrors.ErrInternal, "failed to append to the audit chain")
+}
+
+// List returns the most recent entries matching req.
+func (s *AuditService) List(ctx context.Context, req models.AuditListRequest) ([]models.AuditEntry, error) {
+	if req.Limit == 0 {
+		req.Limit = defaultAuditLimit
+	}
+	if req.Limit < 0 || req.Limit > maxAuditLimit {
+		return nil, apperrors.New(apperrors.ErrInvalidRequest, fmt.Sprintf("limit must be between 1 and %d", maxAuditLimit))
+	}
+	if err := validateAuditFilter(req); err != nil {
+		return nil, err
+	}
+	return s.repo.List(ctx, req, req.Limit)
+}
+
+// Export writes every entry matching req as NDJSON, oldest first, to the
+// writer returned by open, which is only called once req is known to be
+// valid.
+func (s *AuditService) Export(ctx context.Context, req models.AuditListRequest, open func() io.Writer) error {
+	if err := validateAuditFilter(req); err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "Exporting audit entries", "op", "AuditService.Export")
+
+	encoder := json.NewEncoder(open())
+	return s.repo.Each(ctx, req, func(entry *models.AuditEntry) error {
+		return encoder.Encode(entry)
+	})
+}
+
+// Verify walks the hash chain and reports the first entry that does not
+// follow from the one before it.
+func (s *AuditService) Verify(ctx context.Context) (*models.AuditVerification, error) {
+	result := &models.AuditVerification{Valid: true}
+	var previous *models.AuditEntry
+	err := s.repo.EachChained(ctx, func(entry *models.AuditEntry) error {
+		wantSeq, wantPrev := int64(1), ""
+		if previous != nil {
+			wantSeq, wantPrev = previous.Seq+1, previous.Hash
+		}
+		switch {
+		case entry.Seq != wantSeq:
+			result.Reason = fmt.Sprintf("expected entry %d", wantSeq)
+		case entry.PrevHash != wantPrev:
+			result.Reason = "previous hash does not match the entry before it"
+		case entry.Hash != hashAuditEntry(entry):
+			result.Reason = "hash does not match the entry's contents"
+		default:
+			result.Entries++
+			previous = entry
+			return nil
+		}
+		result.Valid = false
+		result.BrokenAt = entry.Seq
+		return errChainBroken
+	})
+	if err != nil && !errors.Is(err, errChainBroken) {
+		return nil, err
+	}
+	if !result.Valid {
+		slog.WarnContext(ctx, "Audit chain broken", "op", "AuditService.Verify", "broken_at", result.BrokenAt, "reason", result.Reason)
+	}
+	return result, nil
+}
+
+// errChainBroken stops the walk over the chain at the first broken link.
+var errChainBroken = errors.New("audit chain broken")
+
+func validateAuditFilter(req models.AuditListRequest) error {
+	switch req.Outcome {
+	case "", models.AuditOutcomeSuccess, models.AuditOutcomeFailure, models.AuditOutcomeDenied:
+	default:
+		return apperrors.New(apperrors.ErrInvalidRequest, fmt.Sprintf("unknown outcome %q", req.Outcome))
+	}
+	if req.Before != "" && !primitive.IsValidObjectID(req.Before) {
+		return apperrors.New(apperrors.ErrInvalidRequest, "before must be an audit entry ID")
+	}
+	if req.From != nil && req.To != nil && !req.From.Before(*req.To) {
+		return apperrors.New(apperrors.ErrInvalidRequest, "from must be before to")
+	}
+	return nil
+}
+
+// hashAuditEntry returns the hex SHA-256 of an entry's fields other than
+// Hash, in a fixed order.
+func hashAuditEntry(entry *models.AuditEntry) string {
+	fields, _ := json.Marshal([]any{
+		entry.Seq,
+		entry.PrevHash,
+		entry.ID.Hex(),
+		entry.Time.UTC().Format(time.RFC3339Nano),
+		entry.ActorID,
+		entry.Action,
+		entry.FileID,
+		entry.IP,
+		entry.UserAgent,
+		entry.RequestID,
+		entry.Outcome,
+		entry.Status,
+		entry.ErrorCode,
+	})
+	sum := sha256.Sum256(fields)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"user-service/internal/apperrors"
+	"user-service/internal/models"
+	"user-service/internal/repository"
+	"user-service/pkg/storage"
+)
+
+// derivedFiles stores the output of jobs as new files charged to the job
+// owner's quota.
+type derivedFiles struct {
+	files   *repository.FileRepository
+	storage storage.Storage
+	quotas  *QuotaService
+}
+
+// save stores what write produces as a file derived by job. The output is
+// streamed into storage as it is produced and is discarded if it exceeds the
+// owner's remaining quota.
+func (d derivedFiles) save(ctx context.Context, job *models.Job, name, contentType string, from models.DerivedFrom, write func(io.Writer) error) (*models.File, error) {
+	remaining, err := d.quotas.RemainingBytes(ctx, job.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(write(pw))
+	}()
+	var src io.Reader = pr
+	if remaining >= 0 {
+		src = io.LimitReader(pr, remaining+1)
+	}
+	counter := &countingReader{r: src}
+
+	storageKey, err := d.storage.UploadFile(ctx, counter, name, contentType)
+	// Stop the writer if storage stopped reading early
+	pr.CloseWithError(io.ErrClosedPipe)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to store output of job", "op", "derivedFiles.save", "job_id", job.ID.Hex(), "error", err)
+		return nil, apperrors.Storage(err)
+	}
+
+	if remaining >= 0 && counter.n > remaining {
+		_ = d.storage.DeleteFile(ctx, storageKey)
+		return nil, apperrors.New(apperrors.ErrQuotaExceeded, fmt.Sprintf("%s output exceeds the remaining %d bytes of storage quota", job.Type, remaining))
+	}
+	if err := d.quotas.Reserve(ctx, job.UserID, counter.n); err != nil {
+		_ = d.storage.DeleteFile(ctx, storageKey)
+		return nil, err
+	}
+
+	from.JobID = job.ID
+	from.Type = job.Type
+	derived := &models.File{
+		UserID:      job.UserID,
+		Name:        name,
+		StorageKey:  storageKey,
+		Size:        counter.n,
+		MimeType:    contentType,
+		Status:      models.FileStatusActive,
+		DerivedFrom: &from,
+	}
+	if err := d.files.Create(ctx, derived); err != nil {
+		_ = d.storage.DeleteFile(ctx, storageKey)
+		_ = d.quotas.Release(ctx, job.UserID, counter.n)
+		return nil, err
+	}
+	return derived, nil
+}
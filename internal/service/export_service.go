@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"path"
+	"slices"
+	"strings"
+	"user-service/internal/apperrors"
+	"user-service/internal/export"
+	"user-service/internal/models"
+	"user-service/internal/parser"
+	"user-service/internal/preview"
+	"user-service/internal/repository"
+	"user-service/pkg/storage"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ExportConfig controls when exports run in the background.
+type ExportConfig struct {
+	// SyncMaxSize is the largest source file exported in the request; larger
+	// files are exported by a background job. 0 streams every export.
+	SyncMaxSize int64
+}
+
+// ExportService converts files' normalized records to NDJSON, CSV or
+// Parquet, either streamed to the client or stored as a derived file by a
+// background job.
+type ExportService struct {
+	files   *repository.FileRepository
+	storage storage.Storage
+	derived derivedFiles
+	jobs    *JobService
+	config  ExportConfig
+}
+
+func NewExportService(files *repository.FileRepository, storage storage.Storage, quotas *QuotaService, jobs *JobService, config ExportConfig) *ExportService {
+	s := &ExportService{
+		files:   files,
+		storage: storage,
+		derived: derivedFiles{files: files, storage: storage, quotas: quotas},
+		jobs:    jobs,
+		config:  config,
+	}
+	jobs.Register(models.JobTypeExport, s.run)
+	return s
+}
+
+// Export exports a file. Small files are written to the writer returned by
+// open, which is only called once the export is known to start; large files,
+// or any file when req.Async is set, are exported by a job, which is
+// returned instead.
+func (s *ExportService) Export(ctx context.Context, userID uint, id primitive.ObjectID, req models.ExportRequest, open func(*models.File, export.Format) io.Writer) (*models.Job, error) {
+	slog.InfoContext(ctx, "Exporting file", "op", "ExportService.Export", "file_id", id.Hex(), "format", req.Format)
+
+	format, columns, err := validateExport(req)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := s.files.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if file.UserID != userID {
+		slog.WarnContext(ctx, "User does not own file", "op", "ExportService.Export", "user_id", userID, "file_id", id.Hex())
+		return nil, apperrors.ErrForbidden
+	}
+	if err := exportable(file); err != nil {
+		return nil, err
+	}
+
+	if req.Async || (s.config.SyncMaxSize > 0 && file.Size > s.config.SyncMaxSize) {
+		job := &models.Job{
+			UserID: userID,
+			Type:   models.JobTypeExport,
+			FileID: &file.ID,
+			Export: &req,
+		}
+		if err := s.jobs.Submit(ctx, job); err != nil {
+			return nil, err
+		}
+		slog.InfoContext(ctx, "Queued export job", "op", "ExportService.Export", "job_id", job.ID.Hex())
+		return job, nil
+	}
+
+	return nil, s.write(ctx, file, req, format, columns, open(file, format))
+}
+
+// run is the JobRunner for export jobs. It stores the export as a file
+// derived from the source file and charges it to the owner's quota.
+func (s *ExportService) run(ctx context.Context, job *models.Job) (*models.File, error) {
+	req := *job.Export
+	format, columns, err := validateExport(req)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := s.files.GetByID(ctx, *job.FileID)
+	if err != nil {
+		return nil, err
+	}
+	if err := exportable(file); err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSuffix(file.Name, path.Ext(file.Name)) + format.Extension()
+	return s.derived.save(ctx, job, name, format.ContentType(), models.DerivedFrom{FileID: &file.ID}, func(w io.Writer) error {
+		return s.write(ctx, file, req, format, columns, w)
+	})
+}
+
+// write streams the file's records that fall in the requested time range to
+// w. Records without a timestamp are left out when a range is given.
+func (s *ExportService) write(ctx context.Context, file *models.File, req models.ExportRequest, format export.Format, columns []string, w io.Writer) error {
+	writer, err := export.NewWriter(w, format, columns)
+	if err != nil {
+		return apperrors.Wrap(apperrors.ErrInternal, err, "")
+	}
+
+	logFormat := models.LogFormatText
+	if file.Format != nil {
+		logFormat = file.Format.Format
+	}
+	var written int64
+	_, err = parser.StreamFile(ctx, s.storage, file.StorageKey, logFormat, func(record parser.Record) error {
+		if req.From != nil || req.To != nil {
+			t := record.Timestamp
+			if t == nil || (req.From != nil && t.Before(*req.From)) || (req.To != nil && t.After(*req.To)) {
+				return nil
+			}
+		}
+		written++
+		return writer.Write(record)
+	})
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Export failed", "op", "ExportService.write", "file_id", file.ID.Hex(), "written", written, "error", err)
+		return apperrors.Storage(err)
+	}
+	slog.InfoContext(ctx, "Exported file", "op", "ExportService.write", "file_id", file.ID.Hex(), "written", written)
+	return nil
+}
+
+func validateExport(req models.ExportRequest) (export.Format, []string, error) {
+	format := export.Format(req.Format)
+	if !slices.Contains(export.Formats, format) {
+		return "", nil, apperrors.New(apperrors.ErrInvalidRequest, fmt.Sprintf("unknown export format %q", req.Format)).
+			WithDetails(map[string]any{"allowed_formats": export.Formats})
+	}
+	columns, err := export.ParseColumns(req.Fields)
+	if err != nil {
+		return "", nil, apperrors.Wrap(apperrors.ErrInvalidRequest, err, err.Error())
+	}
+	if req.From != nil && req.To != nil && req.To.Before(*req.From) {
+		return "", nil, apperrors.New(apperrors.ErrInvalidRequest, "to must not be before from")
+	}
+	return format, columns, nil
+}
+
+// exportable reports why a file's records can't be exported, if they can't.
+func exportable(file *models.File) error {
+	switch {
+	case file.Status == models.FileStatusDeleted:
+		return errFileDeleted
+	case file.Status == models.FileStatusAnalyzing:
+		// Records can't be parsed before the format is known
+		return apperrors.New(apperrors.ErrInvalidState, "file is still being analyzed")
+	case file.Extraction != nil:
+		return errExtracted
+	case file.Analysis != nil && !preview.Ranged(file.Analysis.Encoding):
+		return apperrors.New(apperrors.ErrInvalidRequest, fmt.Sprintf("exporting %s files is not supported", file.Analysis.Encoding))
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// fileEvents notifies tails in this process that a file was appended to,
+// hidden or deleted. Notifications carry no data and are coalesced: a
+// subscriber that hasn't caught up has at most one pending notification and
+// re-reads the file when it gets to it. The zero value is ready to use.
+type fileEvents struct {
+	mu          sync.Mutex
+	subscribers map[primitive.ObjectID]map[chan struct{}]struct{}
+}
+
+// subscribe returns a channel that receives notifications for a file and the
+// function that stops them.
+func (e *fileEvents) subscribe(id primitive.ObjectID) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	e.mu.Lock()
+	if e.subscribers == nil {
+		e.subscribers = make(map[primitive.ObjectID]map[chan struct{}]struct{})
+	}
+	if e.subscribers[id] == nil {
+		e.subscribers[id] = make(map[chan struct{}]struct{})
+	}
+	e.subscribers[id][ch] = struct{}{}
+	e.mu.Unlock()
+
+	return ch, func() {
+		e.mu.Lock()
+		delete(e.subscribers[id], ch)
+		if len(e.subscribers[id]) == 0 {
+			delete(e.subscribers, id)
+		}
+		e.mu.Unlock()
+	}
+}
+
+// publish notifies the file's subscribers without blocking.
+func (e *fileEvents) publish(id primitive.ObjectID) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for ch := range e.subscribers[id] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// fileLocks serializes operations on the same file within this process
+// only; instances sharing a database don't see each other's locks. Callers
+// that must stay correct across instances also condition their database
+// updates, as FileService.AppendFile does with the file's version. Locks
+// are dropped once no one holds or waits for them. The zero value is ready
+// to use.
+type fileLocks struct {
+	mu    sync.Mutex
+	locks map[primitive.ObjectID]*fileLock
+}
+
+type fileLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lock blocks until the caller holds the file's lock and returns the
+// function that releases it.
+func (l *fileLocks) lock(id primitive.ObjectID) func() {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[primitive.ObjectID]*fileLock)
+	}
+	lock := l.locks[id]
+	if lock == nil {
+		lock = &fileLock{}
+		l.locks[id] = lock
+	}
+	lock.refs++
+	l.mu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		l.mu.Lock()
+		if lock.refs--; lock.refs == 0 {
+			delete(l.locks, id)
+		}
+		l.mu.Unlock()
+	}
+}
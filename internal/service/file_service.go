@@ -1,130 +1,1042 @@
 package service
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+	"user-service/internal/apperrors"
+	"user-service/internal/archive"
+	"user-service/internal/metrics"
 	"user-service/internal/models"
+	"user-service/internal/notify"
+	"user-service/internal/parser"
+	"user-service/internal/preview"
+	"user-service/internal/redact"
 	"user-service/internal/repository"
+	"user-service/internal/search"
+	"user-service/internal/timeline"
 	"user-service/pkg/storage"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type FileService struct {
-	repo    *repository.FileRepository
-	storage storage.Storage
+	repo     *repository.FileRepository
+	storage  storage.Storage
+	quotas   *QuotaService
+	policy   UploadPolicy
+	analysis *AnalysisService
+	settings *SettingsService
+	notifier notify.Notifier
+
+	// locks serializes appends to and deletion of the same file
+	locks fileLocks
+
+	// events wakes up tails when a file changes
+	events fileEvents
 }
 
-func NewFileService(repo *repository.FileRepository, storage storage.Storage) *FileService {
+func NewFileService(repo *repository.FileRepository, storage storage.Storage, quotas *QuotaService, policy UploadPolicy, analysis *AnalysisService, settings *SettingsService, notifier notify.Notifier) *FileService {
 	return &FileService{
-		repo:    repo,
-		storage: storage,
+		repo:     repo,
+		storage:  storage,
+		quotas:   quotas,
+		policy:   policy,
+		analysis: analysis,
+		settings: settings,
+		notifier: notifier,
+	}
+}
+
+// UploadOptions holds per-request choices for an upload.
+type UploadOptions struct {
+	// Redaction overrides the user's redaction mode when set.
+	Redaction models.RedactionMode
+
+	// Extract expands a zip or tar.gz upload into a file per entry.
+	Extract bool
+
+	// Tags label the stored files, such as for saved queries to select
+	// them. Files extracted from an archive get the archive's tags.
+	Tags []string
+}
+
+func (s *FileService) UploadFile(ctx context.Context, userID uint, file io.Reader, fileName string, opts UploadOptions) (*models.File, error) {
+	slog.DebugContext(ctx, "Starting file upload", "op", "FileService.UploadFile", "user_id", userID, "file_name", fileName)
+
+	mode, err := s.redactionMode(ctx, userID, opts.Redaction)
+	if err != nil {
+		return nil, err
+	}
+	opts.Redaction = mode
+	if opts.Tags, err = normalizeTags(opts.Tags); err != nil {
+		return nil, err
+	}
+
+	// Sniff the real content type from the first bytes
+	buffered := bufio.NewReaderSize(file, sniffLen)
+	head, err := buffered.Peek(sniffLen)
+	if err != nil && err != io.EOF {
+		slog.ErrorContext(ctx, "Failed to read file header", "op", "FileService.UploadFile", "error", err)
+		return nil, apperrors.Wrap(apperrors.ErrInvalidFile, err, "failed to read file")
+	}
+
+	if opts.Extract {
+		kind := archive.Detect(head)
+		if kind == "" {
+			return nil, apperrors.New(apperrors.ErrInvalidFile, "file is not a zip or tar.gz archive")
+		}
+		return s.extractArchive(ctx, userID, buffered, fileName, kind, opts)
 	}
+	return s.store(ctx, userID, buffered, head, fileName, opts, nil)
 }
 
-func (s *FileService) UploadFile(ctx context.Context, userID uint, file io.Reader, fileName string, contentType string) (*models.File, error) {
-	log.Printf("[UploadFile] Starting file upload - UserID: %d, FileName: %s, ContentType: %s", userID, fileName, contentType)
+// store checks a file against the upload policy and quota, redacts it with
+// the resolved opts.Redaction mode and saves it, then queues it for
+// analysis. entry links files extracted from an archive to the archive
+// upload.
+func (s *FileService) store(ctx context.Context, userID uint, buffered io.Reader, head []byte, fileName string, opts UploadOptions, entry *models.ArchiveEntry) (*models.File, error) {
+	mode := opts.Redaction
+	contentType, maxSize, err := s.policy.Check(fileName, head)
+	if err != nil {
+		slog.WarnContext(ctx, "Upload rejected by policy", "op", "FileService.UploadFile", "error", err)
+		return nil, err
+	}
+	slog.InfoContext(ctx, "Detected content type", "op", "FileService.UploadFile", "content_type", contentType)
+
+	// Reject early when the user has no room left
+	remaining, err := s.quotas.RemainingBytes(ctx, userID)
+	if err != nil {
+		slog.WarnContext(ctx, "Quota check failed", "op", "FileService.UploadFile", "error", err)
+		return nil, err
+	}
+
+	// Count what we store, and stop reading one byte past the tightest limit
+	limit := maxSize
+	if limit <= 0 || (remaining >= 0 && remaining < limit) {
+		limit = remaining
+	}
+	var src io.Reader = buffered
+	if limit > 0 {
+		src = io.LimitReader(buffered, limit+1)
+	}
+	input := &countingReader{r: src}
+	src = input
+
+	// Masking changes the size, so limits apply to both what was sent and
+	// what is stored
+	var redactor *redact.Reader
+	if mode != models.RedactionModeOff {
+		redactor = redact.NewReader(src, s.policy.Detectors, mode)
+		src = redactor
+	}
+	counter := &countingReader{r: src}
 
 	// Upload file to storage
-	storageKey, err := s.storage.UploadFile(ctx, file, fileName, contentType)
+	storageKey, err := s.storage.UploadFile(ctx, counter, fileName, contentType)
 	if err != nil {
-		log.Printf("[UploadFile] Failed to upload file to storage: %v", err)
-		return nil, fmt.Errorf("failed to upload file to storage: %v", err)
+		slog.ErrorContext(ctx, "Failed to upload file to storage", "op", "FileService.UploadFile", "error", err)
+		return nil, apperrors.Storage(err)
+	}
+	slog.InfoContext(ctx, "File uploaded to storage successfully", "op", "FileService.UploadFile", "storage_key", storageKey, "size", counter.n)
+
+	if maxSize > 0 && (counter.n > maxSize || input.n > maxSize) {
+		slog.WarnContext(ctx, "Upload exceeds the size limit for its type", "op", "FileService.UploadFile", "max_size", maxSize, "content_type", contentType)
+		_ = s.storage.DeleteFile(ctx, storageKey)
+		return nil, s.policy.TooLarge(contentType, maxSize)
+	}
+	if remaining >= 0 && (counter.n > remaining || input.n > remaining) {
+		slog.WarnContext(ctx, "Upload exceeds remaining quota", "op", "FileService.UploadFile", "remaining", remaining)
+		_ = s.storage.DeleteFile(ctx, storageKey)
+		return nil, apperrors.New(apperrors.ErrQuotaExceeded, fmt.Sprintf("upload exceeds the remaining %d bytes of storage quota", remaining))
+	}
+
+	// Charge the quota now that the real size is known
+	if err := s.quotas.Reserve(ctx, userID, counter.n); err != nil {
+		slog.ErrorContext(ctx, "Failed to reserve quota", "op", "FileService.UploadFile", "error", err)
+		_ = s.storage.DeleteFile(ctx, storageKey)
+		return nil, err
 	}
-	log.Printf("[UploadFile] File uploaded to storage successfully - StorageKey: %s", storageKey)
 
 	// Create file record in database
 	fileRecord := &models.File{
 		UserID:     userID,
 		Name:       fileName,
 		StorageKey: storageKey,
+		Size:       counter.n,
 		MimeType:   contentType,
-		Status:     models.FileStatusActive,
+		Status:     models.FileStatusAnalyzing,
+		Tags:       opts.Tags,
+		Archive:    entry,
+	}
+	if redactor != nil {
+		fileRecord.Redaction = redactor.Report()
+		slog.InfoContext(ctx, "Redaction found matches", "op", "FileService.UploadFile", "mode", mode, "matches", fileRecord.Redaction.Total)
 	}
 
 	if err := s.repo.Create(ctx, fileRecord); err != nil {
-		log.Printf("[UploadFile] Failed to create file record in database: %v", err)
-		// Cleanup storage if database operation fails
+		slog.ErrorContext(ctx, "Failed to create file record in database", "op", "FileService.UploadFile", "error", err)
+		// Cleanup storage and quota if database operation fails
 		_ = s.storage.DeleteFile(ctx, storageKey)
-		return nil, fmt.Errorf("failed to create file record: %v", err)
+		_ = s.quotas.Release(ctx, userID, counter.n)
+		return nil, err
 	}
-	log.Printf("[UploadFile] File record created successfully - ID: %d", fileRecord.ID)
+	slog.InfoContext(ctx, "File record created successfully", "op", "FileService.UploadFile", "file_id", fileRecord.ID.Hex())
+	metrics.UploadedBytes.Add(float64(counter.n))
+
+	// Analysis runs in the background and moves the file back to active
+	s.analysis.Enqueue(fileRecord.ID)
+	s.emit(ctx, notify.EventFileCreated, fileRecord.UserID, fileRecord)
 
 	return fileRecord, nil
 }
 
-func (s *FileService) UploadFileFromURL(ctx context.Context, userID uint, url string, fileName string) (*models.File, error) {
-	log.Printf("[UploadFileFromURL] Starting URL file upload - UserID: %d, URL: %s, FileName: %s", userID, url, fileName)
+// UploadFileFromURL downloads a file and uploads it. Failed imports are
+// reported with an import.failed event.
+func (s *FileService) UploadFileFromURL(ctx context.Context, userID uint, url string, fileName string, opts UploadOptions) (*models.File, error) {
+	file, err := s.importURL(ctx, userID, url, fileName, opts)
+	if err == nil {
+		metrics.URLImports.WithLabelValues("success").Inc()
+	} else {
+		appErr := apperrors.From(err)
+		metrics.URLImports.WithLabelValues(string(appErr.Code)).Inc()
+		s.emit(ctx, notify.EventImportFailed, userID, models.ImportFailure{
+			URL:     url,
+			Name:    fileName,
+			Code:    string(appErr.Code),
+			Message: appErr.Message,
+		})
+	}
+	return file, err
+}
+
+func (s *FileService) importURL(ctx context.Context, userID uint, url string, fileName string, opts UploadOptions) (*models.File, error) {
+	slog.DebugContext(ctx, "Starting URL file upload", "op", "FileService.UploadFileFromURL", "user_id", userID, "url", url, "file_name", fileName)
 
 	// Download file from URL
-	resp, err := http.Get(url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		slog.WarnContext(ctx, "Invalid URL", "op", "FileService.UploadFileFromURL", "error", err)
+		return nil, apperrors.Wrap(apperrors.ErrInvalidURL, err, "the provided URL is invalid")
+	}
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		log.Printf("[UploadFileFromURL] Failed to download file from URL: %v", err)
-		return nil, fmt.Errorf("failed to download file from URL: %v", err)
+		slog.ErrorContext(ctx, "Failed to download file from URL", "op", "FileService.UploadFileFromURL", "error", err)
+		return nil, apperrors.Wrap(apperrors.ErrInvalidURL, err, "")
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		log.Printf("[UploadFileFromURL] Failed to download file: HTTP %d", resp.StatusCode)
-		return nil, fmt.Errorf("failed to download file: HTTP %d", resp.StatusCode)
+		slog.ErrorContext(ctx, "Failed to download file: unexpected HTTP status", "op", "FileService.UploadFileFromURL", "status_code", resp.StatusCode)
+		return nil, apperrors.ErrInvalidURL.WithDetails(map[string]any{"status_code": resp.StatusCode})
 	}
-	log.Printf("[UploadFileFromURL] File downloaded successfully from URL - ContentType: %s", resp.Header.Get("Content-Type"))
+	slog.InfoContext(ctx, "File downloaded successfully from URL", "op", "FileService.UploadFileFromURL")
 
-	// Upload file to storage
-	return s.UploadFile(ctx, userID, resp.Body, fileName, resp.Header.Get("Content-Type"))
+	// Upload file to storage; the policy sniffs the type instead of trusting the header
+	return s.UploadFile(ctx, userID, resp.Body, fileName, opts)
 }
 
-func (s *FileService) GetFile(ctx context.Context, id primitive.ObjectID) (*models.File, error) {
-	log.Printf("[FileService.GetFile] Fetching file with ID: %s", id.Hex())
-	return s.repo.GetByID(ctx, id)
+// extractArchive stores each regular file in an archive as a file of its
+// own, linked to a file record for the archive. The archive itself is not
+// kept, so masked entries are never stored unmasked. Entries the upload
+// policy or quota reject are listed as skipped; an archive that expands
+// beyond its limits keeps the files extracted so far and records the error.
+func (s *FileService) extractArchive(ctx context.Context, userID uint, r io.Reader, fileName string, kind archive.Kind, opts UploadOptions) (*models.File, error) {
+	slog.InfoContext(ctx, "Extracting archive", "op", "FileService.UploadFile", "kind", kind, "file_name", fileName)
+
+	// Zip archives need random access, so archives are spooled to disk
+	spool, err := os.CreateTemp("", "archive-*")
+	if err != nil {
+		return nil, apperrors.Wrap(apperrors.ErrInternal, err, "")
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	maxSize := s.policy.MaxArchiveSize
+	var src io.Reader = r
+	if maxSize > 0 {
+		src = io.LimitReader(r, maxSize+1)
+	}
+	size, err := io.Copy(spool, src)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to read archive", "op", "FileService.UploadFile", "error", err)
+		return nil, apperrors.Wrap(apperrors.ErrInvalidFile, err, "failed to read file")
+	}
+	if maxSize > 0 && size > maxSize {
+		return nil, s.policy.TooLarge("archives", maxSize)
+	}
+
+	parent := &models.File{
+		UserID:     userID,
+		Name:       fileName,
+		MimeType:   archiveMimeTypes[kind],
+		Status:     models.FileStatusActive,
+		Tags:       opts.Tags,
+		Extraction: &models.Extraction{Kind: string(kind)},
+	}
+	if err := s.repo.Create(ctx, parent); err != nil {
+		slog.ErrorContext(ctx, "Failed to create archive record", "op", "FileService.UploadFile", "error", err)
+		return nil, err
+	}
+
+	extraction := parent.Extraction
+	skipped, err := archive.Walk(ctx, spool, size, kind, s.policy.Archive, func(e archive.Entry, r io.Reader) error {
+		buffered := bufio.NewReaderSize(r, sniffLen)
+		head, err := buffered.Peek(sniffLen)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		_, err = s.store(ctx, userID, buffered, head, path.Base(e.Path), opts, &models.ArchiveEntry{ParentID: parent.ID, Path: e.Path})
+		switch {
+		case err == nil:
+			extraction.Extracted++
+		case errors.Is(err, apperrors.ErrInvalidRequest), errors.Is(err, apperrors.ErrFileTooLarge), errors.Is(err, apperrors.ErrQuotaExceeded):
+			extraction.Skipped = append(extraction.Skipped, models.SkippedEntry{Path: e.Path, Reason: apperrors.From(err).Message})
+		default:
+			return err
+		}
+		return nil
+	})
+	for _, skip := range skipped {
+		extraction.Skipped = append(extraction.Skipped, models.SkippedEntry{Path: skip.Path, Reason: skip.Reason})
+	}
+
+	// Storage and database failures fail the upload; problems with the
+	// archive itself are reported on the record
+	var appErr *apperrors.Error
+	if errors.As(err, &appErr) || ctx.Err() != nil {
+		slog.ErrorContext(ctx, "Extraction failed", "op", "FileService.UploadFile", "extracted", extraction.Extracted, "error", err)
+		extraction.Error = "extraction failed"
+		_ = s.repo.SetExtraction(context.WithoutCancel(ctx), parent.ID, extraction)
+		return nil, apperrors.From(err)
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "Extraction stopped", "op", "FileService.UploadFile", "extracted", extraction.Extracted, "error", err)
+		if extraction.Extracted == 0 {
+			_ = s.repo.Delete(ctx, parent.ID)
+			return nil, apperrors.Wrap(apperrors.ErrInvalidFile, err, err.Error())
+		}
+		extraction.Error = err.Error()
+	}
+
+	if err := s.repo.SetExtraction(ctx, parent.ID, extraction); err != nil {
+		return nil, err
+	}
+	slog.InfoContext(ctx, "Extracted archive", "op", "FileService.UploadFile", "extracted", extraction.Extracted, "skipped", len(extraction.Skipped))
+	s.emit(ctx, notify.EventFileCreated, parent.UserID, parent)
+	return parent, nil
 }
 
-func (s *FileService) ListUserFiles(ctx context.Context, userID uint) ([]models.File, error) {
-	log.Printf("[FileService.ListUserFiles] Fetching files for user: %d", userID)
-	return s.repo.GetByUserID(ctx, userID)
+var archiveMimeTypes = map[archive.Kind]string{
+	archive.KindZip:   "application/zip",
+	archive.KindTarGz: "application/gzip",
 }
 
-func (s *FileService) DeleteFile(ctx context.Context, id primitive.ObjectID) error {
-	log.Printf("[FileService.DeleteFile] Deleting file: %s", id.Hex())
+// errFileDeleted is returned by every operation that reads or changes a
+// deleted file. The record of a deleted file is kept, so IDs of deleted
+// files still resolve and only IDs that match no file are not found.
+var errFileDeleted = apperrors.New(apperrors.ErrInvalidState, "file has been deleted")
 
-	file, err := s.repo.GetByID(ctx, id)
+// errExtracted is returned when reading the content of an extracted archive
+// upload.
+var errExtracted = apperrors.New(apperrors.ErrInvalidState, "archive entries are stored as separate files")
+
+const (
+	maxTags      = 20
+	maxTagLength = 64
+)
+
+// appendRecordAttempts bounds how often recording an append is tried while
+// other instances keep changing the file.
+const appendRecordAttempts = 5
+
+// normalizeTags trims tags and drops empty and repeated ones.
+func normalizeTags(tags []string) ([]string, error) {
+	var normalized []string
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || slices.Contains(normalized, tag) {
+			continue
+		}
+		if len(tag) > maxTagLength {
+			return nil, apperrors.New(apperrors.ErrInvalidRequest, fmt.Sprintf("tags must be at most %d characters", maxTagLength))
+		}
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) > maxTags {
+		return nil, apperrors.New(apperrors.ErrInvalidRequest, fmt.Sprintf("at most %d tags are allowed", maxTags))
+	}
+	return normalized, nil
+}
+
+// redactionMode picks the redaction mode of an upload: the requested mode,
+// then the user's setting, then the policy default.
+func (s *FileService) redactionMode(ctx context.Context, userID uint, requested models.RedactionMode) (models.RedactionMode, error) {
+	if requested != "" {
+		if err := validateRedactionMode(requested); err != nil {
+			return "", err
+		}
+		return requested, nil
+	}
+	settings, err := s.settings.Get(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	if settings.RedactionMode != "" {
+		return settings.RedactionMode, nil
+	}
+	if s.policy.Redaction == "" {
+		return models.RedactionModeOff, nil
+	}
+	return s.policy.Redaction, nil
+}
+
+// AppendFile appends newline-delimited UTF-8 text to a stored file. The
+// data is redacted with the file's redaction mode, checked against the
+// file's size limit and the user's quota, and ends on a line break. Appends
+// to the same file are serialized within this process, and the file is
+// queued for analysis again afterwards.
+//
+// Across instances, the storage backend serializes the writes themselves,
+// and the record is only updated at the version the append was checked
+// against. When another instance appended meanwhile, the file is re-read
+// and the update retried, so every append moves the version on exactly
+// once. The checks can still have seen a file that another instance was
+// appending to: a concurrent append can take the file past its size limit
+// by one append, or add data to a file that was deleted meanwhile, in which
+// case the append fails.
+func (s *FileService) AppendFile(ctx context.Context, userID uint, id primitive.ObjectID, body io.Reader) (*models.File, error) {
+	appender, ok := s.storage.(storage.Appender)
+	if !ok {
+		return nil, apperrors.New(apperrors.ErrInvalidRequest, "the storage backend does not support appends")
+	}
+
+	data, err := io.ReadAll(io.LimitReader(body, s.policy.MaxAppendSize+1))
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to read request body", "op", "FileService.AppendFile", "error", err)
+		return nil, apperrors.Wrap(apperrors.ErrInvalidRequest, err, "failed to read request body")
+	}
+	if int64(len(data)) > s.policy.MaxAppendSize {
+		return nil, apperrors.New(apperrors.ErrFileTooLarge, fmt.Sprintf("append exceeds the %d byte limit", s.policy.MaxAppendSize)).
+			WithDetails(map[string]any{"max_size": s.policy.MaxAppendSize})
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, apperrors.New(apperrors.ErrInvalidRequest, "nothing to append")
+	}
+	if !utf8.Valid(data) || bytes.IndexByte(data, 0) >= 0 {
+		return nil, apperrors.New(apperrors.ErrInvalidFile, "appended data must be UTF-8 text")
+	}
+
+	unlock := s.locks.lock(id)
+	defer unlock()
+
+	file, err := s.getOwnedFile(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case file.Status == models.FileStatusDeleted:
+		return nil, errFileDeleted
+	case file.Extraction != nil:
+		return nil, errExtracted
+	case file.Analysis != nil && !preview.Ranged(file.Analysis.Encoding):
+		return nil, apperrors.New(apperrors.ErrInvalidRequest, fmt.Sprintf("appending to %s files is not supported", file.Analysis.Encoding))
+	}
+
+	// Keep the first appended line off the file's last line
+	if !bytes.HasSuffix(data, []byte("\n")) {
+		data = append(data, '\n')
+	}
+	if file.Size > 0 {
+		last, err := s.lastByte(ctx, file)
+		if err != nil {
+			return nil, err
+		}
+		if last != '\n' {
+			data = append([]byte("\n"), data...)
+		}
+	}
+
+	mode := models.RedactionModeOff
+	if file.Redaction != nil {
+		mode = file.Redaction.Mode
+	} else if mode, err = s.redactionMode(ctx, userID, ""); err != nil {
+		return nil, err
+	}
+	var report *models.RedactionReport
+	if mode != models.RedactionModeOff {
+		redactor := redact.NewReader(bytes.NewReader(data), s.policy.Detectors, mode)
+		if data, err = io.ReadAll(redactor); err != nil {
+			return nil, apperrors.Wrap(apperrors.ErrInternal, err, "")
+		}
+		report = redactor.Report()
+	}
+
+	size := int64(len(data))
+	if maxSize := s.policy.MaxSizeFor(file.MimeType); maxSize > 0 && file.Size+size > maxSize {
+		slog.WarnContext(ctx, "Append would grow file past the size limit", "op", "FileService.AppendFile", "file_id", id.Hex(), "max_size", maxSize)
+		return nil, s.policy.TooLarge(file.MimeType, maxSize)
+	}
+	if err := s.quotas.ReserveBytes(ctx, userID, size); err != nil {
+		return nil, err
+	}
+
+	newSize, err := appender.AppendFile(ctx, file.StorageKey, data)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to append to file", "op", "FileService.AppendFile", "file_id", id.Hex(), "error", err)
+		_ = s.quotas.ReleaseBytes(ctx, userID, size)
+		return nil, apperrors.Storage(err)
+	}
+	metrics.UploadedBytes.Add(float64(size))
+
+	// When recording the append fails, the data stays stored and charged:
+	// the next append's record brings the size up to date, and deleting the
+	// file then releases the bytes with the rest of it. Until another append
+	// succeeds, deleting the file releases only the recorded size, so the
+	// bytes stay charged. A file deleted meanwhile is never recorded again,
+	// so its charge is released here.
+	updated, err := s.repo.Append(ctx, id, file.Version, newSize, report)
+	for attempt := 1; errors.Is(err, repository.ErrFileChanged) && attempt < appendRecordAttempts; attempt++ {
+		slog.WarnContext(ctx, "File changed during append, retrying", "op", "FileService.AppendFile", "file_id", id.Hex(), "version", file.Version, "attempt", attempt)
+		if file, err = s.repo.GetByID(ctx, id); err != nil {
+			break
+		}
+		if file.Status == models.FileStatusDeleted {
+			err = errFileDeleted
+			break
+		}
+		updated, err = s.repo.Append(ctx, id, file.Version, newSize, report)
+	}
+	if errors.Is(err, errFileDeleted) || errors.Is(err, apperrors.ErrFileNotFound) {
+		if err := s.quotas.ReleaseBytes(ctx, userID, size); err != nil {
+			slog.ErrorContext(ctx, "Failed to release quota", "op", "FileService.AppendFile", "file_id", id.Hex(), "error", err)
+		}
+	}
 	if err != nil {
-		log.Printf("[FileService.DeleteFile] Failed to fetch file: %v", err)
+		slog.ErrorContext(ctx, "Failed to record append to file", "op", "FileService.AppendFile", "file_id", id.Hex(), "error", err)
+		return nil, err
+	}
+	slog.InfoContext(ctx, "Appended to file", "op", "FileService.AppendFile", "file_id", id.Hex(), "appended", size, "size", updated.Size, "version", updated.Version)
+
+	s.analysis.Enqueue(id)
+	s.events.publish(id)
+	return updated, nil
+}
+
+// lastByte reads the last byte of a stored file.
+func (s *FileService) lastByte(ctx context.Context, file *models.File) (byte, error) {
+	reader, err := storage.ReadRange(ctx, s.storage, file.StorageKey, file.Size-1, 1)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to read file", "op", "FileService.lastByte", "file_id", file.ID.Hex(), "error", err)
+		return 0, apperrors.Storage(err)
+	}
+	defer reader.Close()
+
+	var last [1]byte
+	if _, err := io.ReadFull(reader, last[:]); err != nil {
+		return 0, apperrors.Storage(err)
+	}
+	return last[0], nil
+}
+
+func (s *FileService) GetFile(ctx context.Context, userID uint, id primitive.ObjectID) (*models.File, error) {
+	slog.DebugContext(ctx, "Fetching file", "op", "FileService.GetFile", "file_id", id.Hex())
+	return s.getOwnedFile(ctx, userID, id)
+}
+
+func (s *FileService) ListUserFiles(ctx context.Context, userID uint, filter models.FileFilter) ([]models.File, error) {
+	slog.DebugContext(ctx, "Fetching files for user", "op", "FileService.ListUserFiles", "user_id", userID)
+
+	if filter.Format != "" && !slices.Contains(models.LogFormats, filter.Format) {
+		return nil, apperrors.New(apperrors.ErrInvalidRequest, fmt.Sprintf("unknown format %q", filter.Format))
+	}
+
+	return s.repo.GetByUserID(ctx, userID, filter)
+}
+
+func (s *FileService) DeleteFile(ctx context.Context, userID uint, id primitive.ObjectID) error {
+	slog.DebugContext(ctx, "Deleting file", "op", "FileService.DeleteFile", "file_id", id.Hex())
+
+	// Wait for appends in progress so their bytes are released too
+	unlock := s.locks.lock(id)
+	defer unlock()
+
+	file, err := s.getOwnedFile(ctx, userID, id)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to fetch file", "op", "FileService.DeleteFile", "error", err)
+		return err
+	}
+
+	if file.Status == models.FileStatusDeleted {
+		slog.WarnContext(ctx, "File already deleted", "op", "FileService.DeleteFile")
+		return errFileDeleted
+	}
+
+	if err := s.remove(ctx, file); err != nil {
 		return err
 	}
 
+	// Deleting an archive upload deletes the files extracted from it
+	if file.Extraction != nil {
+		children, err := s.repo.GetByUserID(ctx, file.UserID, models.FileFilter{ParentID: &file.ID})
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to fetch extracted files", "op", "FileService.DeleteFile", "error", err)
+			return err
+		}
+		for i := range children {
+			if children[i].Status == models.FileStatusDeleted {
+				continue
+			}
+			if err := s.remove(ctx, &children[i]); err != nil {
+				return err
+			}
+		}
+	}
+
+	slog.InfoContext(ctx, "Successfully deleted file", "op", "FileService.DeleteFile")
+	return nil
+}
+
+// remove soft deletes a file, releases its quota and deletes its content and
+// analysis results.
+func (s *FileService) remove(ctx context.Context, file *models.File) error {
+	id := file.ID
+
 	// Soft delete in database
 	if err := s.repo.UpdateStatus(ctx, id, models.FileStatusDeleted); err != nil {
-		log.Printf("[FileService.DeleteFile] Failed to update file status: %v", err)
-		return fmt.Errorf("failed to update file status: %v", err)
+		slog.ErrorContext(ctx, "Failed to update file status", "op", "FileService.DeleteFile", "error", err)
+		return err
 	}
+	s.events.publish(id)
+	file.Status = models.FileStatusDeleted
+	s.emit(ctx, notify.EventFileDeleted, file.UserID, file)
 
-	// Delete from storage
+	// Deleted files no longer count against the owner's quota; archive
+	// uploads never did
+	if file.Extraction == nil {
+		if err := s.quotas.Release(ctx, file.UserID, file.Size); err != nil {
+			slog.ErrorContext(ctx, "Failed to release quota", "op", "FileService.DeleteFile", "error", err)
+			return err
+		}
+	}
+
+	// Deleted files no longer show up in searches or pattern listings
+	if err := s.analysis.RemoveResults(ctx, id); err != nil {
+		slog.ErrorContext(ctx, "Failed to delete analysis results", "op", "FileService.DeleteFile", "error", err)
+		return err
+	}
+
+	// Delete from storage; archive uploads have no content of their own
+	if file.StorageKey == "" {
+		return nil
+	}
 	if err := s.storage.DeleteFile(ctx, file.StorageKey); err != nil {
-		log.Printf("[FileService.DeleteFile] Failed to delete file from storage: %v", err)
-		return fmt.Errorf("failed to delete file from storage: %v", err)
+		slog.ErrorContext(ctx, "Failed to delete file from storage", "op", "FileService.DeleteFile", "error", err)
+		return apperrors.Storage(err)
+	}
+	if err := s.repo.ContentDeleted(ctx, file); err != nil {
+		slog.ErrorContext(ctx, "Failed to record deletion of file content", "op", "FileService.DeleteFile", "error", err)
+	}
+	return nil
+}
+
+func (s *FileService) HideFile(ctx context.Context, userID uint, id primitive.ObjectID) error {
+	slog.DebugContext(ctx, "Hiding file", "op", "FileService.HideFile", "file_id", id.Hex())
+
+	file, err := s.getOwnedFile(ctx, userID, id)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to fetch file", "op", "FileService.HideFile", "error", err)
+		return err
+	}
+
+	if file.Status == models.FileStatusDeleted {
+		slog.WarnContext(ctx, "Cannot hide deleted file", "op", "FileService.HideFile")
+		return errFileDeleted
 	}
 
-	log.Printf("[FileService.DeleteFile] Successfully deleted file")
+	if err := s.repo.UpdateStatus(ctx, id, models.FileStatusHidden); err != nil {
+		return err
+	}
+	s.events.publish(id)
+	file.Status = models.FileStatusHidden
+	s.emit(ctx, notify.EventFileHidden, file.UserID, file)
 	return nil
 }
 
-func (s *FileService) HideFile(ctx context.Context, id primitive.ObjectID) error {
-	log.Printf("[FileService.HideFile] Hiding file: %s", id.Hex())
-	return s.repo.UpdateStatus(ctx, id, models.FileStatusHidden)
+// AnalysisCompleted sends a file.analysis_completed event for a file whose
+// analysis has been stored. It is called by the AnalysisService.
+func (s *FileService) AnalysisCompleted(ctx context.Context, id primitive.ObjectID) {
+	file, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to fetch file", "op", "FileService.AnalysisCompleted", "file_id", id.Hex(), "error", err)
+		return
+	}
+	if file.Status == models.FileStatusDeleted {
+		return
+	}
+	s.emit(ctx, notify.EventFileAnalysisCompleted, file.UserID, file)
+}
+
+// emit sends an event to the notification channels. The change it reports
+// has already been made, so failures are only logged.
+func (s *FileService) emit(ctx context.Context, eventType string, userID uint, data any) {
+	event := notify.Event{
+		ID:     primitive.NewObjectID().Hex(),
+		Type:   eventType,
+		UserID: userID,
+		Time:   time.Now(),
+		Data:   data,
+	}
+	if err := s.notifier.Notify(context.WithoutCancel(ctx), event); err != nil {
+		slog.ErrorContext(ctx, "Failed to send event", "op", "FileService.emit", "event_type", eventType, "error", err)
+	}
+}
+
+func (s *FileService) DownloadFile(ctx context.Context, userID uint, id primitive.ObjectID) (*models.File, io.ReadCloser, error) {
+	slog.DebugContext(ctx, "Downloading file", "op", "FileService.DownloadFile", "file_id", id.Hex())
+
+	file, err := s.getOwnedFile(ctx, userID, id)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to fetch file", "op", "FileService.DownloadFile", "error", err)
+		return nil, nil, err
+	}
+
+	if file.Status == models.FileStatusDeleted {
+		slog.WarnContext(ctx, "Cannot download deleted file", "op", "FileService.DownloadFile")
+		return nil, nil, errFileDeleted
+	}
+	if file.Extraction != nil {
+		return nil, nil, errExtracted
+	}
+
+	reader, err := s.storage.DownloadFile(ctx, file.StorageKey)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to open file from storage", "op", "FileService.DownloadFile", "error", err)
+		return nil, nil, apperrors.Storage(err)
+	}
+	return file, &downloadCounter{reader}, nil
+}
+
+const (
+	// defaultPreviewLines is the number of lines previewed when no range is
+	// requested.
+	defaultPreviewLines = 100
+
+	// maxPreviewLines caps the lines returned by a single preview.
+	maxPreviewLines = 1000
+)
+
+// PreviewFile returns numbered lines from the start, end or a range of a
+// file, decoded to UTF-8 using the encoding found by analysis.
+func (s *FileService) PreviewFile(ctx context.Context, userID uint, id primitive.ObjectID, req models.PreviewRequest) (*models.File, []preview.Line, error) {
+	slog.DebugContext(ctx, "Previewing file", "op", "FileService.PreviewFile", "file_id", id.Hex())
+
+	if err := validatePreview(&req); err != nil {
+		return nil, nil, err
+	}
+
+	file, err := s.getOwnedFile(ctx, userID, id)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to fetch file", "op", "FileService.PreviewFile", "error", err)
+		return nil, nil, err
+	}
+	if file.Status == models.FileStatusDeleted {
+		slog.WarnContext(ctx, "Cannot preview deleted file", "op", "FileService.PreviewFile")
+		return nil, nil, errFileDeleted
+	}
+	if file.Extraction != nil {
+		return nil, nil, errExtracted
+	}
+
+	var encoding string
+	if file.Analysis != nil {
+		encoding = file.Analysis.Encoding
+	}
+
+	// The tail is read backwards with ranged reads when the analysis line
+	// count still describes the stored content
+	if rangeReader, ok := s.storage.(storage.RangeReader); ok && req.Tail > 0 && preview.Ranged(encoding) &&
+		file.Analysis != nil && file.Analysis.Error == "" && file.Analysis.ByteCount == file.Size {
+		open := func(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+			return rangeReader.DownloadRange(ctx, file.StorageKey, offset, length)
+		}
+		lines, err := preview.TailRange(ctx, open, file.Size, file.Analysis.LineCount, encoding, req.Tail)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to read file tail", "op", "FileService.PreviewFile", "error", err)
+			return nil, nil, apperrors.Storage(err)
+		}
+		return file, lines, nil
+	}
+
+	reader, err := s.storage.DownloadFile(ctx, file.StorageKey)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to open file from storage", "op", "FileService.PreviewFile", "error", err)
+		return nil, nil, apperrors.Storage(err)
+	}
+	defer reader.Close()
+
+	var lines []preview.Line
+	switch {
+	case req.Tail > 0:
+		lines, err = preview.Tail(ctx, reader, encoding, req.Tail)
+	case req.FromLine > 0:
+		lines, err = preview.Range(ctx, reader, encoding, req.FromLine, req.ToLine)
+	default:
+		lines, err = preview.Head(ctx, reader, encoding, req.Head)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to read file", "op", "FileService.PreviewFile", "error", err)
+		return nil, nil, apperrors.Storage(err)
+	}
+	return file, lines, nil
 }
 
-func (s *FileService) DownloadFile(ctx context.Context, id primitive.ObjectID) (io.ReadCloser, error) {
-	log.Printf("[FileService.DownloadFile] Downloading file: %s", id.Hex())
+const (
+	// defaultSearchMatches is the number of matches returned when no limit is
+	// requested.
+	defaultSearchMatches = 100
 
+	// maxSearchMatches caps the matches returned by a single search.
+	maxSearchMatches = 10000
+
+	// searchTimeout is the time budget of a single search. Searches that run
+	// out of time return the matches found so far.
+	searchTimeout = 30 * time.Second
+)
+
+// SearchFile scans a file for lines matching req and calls fn with each
+// match and context line as it is found. Errors returned before fn is first
+// called mean nothing was searched.
+func (s *FileService) SearchFile(ctx context.Context, userID uint, id primitive.ObjectID, req models.SearchRequest, fn func(search.Result) error) (*search.Summary, error) {
+	slog.DebugContext(ctx, "Searching file", "op", "FileService.SearchFile", "file_id", id.Hex())
+
+	if req.MaxMatches == 0 {
+		req.MaxMatches = defaultSearchMatches
+	}
+	if req.MaxMatches > maxSearchMatches {
+		return nil, apperrors.New(apperrors.ErrInvalidRequest, fmt.Sprintf("max_matches must be at most %d", maxSearchMatches)).
+			WithDetails(map[string]any{"max_matches": maxSearchMatches})
+	}
+	query := search.Query{
+		Pattern:    req.Query,
+		Regex:      req.Regex,
+		IgnoreCase: req.IgnoreCase,
+		Context:    req.Context,
+		MaxMatches: req.MaxMatches,
+	}
+	re, err := search.Compile(query)
+	if err != nil {
+		return nil, apperrors.Wrap(apperrors.ErrInvalidRequest, err, err.Error())
+	}
+
+	file, err := s.getOwnedFile(ctx, userID, id)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to fetch file", "op", "FileService.SearchFile", "error", err)
+		return nil, err
+	}
+	if file.Status == models.FileStatusDeleted {
+		slog.WarnContext(ctx, "Cannot search deleted file", "op", "FileService.SearchFile")
+		return nil, errFileDeleted
+	}
+	if file.Extraction != nil {
+		return nil, errExtracted
+	}
+
+	var encoding string
+	if file.Analysis != nil {
+		encoding = file.Analysis.Encoding
+	}
+	if !preview.Ranged(encoding) {
+		return nil, apperrors.New(apperrors.ErrInvalidRequest, fmt.Sprintf("searching %s files is not supported", encoding))
+	}
+
+	budget, cancel := context.WithTimeout(ctx, searchTimeout)
+	defer cancel()
+
+	reader, err := s.storage.DownloadFile(budget, file.StorageKey)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to open file from storage", "op", "FileService.SearchFile", "error", err)
+		return nil, apperrors.Storage(err)
+	}
+	defer reader.Close()
+
+	summary, err := search.Search(budget, reader, re, query, encoding, fn)
+	if err != nil && ctx.Err() == nil && errors.Is(budget.Err(), context.DeadlineExceeded) {
+		slog.WarnContext(ctx, "Search ran out of time", "op", "FileService.SearchFile", "lines_scanned", summary.LinesScanned)
+		summary.TimedOut = true
+		return summary, nil
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Search failed", "op", "FileService.SearchFile", "error", err)
+		return summary, apperrors.Storage(err)
+	}
+	slog.InfoContext(ctx, "Search complete", "op", "FileService.SearchFile", "matches", summary.Matches, "lines_scanned", summary.LinesScanned)
+	return summary, nil
+}
+
+// GetPatterns returns the message templates mined from a file during
+// analysis, or nil when mining has not finished yet.
+func (s *FileService) GetPatterns(ctx context.Context, userID uint, id primitive.ObjectID) (*models.File, *models.FilePatterns, error) {
+	file, err := s.getOwnedFile(ctx, userID, id)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to fetch file", "op", "FileService.GetPatterns", "error", err)
+		return nil, nil, err
+	}
+
+	patterns, err := s.analysis.Patterns(ctx, id)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to fetch patterns", "op", "FileService.GetPatterns", "error", err)
+		return nil, nil, err
+	}
+	return file, patterns, nil
+}
+
+// GetTimeline returns the record counts per time bucket and level of a
+// file. Timelines are computed from the parsed records on first request and
+// cached on the file until its content changes.
+func (s *FileService) GetTimeline(ctx context.Context, userID uint, id primitive.ObjectID, bucket string) (*models.Timeline, error) {
+	slog.DebugContext(ctx, "Fetching timeline", "op", "FileService.GetTimeline", "bucket", bucket, "file_id", id.Hex())
+
+	size, ok := timeline.Sizes[bucket]
+	if !ok {
+		return nil, apperrors.New(apperrors.ErrInvalidRequest, fmt.Sprintf("unknown bucket %q", bucket)).
+			WithDetails(map[string]any{"allowed_buckets": []string{"1m", "5m", "1h"}})
+	}
+
+	file, err := s.getOwnedFile(ctx, userID, id)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to fetch file", "op", "FileService.GetTimeline", "error", err)
+		return nil, err
+	}
+	switch {
+	case file.Status == models.FileStatusDeleted:
+		return nil, errFileDeleted
+	case file.Status == models.FileStatusAnalyzing:
+		// Records can't be parsed before the format is known
+		return nil, apperrors.New(apperrors.ErrInvalidState, "file is still being analyzed")
+	case file.Extraction != nil:
+		return nil, errExtracted
+	}
+	format := models.LogFormatText
+	if file.Format != nil {
+		format = file.Format.Format
+	}
+
+	if cached := file.Timelines[bucket]; cached != nil && cached.Version == file.Version {
+		slog.DebugContext(ctx, "Serving cached timeline", "op", "FileService.GetTimeline")
+		return cached, nil
+	}
+
+	builder := timeline.NewBuilder(size)
+	if _, err := parser.StreamFile(ctx, s.storage, file.StorageKey, format, builder.Add); err != nil {
+		if errors.Is(err, timeline.ErrTooManyBuckets) {
+			return nil, apperrors.New(apperrors.ErrInvalidRequest, fmt.Sprintf("file spans more than %d buckets of %s, use a larger bucket", timeline.MaxBuckets, bucket))
+		}
+		slog.ErrorContext(ctx, "Failed to parse file", "op", "FileService.GetTimeline", "error", err)
+		return nil, apperrors.Storage(err)
+	}
+
+	result := &models.Timeline{
+		Bucket:     bucket,
+		Version:    file.Version,
+		ComputedAt: time.Now(),
+	}
+	result.Buckets, result.Untimed = builder.Result()
+
+	if err := s.repo.SaveTimeline(ctx, id, result); err != nil {
+		// The timeline is still valid; it will be computed again next time
+		slog.ErrorContext(ctx, "Failed to cache timeline", "op", "FileService.GetTimeline", "error", err)
+	}
+	slog.InfoContext(ctx, "Computed timeline", "op", "FileService.GetTimeline", "buckets", len(result.Buckets))
+	return result, nil
+}
+
+// validatePreview checks that a single, bounded selection was requested and
+// fills in the defaults.
+func validatePreview(req *models.PreviewRequest) error {
+	modes := 0
+	for _, set := range []bool{req.Head != 0, req.Tail != 0, req.FromLine != 0 || req.ToLine != 0} {
+		if set {
+			modes++
+		}
+	}
+	if modes > 1 {
+		return apperrors.New(apperrors.ErrInvalidRequest, "only one of head, tail or from_line/to_line may be given")
+	}
+
+	switch {
+	case req.Head < 0 || req.Tail < 0:
+		return apperrors.New(apperrors.ErrInvalidRequest, "head and tail must be positive")
+	case req.FromLine != 0 || req.ToLine != 0:
+		if req.FromLine <= 0 {
+			req.FromLine = 1
+		}
+		if req.ToLine == 0 {
+			req.ToLine = req.FromLine + maxPreviewLines - 1
+		}
+		if req.ToLine < req.FromLine {
+			return apperrors.New(apperrors.ErrInvalidRequest, "to_line must not be before from_line")
+		}
+		if req.ToLine-req.FromLine+1 > maxPreviewLines {
+			return previewTooLong()
+		}
+	case req.Head > maxPreviewLines || req.Tail > maxPreviewLines:
+		return previewTooLong()
+	case req.Head == 0 && req.Tail == 0:
+		req.Head = defaultPreviewLines
+	}
+	return nil
+}
+
+func previewTooLong() error {
+	return apperrors.New(apperrors.ErrInvalidRequest, fmt.Sprintf("at most %d lines can be previewed at once", maxPreviewLines)).
+		WithDetails(map[string]any{"max_lines": maxPreviewLines})
+}
+
+// getOwnedFile fetches a file and checks that it belongs to userID.
+func (s *FileService) getOwnedFile(ctx context.Context, userID uint, id primitive.ObjectID) (*models.File, error) {
 	file, err := s.repo.GetByID(ctx, id)
 	if err != nil {
-		log.Printf("[FileService.DownloadFile] Failed to fetch file: %v", err)
 		return nil, err
 	}
+	if file.UserID != userID {
+		slog.WarnContext(ctx, "User does not own file", "op", "FileService.getOwnedFile", "user_id", userID, "file_id", id.Hex())
+		return nil, apperrors.ErrForbidden
+	}
+	return file, nil
+}
+
+// countingReader records how many bytes have been read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// downloadCounter adds the bytes read from a download to the downloaded
+// bytes metric.
+type downloadCounter struct {
+	io.ReadCloser
+}
 
-	return s.storage.DownloadFile(ctx, file.StorageKey)
+func (d *downloadCounter) Read(p []byte) (int, error) {
+	n, err := d.ReadCloser.Read(p)
+	metrics.DownloadedBytes.Add(float64(n))
+	return n, err
 }
@@ -0,0 +1,203 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"user-service/internal/apperrors"
+	"user-service/internal/export"
+	"user-service/internal/models"
+	"user-service/internal/repository"
+	"user-service/internal/search"
+	"user-service/pkg/storage"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// fileOperations calls each operation on a file by ID as user 1.
+var fileOperations = []struct {
+	name string
+	call func(ctx context.Context, files *FileService, exports *ExportService, id primitive.ObjectID) error
+}{
+	{"GetFile", func(ctx context.Context, files *FileService, _ *ExportService, id primitive.ObjectID) error {
+		_, err := files.GetFile(ctx, 1, id)
+		return err
+	}},
+	{"DownloadFile", func(ctx context.Context, files *FileService, _ *ExportService, id primitive.ObjectID) error {
+		_, _, err := files.DownloadFile(ctx, 1, id)
+		return err
+	}},
+	{"PreviewFile", func(ctx context.Context, files *FileService, _ *ExportService, id primitive.ObjectID) error {
+		_, _, err := files.PreviewFile(ctx, 1, id, models.PreviewRequest{})
+		return err
+	}},
+	{"SearchFile", func(ctx context.Context, files *FileService, _ *ExportService, id primitive.ObjectID) error {
+		_, err := files.SearchFile(ctx, 1, id, models.SearchRequest{Query: "error"}, func(search.Result) error { return nil })
+		return err
+	}},
+	{"GetPatterns", func(ctx context.Context, files *FileService, _ *ExportService, id primitive.ObjectID) error {
+		_, _, err := files.GetPatterns(ctx, 1, id)
+		return err
+	}},
+	{"GetTimeline", func(ctx context.Context, files *FileService, _ *ExportService, id primitive.ObjectID) error {
+		_, err := files.GetTimeline(ctx, 1, id, "1m")
+		return err
+	}},
+	{"AppendFile", func(ctx context.Context, files *FileService, _ *ExportService, id primitive.ObjectID) error {
+		_, err := files.AppendFile(ctx, 1, id, strings.NewReader("a new line\n"))
+		return err
+	}},
+	{"TailFile", func(ctx context.Context, files *FileService, _ *ExportService, id primitive.ObjectID) error {
+		return files.TailFile(ctx, 1, id, models.TailRequest{}, func() TailStream { return nil })
+	}},
+	{"HideFile", func(ctx context.Context, files *FileService, _ *ExportService, id primitive.ObjectID) error {
+		return files.HideFile(ctx, 1, id)
+	}},
+	{"DeleteFile", func(ctx context.Context, files *FileService, _ *ExportService, id primitive.ObjectID) error {
+		return files.DeleteFile(ctx, 1, id)
+	}},
+	{"Export", func(ctx context.Context, _ *FileService, exports *ExportService, id primitive.ObjectID) error {
+		_, err := exports.Export(ctx, 1, id, models.ExportRequest{Format: "csv"}, func(*models.File, export.Format) io.Writer { return io.Discard })
+		return err
+	}},
+}
+
+// TestFileOperationsOnMissingFiles checks that every file operation given
+// an ID that matches no file fails with ErrFileNotFound, which the API
+// returns as 404 FILE_NOT_FOUND.
+func TestFileOperationsOnMissingFiles(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	local, err := storage.NewLocalStorage(storage.LocalStorageConfig{BaseDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range fileOperations {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			repo := repository.NewFileRepository(mt.DB, repository.NewOutboxRepository(mt.DB))
+			files := NewFileService(repo, local, nil, DefaultUploadPolicy(), nil, nil, nil)
+			jobs := NewJobService(repository.NewJobRepository(mt.DB), JobConfig{})
+			exports := NewExportService(repo, local, nil, jobs, ExportConfig{})
+			mt.AddMockResponses(mtest.CreateCursorResponse(0, "analyticsai.files", mtest.FirstBatch))
+
+			err := tt.call(context.Background(), files, exports, primitive.NewObjectID())
+			if !errors.Is(err, apperrors.ErrFileNotFound) {
+				mt.Fatalf("error = %v, want %v", err, apperrors.ErrFileNotFound)
+			}
+		})
+	}
+}
+
+// TestFileOperationsOnDeletedFiles checks that every operation that reads
+// or changes a deleted file fails with errFileDeleted, which the API
+// returns as 409 INVALID_STATE, while its record can still be read.
+func TestFileOperationsOnDeletedFiles(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	local, err := storage.NewLocalStorage(storage.LocalStorageConfig{BaseDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range fileOperations {
+		if tt.name == "GetPatterns" {
+			// Like GetFile, it returns the record of a deleted file
+			continue
+		}
+		mt.Run(tt.name, func(mt *mtest.T) {
+			repo := repository.NewFileRepository(mt.DB, repository.NewOutboxRepository(mt.DB))
+			files := NewFileService(repo, local, nil, DefaultUploadPolicy(), nil, nil, nil)
+			jobs := NewJobService(repository.NewJobRepository(mt.DB), JobConfig{})
+			exports := NewExportService(repo, local, nil, jobs, ExportConfig{})
+			id := primitive.NewObjectID()
+			mt.AddMockResponses(mtest.CreateCursorResponse(0, "analyticsai.files", mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: id},
+				{Key: "user_id", Value: 1},
+				{Key: "status", Value: models.FileStatusDeleted},
+				{Key: "analysis", Value: bson.D{{Key: "encoding", Value: "ascii"}}},
+			}))
+
+			err := tt.call(context.Background(), files, exports, id)
+			if tt.name == "GetFile" {
+				if err != nil {
+					mt.Fatalf("GetFile of a deleted file: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, errFileDeleted) {
+				mt.Fatalf("error = %v, want %v", err, errFileDeleted)
+			}
+		})
+	}
+}
+
+// TestAppendToFileDeletedDuringAppend checks that the bytes charged for an
+// append are released when the file is deleted before the append is
+// recorded, since deleting the file only released its recorded size.
+func TestAppendToFileDeletedDuringAppend(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("append", func(mt *mtest.T) {
+		local, err := storage.NewLocalStorage(storage.LocalStorageConfig{BaseDir: t.TempDir()})
+		if err != nil {
+			mt.Fatal(err)
+		}
+		key, err := local.UploadFile(context.Background(), strings.NewReader(""), "app.log", "text/plain")
+		if err != nil {
+			mt.Fatal(err)
+		}
+		quotas := NewQuotaService(repository.NewQuotaRepository(mt.DB), QuotaConfig{})
+		files := NewFileService(repository.NewFileRepository(mt.DB, repository.NewOutboxRepository(mt.DB)), local, quotas, DefaultUploadPolicy(), nil, nil, nil)
+
+		id := primitive.NewObjectID()
+		file := func(status models.FileStatus) bson.D {
+			return mtest.CreateCursorResponse(0, "analyticsai.files", mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: id},
+				{Key: "user_id", Value: 1},
+				{Key: "storage_key", Value: key},
+				{Key: "status", Value: status},
+				{Key: "version", Value: int64(1)},
+				{Key: "redaction", Value: bson.D{{Key: "mode", Value: models.RedactionModeOff}}},
+			})
+		}
+		mt.AddMockResponses(
+			file(models.FileStatusActive),
+			updated(1), updated(1), // bytes reserved
+			bson.D{{Key: "ok", Value: 1}, {Key: "isWritablePrimary", Value: true}},
+			bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: nil}},
+			mtest.CreateCursorResponse(0, "analyticsai.files", mtest.FirstBatch, bson.D{{Key: "n", Value: 1}}),
+			file(models.FileStatusDeleted),
+			updated(1), // bytes released
+		)
+
+		_, err = files.AppendFile(context.Background(), 1, id, strings.NewReader("a new line\n"))
+		if !errors.Is(err, apperrors.ErrInvalidState) {
+			mt.Fatalf("error = %v, want %v", err, apperrors.ErrInvalidState)
+		}
+
+		var charged, released int64
+		for _, event := range mt.GetAllStartedEvents() {
+			if event.CommandName != "update" || event.Command.Lookup("update").StringValue() != "quotas" {
+				continue
+			}
+			u := event.Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("u")
+			if update, ok := u.DocumentOK(); ok {
+				if inc, ok := update.Lookup("$inc").DocumentOK(); ok {
+					charged += inc.Lookup("used_bytes").AsInt64()
+				}
+			}
+			if stages, ok := u.ArrayOK(); ok {
+				subtract := stages.Index(0).Value().Document().Lookup("$set", "used_bytes", "$max").Array().Index(1).Value().Document().Lookup("$subtract").Array()
+				released += subtract.Index(1).Value().AsInt64()
+			}
+		}
+		if charged != int64(len("a new line\n")) || released != charged {
+			mt.Errorf("charged %d bytes and released %d, want %d released", charged, released, len("a new line\n"))
+		}
+	})
+}
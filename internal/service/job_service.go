@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+	"user-service/internal/apperrors"
+	"user-service/internal/models"
+	"user-service/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// JobConfig controls the background job worker pool.
+type JobConfig struct {
+	// Workers is the number of jobs run concurrently.
+	Workers int
+
+	// QueueSize is the number of jobs that can wait for a worker.
+	QueueSize int
+
+	// SweepInterval is how often unfinished jobs are re-queued, and how long
+	// a job must have been waiting to count as stuck.
+	SweepInterval time.Duration
+}
+
+// JobRunner performs one type of job and returns the file it produced.
+type JobRunner func(ctx context.Context, job *models.Job) (*models.File, error)
+
+// JobService runs jobs that produce derived files on a pool of background
+// workers. Services register a runner for each type of job they create.
+type JobService struct {
+	repo    *repository.JobRepository
+	config  JobConfig
+	queue   chan primitive.ObjectID
+	runners map[models.JobType]JobRunner
+
+	// inFlight holds IDs that are queued or running so the sweeper doesn't
+	// queue them twice.
+	inFlight sync.Map
+}
+
+func NewJobService(repo *repository.JobRepository, config JobConfig) *JobService {
+	if config.Workers <= 0 {
+		config.Workers = 1
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = 100
+	}
+	if config.SweepInterval <= 0 {
+		config.SweepInterval = 5 * time.Minute
+	}
+	return &JobService{
+		repo:    repo,
+		config:  config,
+		queue:   make(chan primitive.ObjectID, config.QueueSize),
+		runners: make(map[models.JobType]JobRunner),
+	}
+}
+
+// Register sets the runner for a type of job. Runners must be registered
+// before Start.
+func (s *JobService) Register(jobType models.JobType, run JobRunner) {
+	s.runners[jobType] = run
+}
+
+// Start launches the workers and the sweeper. They stop when ctx is done.
+func (s *JobService) Start(ctx context.Context) {
+	slog.InfoContext(ctx, "Starting job workers", "op", "JobService.Start", "workers", s.config.Workers)
+	for i := 0; i < s.config.Workers; i++ {
+		go s.worker(ctx)
+	}
+	go s.sweep(ctx)
+}
+
+// Submit stores a new job and queues it.
+func (s *JobService) Submit(ctx context.Context, job *models.Job) error {
+	if err := s.repo.Create(ctx, job); err != nil {
+		return err
+	}
+	s.enqueue(job.ID)
+	return nil
+}
+
+// Get returns one of the user's jobs.
+func (s *JobService) Get(ctx context.Context, userID uint, id primitive.ObjectID) (*models.Job, error) {
+	job, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if job.UserID != userID {
+		slog.WarnContext(ctx, "User does not own job", "op", "JobService.Get", "user_id", userID, "job_id", id.Hex())
+		return nil, apperrors.ErrForbidden
+	}
+	return job, nil
+}
+
+// enqueue queues a job. When the queue is full the job stays queued in the
+// database and is picked up by the next sweep.
+func (s *JobService) enqueue(id primitive.ObjectID) {
+	if _, queued := s.inFlight.LoadOrStore(id, struct{}{}); queued {
+		return
+	}
+	select {
+	case s.queue <- id:
+		slog.Debug("Queued job", "op", "JobService.enqueue", "job_id", id.Hex())
+	default:
+		s.inFlight.Delete(id)
+		slog.Warn("Queue full, deferring job", "op", "JobService.enqueue", "job_id", id.Hex())
+	}
+}
+
+func (s *JobService) worker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-s.queue:
+			s.process(ctx, id)
+			s.inFlight.Delete(id)
+		}
+	}
+}
+
+// sweep periodically re-queues jobs that have been unfinished for longer
+// than the sweep interval, including jobs left over from a previous process.
+func (s *JobService) sweep(ctx context.Context) {
+	ticker := time.NewTicker(s.config.SweepInterval)
+	defer ticker.Stop()
+
+	for {
+		ids, err := s.repo.GetStale(ctx, time.Now().Add(-s.config.SweepInterval))
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to fetch stale jobs", "op", "JobService.sweep", "error", err)
+		}
+		for _, id := range ids {
+			s.enqueue(id)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *JobService) process(ctx context.Context, id primitive.ObjectID) {
+	job, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to fetch job", "op", "JobService.process", "job_id", id.Hex(), "error", err)
+		return
+	}
+	started, err := s.repo.Start(ctx, id)
+	if err != nil || !started {
+		return
+	}
+	slog.InfoContext(ctx, "Running job", "op", "JobService.process", "type", job.Type, "job_id", id.Hex())
+
+	run, ok := s.runners[job.Type]
+	if !ok {
+		slog.ErrorContext(ctx, "No runner for job type", "op", "JobService.process", "type", job.Type)
+		_ = s.repo.Fail(ctx, id, "unsupported job type")
+		return
+	}
+
+	result, err := run(ctx, job)
+	if err != nil {
+		slog.WarnContext(ctx, "Job failed", "op", "JobService.process", "job_id", id.Hex(), "error", err)
+		// Only the client-safe message is stored
+		if err := s.repo.Fail(ctx, id, apperrors.From(err).Message); err != nil {
+			slog.ErrorContext(ctx, "Failed to record failure of job", "op", "JobService.process", "job_id", id.Hex(), "error", err)
+		}
+		return
+	}
+	if err := s.repo.Complete(ctx, id, result.ID); err != nil {
+		slog.ErrorContext(ctx, "Failed to record completion of job", "op", "JobService.process", "job_id", id.Hex(), "error", err)
+		return
+	}
+	slog.InfoContext(ctx, "Job produced file", "op", "JobService.process", "job_id", id.Hex(), "file_id", result.ID.Hex())
+}
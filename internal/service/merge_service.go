@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"path"
+	"slices"
+	"strings"
+	"user-service/internal/apperrors"
+	"user-service/internal/merge"
+	"user-service/internal/models"
+	"user-service/internal/parser"
+	"user-service/internal/repository"
+	"user-service/pkg/storage"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MergeConfig limits merges.
+type MergeConfig struct {
+	// MaxFiles is the most files one merge reads. Each is streamed from
+	// storage at the same time. Default 20.
+	MaxFiles int
+}
+
+const maxMergeNameLength = 255
+
+// MergeService interleaves the records of several files into one stream
+// ordered by timestamp, either streamed to the client or stored as a derived
+// file by a background job.
+type MergeService struct {
+	files   *repository.FileRepository
+	storage storage.Storage
+	derived derivedFiles
+	jobs    *JobService
+	config  MergeConfig
+}
+
+func NewMergeService(files *repository.FileRepository, storage storage.Storage, quotas *QuotaService, jobs *JobService, config MergeConfig) *MergeService {
+	if config.MaxFiles <= 0 {
+		config.MaxFiles = 20
+	}
+	s := &MergeService{
+		files:   files,
+		storage: storage,
+		derived: derivedFiles{files: files, storage: storage, quotas: quotas},
+		jobs:    jobs,
+		config:  config,
+	}
+	jobs.Register(models.JobTypeMerge, s.run)
+	return s
+}
+
+// Merge merges the user's files. Unless req.Save is set the result is
+// written to the writer returned by open, which is only called once every
+// file has been opened; otherwise a job that stores the result is returned.
+func (s *MergeService) Merge(ctx context.Context, userID uint, req models.MergeRequest, open func(merge.Format) io.Writer) (*models.Job, error) {
+	slog.InfoContext(ctx, "Merging files", "op", "MergeService.Merge", "files", len(req.FileIDs))
+
+	format, err := s.validate(req)
+	if err != nil {
+		return nil, err
+	}
+	files, err := s.load(ctx, userID, req.FileIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Save {
+		job := &models.Job{
+			UserID: userID,
+			Type:   models.JobTypeMerge,
+			Merge:  &req,
+		}
+		if err := s.jobs.Submit(ctx, job); err != nil {
+			return nil, err
+		}
+		slog.InfoContext(ctx, "Queued merge job", "op", "MergeService.Merge", "job_id", job.ID.Hex())
+		return job, nil
+	}
+
+	return nil, s.write(ctx, files, format, func() io.Writer { return open(format) })
+}
+
+// run is the JobRunner for merge jobs.
+func (s *MergeService) run(ctx context.Context, job *models.Job) (*models.File, error) {
+	req := *job.Merge
+	format, err := s.validate(req)
+	if err != nil {
+		return nil, err
+	}
+	files, err := s.load(ctx, job.UserID, req.FileIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	name := mergeName(req.Name, format)
+	return s.derived.save(ctx, job, name, format.ContentType(), models.DerivedFrom{FileIDs: req.FileIDs}, func(w io.Writer) error {
+		return s.write(ctx, files, format, func() io.Writer { return w })
+	})
+}
+
+// load fetches the files to merge and checks that the user owns them and
+// that their records can be read.
+func (s *MergeService) load(ctx context.Context, userID uint, ids []primitive.ObjectID) ([]*models.File, error) {
+	files := make([]*models.File, len(ids))
+	for i, id := range ids {
+		file, err := s.files.GetByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if file.UserID != userID {
+			slog.WarnContext(ctx, "User does not own file", "op", "MergeService.load", "user_id", userID, "file_id", id.Hex())
+			return nil, apperrors.ErrForbidden
+		}
+		if err := exportable(file); err != nil {
+			return nil, apperrors.From(err).WithDetails(map[string]any{"file_id": id.Hex()})
+		}
+		files[i] = file
+	}
+	return files, nil
+}
+
+// write streams the merged records of files to the writer returned by open.
+func (s *MergeService) write(ctx context.Context, files []*models.File, format merge.Format, open func() io.Writer) error {
+	sources := make([]merge.Source, len(files))
+	for i, file := range files {
+		reader, err := s.storage.DownloadFile(ctx, file.StorageKey)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to open file", "op", "MergeService.write", "file_id", file.ID.Hex(), "error", err)
+			return apperrors.Storage(err)
+		}
+		defer reader.Close()
+
+		logFormat := models.LogFormatText
+		if file.Format != nil {
+			logFormat = file.Format.Format
+		}
+		sources[i] = parser.NewScanner(reader, logFormat)
+	}
+
+	writer := merge.NewWriter(open(), format)
+	var written int64
+	err := merge.Merge(ctx, sources, func(source int, record parser.Record) error {
+		written++
+		return writer.Write(merge.File{ID: files[source].ID.Hex(), Name: files[source].Name}, record)
+	})
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Merge failed", "op", "MergeService.write", "written", written, "error", err)
+		return apperrors.Storage(err)
+	}
+	slog.InfoContext(ctx, "Merged files", "op", "MergeService.write", "written", written, "files", len(files))
+	return nil
+}
+
+func (s *MergeService) validate(req models.MergeRequest) (merge.Format, error) {
+	if len(req.FileIDs) < 2 || len(req.FileIDs) > s.config.MaxFiles {
+		return "", apperrors.New(apperrors.ErrInvalidRequest, fmt.Sprintf("between 2 and %d files can be merged", s.config.MaxFiles))
+	}
+	seen := make(map[primitive.ObjectID]bool, len(req.FileIDs))
+	for _, id := range req.FileIDs {
+		if seen[id] {
+			return "", apperrors.New(apperrors.ErrInvalidRequest, fmt.Sprintf("file %s is listed more than once", id.Hex()))
+		}
+		seen[id] = true
+	}
+
+	format := merge.Format(req.Format)
+	if format == "" {
+		format = merge.FormatNDJSON
+	}
+	if !slices.Contains(merge.Formats, format) {
+		return "", apperrors.New(apperrors.ErrInvalidRequest, fmt.Sprintf("unknown merge format %q", req.Format)).
+			WithDetails(map[string]any{"allowed_formats": merge.Formats})
+	}
+	if len(req.Name) > maxMergeNameLength {
+		return "", apperrors.New(apperrors.ErrInvalidRequest, fmt.Sprintf("name must be at most %d characters", maxMergeNameLength))
+	}
+	return format, nil
+}
+
+// mergeName returns the name of a stored merge: the requested name without
+// any directories, or "merged", with the format's extension if it has none.
+func mergeName(requested string, format merge.Format) string {
+	name := path.Base(strings.ReplaceAll(strings.TrimSpace(requested), "\\", "/"))
+	if name == "." || name == "/" {
+		name = "merged"
+	}
+	if path.Ext(name) == "" {
+		name += format.Extension()
+	}
+	return name
+}
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sort"
+	"time"
+	"user-service/internal/models"
+	"user-service/internal/outbox"
+	"user-service/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OutboxConfig controls the outbox relay.
+type OutboxConfig struct {
+	// PollInterval is how often the relay looks for unpublished events.
+	PollInterval time.Duration
+
+	// BatchSize is the number of events read per poll.
+	BatchSize int
+
+	// LeaseTTL is how long a relay keeps the lease without renewing it.
+	// Only the relay holding the lease publishes, so one instance publishes
+	// at a time.
+	LeaseTTL time.Duration
+
+	// GapTimeout is how long the relay waits for a missing event of a file,
+	// one whose transaction has not committed yet, before it publishes the
+	// file's later events anyway.
+	GapTimeout time.Duration
+}
+
+// OutboxRelay publishes the events recorded in the outbox. The events of a
+// file are published in sequence order, each after the one before it has
+// been accepted; an event that fails is retried on the next poll, and later
+// events of the same file wait for it. Events are published at least once,
+// with their outbox ID as the deduplication ID.
+type OutboxRelay struct {
+	repo      *repository.OutboxRepository
+	publisher outbox.Publisher
+	config    OutboxConfig
+	owner     string
+}
+
+// NewOutboxRelay returns a relay that publishes events to publisher under
+// a lease owner unique to this instance.
+func NewOutboxRelay(repo *repository.OutboxRepository, publisher outbox.Publisher, config OutboxConfig) *OutboxRelay {
+	if config.PollInterval <= 0 {
+		config.PollInterval = time.Second
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+	if config.LeaseTTL <= 0 {
+		config.LeaseTTL = 30 * time.Second
+	}
+	if config.GapTimeout <= 0 {
+		config.GapTimeout = time.Minute
+	}
+	return &OutboxRelay{repo: repo, publisher: publisher, config: config, owner: primitive.NewObjectID().Hex()}
+}
+
+// Start runs the relay until ctx is done.
+func (r *OutboxRelay) Start(ctx context.Context) {
+	slog.InfoContext(ctx, "Starting outbox relay", "op", "OutboxRelay.Start", "owner", r.owner)
+	go r.run(ctx)
+}
+
+func (r *OutboxRelay) run(ctx context.Context) {
+	ticker := time.NewTicker(r.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		for ctx.Err() == nil {
+			held, err := r.repo.AcquireLease(ctx, r.owner, r.config.LeaseTTL)
+			if err != nil || !held {
+				break
+			}
+			// A full batch means more events may be waiting
+			if published := r.relay(ctx); published < r.config.BatchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// relay publishes a batch of pending events and returns how many were
+// published.
+func (r *OutboxRelay) relay(ctx context.Context) int {
+	events, err := r.repo.Pending(ctx, r.config.BatchSize)
+	if err != nil || len(events) == 0 {
+		return 0
+	}
+
+	byFile := make(map[primitive.ObjectID][]*models.OutboxEvent)
+	var fileIDs []primitive.ObjectID
+	for i := range events {
+		event := &events[i]
+		if _, ok := byFile[event.FileID]; !ok {
+			fileIDs = append(fileIDs, event.FileID)
+		}
+		byFile[event.FileID] = append(byFile[event.FileID], event)
+	}
+	published, err := r.repo.PublishedSequences(ctx, fileIDs)
+	if err != nil {
+		return 0
+	}
+
+	count := 0
+	for _, fileID := range fileIDs {
+		fileEvents := byFile[fileID]
+		sort.Slice(fileEvents, func(i, j int) bool { return fileEvents[i].Sequence < fileEvents[j].Sequence })
+
+		next := published[fileID] + 1
+		for _, event := range fileEvents {
+			if event.Sequence > next && time.Since(event.CreatedAt) < r.config.GapTimeout {
+				// An earlier event of the file may still be committing
+				break
+			}
+			if event.Sequence > next {
+				slog.WarnContext(ctx, "Skipping missing events", "op", "OutboxRelay.relay", "file_id", fileID.Hex(), "from", next, "to", event.Sequence-1)
+			}
+			if err := r.publish(ctx, event); err != nil {
+				break
+			}
+			next = event.Sequence + 1
+			count++
+		}
+	}
+	return count
+}
+
+func (r *OutboxRelay) publish(ctx context.Context, event *models.OutboxEvent) error {
+	msg := outbox.Message{
+		ID:       event.ID.Hex(),
+		Type:     string(event.Type),
+		FileID:   event.FileID.Hex(),
+		UserID:   event.UserID,
+		Sequence: event.Sequence,
+		Time:     event.CreatedAt,
+		Data:     json.RawMessage(event.Payload),
+	}
+	if err := r.publisher.Publish(ctx, msg); err != nil {
+		slog.ErrorContext(ctx, "Failed to publish event", "op", "OutboxRelay.publish", "event_id", msg.ID, "error", err)
+		r.repo.MarkFailed(ctx, event.ID, err.Error())
+		return err
+	}
+	return r.repo.MarkPublished(ctx, event)
+}
@@ -0,0 +1,288 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"user-service/internal/apperrors"
+	"user-service/internal/models"
+	"user-service/internal/notify"
+	"user-service/internal/preview"
+	"user-service/internal/repository"
+	"user-service/internal/search"
+	"user-service/pkg/storage"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// maxSavedQueries caps the queries a user can save.
+	maxSavedQueries = 50
+
+	maxQueryNameLength = 100
+
+	// alertSamples is the number of matching lines stored with an alert.
+	alertSamples = 5
+
+	defaultAlertLimit = 50
+	maxAlertLimit     = 500
+)
+
+// QueryService manages users' saved queries and runs them against each file
+// that finishes analysis, recording an alert and notifying the user when a
+// query matches more lines than its threshold.
+type QueryService struct {
+	queries  *repository.SavedQueryRepository
+	alerts   *repository.AlertRepository
+	files    *repository.FileRepository
+	storage  storage.Storage
+	notifier notify.Notifier
+}
+
+func NewQueryService(queries *repository.SavedQueryRepository, alerts *repository.AlertRepository, files *repository.FileRepository, storage storage.Storage, notifier notify.Notifier) *QueryService {
+	return &QueryService{
+		queries:  queries,
+		alerts:   alerts,
+		files:    files,
+		storage:  storage,
+		notifier: notifier,
+	}
+}
+
+func (s *QueryService) Create(ctx context.Context, userID uint, req models.SavedQueryRequest) (*models.SavedQuery, error) {
+	query, err := newSavedQuery(req)
+	if err != nil {
+		return nil, err
+	}
+	count, err := s.queries.CountByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if count >= maxSavedQueries {
+		return nil, apperrors.New(apperrors.ErrInvalidRequest, fmt.Sprintf("at most %d queries can be saved", maxSavedQueries)).
+			WithDetails(map[string]any{"max_queries": maxSavedQueries})
+	}
+
+	query.UserID = userID
+	if err := s.queries.Create(ctx, query); err != nil {
+		return nil, err
+	}
+	slog.InfoContext(ctx, "Saved query", "op", "QueryService.Create", "query_id", query.ID.Hex(), "user_id", userID)
+	return query, nil
+}
+
+func (s *QueryService) List(ctx context.Context, userID uint) ([]models.SavedQuery, error) {
+	return s.queries.ListByUser(ctx, userID)
+}
+
+func (s *QueryService) Get(ctx context.Context, userID uint, id primitive.ObjectID) (*models.SavedQuery, error) {
+	query, err := s.queries.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if query.UserID != userID {
+		slog.WarnContext(ctx, "User does not own query", "op", "QueryService.Get", "user_id", userID, "query_id", id.Hex())
+		return nil, apperrors.ErrForbidden
+	}
+	return query, nil
+}
+
+// Update replaces a saved query. Files it has already alerted on are not
+// alerted on again.
+func (s *QueryService) Update(ctx context.Context, userID uint, id primitive.ObjectID, req models.SavedQueryRequest) (*models.SavedQuery, error) {
+	existing, err := s.Get(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	query, err := newSavedQuery(req)
+	if err != nil {
+		return nil, err
+	}
+	query.ID = existing.ID
+	query.UserID = existing.UserID
+	query.CreatedAt = existing.CreatedAt
+	if err := s.queries.Update(ctx, query); err != nil {
+		return nil, err
+	}
+	return query, nil
+}
+
+// Delete removes a saved query. Its alerts are kept.
+func (s *QueryService) Delete(ctx context.Context, userID uint, id primitive.ObjectID) error {
+	if _, err := s.Get(ctx, userID, id); err != nil {
+		return err
+	}
+	return s.queries.Delete(ctx, id)
+}
+
+// ListAlerts returns a user's most recent alerts.
+func (s *QueryService) ListAlerts(ctx context.Context, userID uint, req models.AlertListRequest) ([]models.Alert, error) {
+	if req.Limit == 0 {
+		req.Limit = defaultAlertLimit
+	}
+	if req.Limit < 0 || req.Limit > maxAlertLimit {
+		return nil, apperrors.New(apperrors.ErrInvalidRequest, fmt.Sprintf("limit must be between 1 and %d", maxAlertLimit))
+	}
+	var queryID *primitive.ObjectID
+	if req.QueryID != "" {
+		id, err := primitive.ObjectIDFromHex(req.QueryID)
+		if err != nil {
+			return nil, apperrors.New(apperrors.ErrInvalidRequest, "invalid query ID")
+		}
+		queryID = &id
+	}
+	return s.alerts.List(ctx, userID, queryID, req.Limit)
+}
+
+// Evaluate runs the owner's matching queries against a file. It is called
+// when the file's analysis is stored, so a file that is re-analyzed after an
+// append is searched again. A query alerts at most once per version of a
+// file, and again on a later version only when it matches more lines than
+// it did when it last alerted.
+func (s *QueryService) Evaluate(ctx context.Context, id primitive.ObjectID) {
+	file, err := s.files.GetByID(ctx, id)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to fetch file", "op", "QueryService.Evaluate", "file_id", id.Hex(), "error", err)
+		return
+	}
+	if file.Status == models.FileStatusDeleted || file.Extraction != nil || file.Analysis == nil || !preview.Ranged(file.Analysis.Encoding) {
+		return
+	}
+
+	var format models.LogFormat
+	if file.Format != nil {
+		format = file.Format.Format
+	}
+	queries, err := s.queries.FindMatching(ctx, file.UserID, format, file.Tags)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to fetch queries for file", "op", "QueryService.Evaluate", "file_id", id.Hex(), "error", err)
+		return
+	}
+	for i := range queries {
+		if err := s.evaluate(ctx, file, &queries[i]); err != nil {
+			slog.ErrorContext(ctx, "Query failed on file", "op", "QueryService.Evaluate", "query_id", queries[i].ID.Hex(), "file_id", id.Hex(), "error", err)
+		}
+	}
+}
+
+func (s *QueryService) evaluate(ctx context.Context, file *models.File, query *models.SavedQuery) error {
+	last, err := s.alerts.Latest(ctx, query.ID, file.ID)
+	if err != nil {
+		return err
+	}
+	if last != nil && last.FileVersion >= file.Version {
+		return nil
+	}
+
+	q := search.Query{
+		Pattern:    query.Query,
+		Regex:      query.Regex,
+		IgnoreCase: query.IgnoreCase,
+		MaxMatches: maxSearchMatches,
+	}
+	re, err := search.Compile(q)
+	if err != nil {
+		return err
+	}
+
+	budget, cancel := context.WithTimeout(ctx, searchTimeout)
+	defer cancel()
+
+	reader, err := s.storage.DownloadFile(budget, file.StorageKey)
+	if err != nil {
+		return apperrors.Storage(err)
+	}
+	defer reader.Close()
+
+	samples := []models.AlertSample{}
+	summary, err := search.Search(budget, reader, re, q, file.Analysis.Encoding, func(result search.Result) error {
+		if result.Type == search.ResultMatch && len(samples) < alertSamples {
+			samples = append(samples, models.AlertSample{Line: result.Line, Text: result.Text})
+		}
+		return nil
+	})
+	timedOut := err != nil && ctx.Err() == nil && errors.Is(budget.Err(), context.DeadlineExceeded)
+	if err != nil && !timedOut {
+		return err
+	}
+	if !shouldAlert(last, summary.Matches, query.Threshold) {
+		return nil
+	}
+
+	alert := &models.Alert{
+		UserID:       file.UserID,
+		QueryID:      query.ID,
+		QueryName:    query.Name,
+		FileID:       file.ID,
+		FileName:     file.Name,
+		FileVersion:  file.Version,
+		Matches:      summary.Matches,
+		Threshold:    query.Threshold,
+		LimitReached: summary.LimitReached || timedOut,
+		Samples:      samples,
+	}
+	created, err := s.alerts.Create(ctx, alert)
+	if err != nil || !created {
+		return err
+	}
+	slog.InfoContext(ctx, "Query matched", "op", "QueryService.evaluate", "query_id", query.ID.Hex(), "matches", summary.Matches, "file_id", file.ID.Hex())
+
+	event := notify.Event{
+		ID:     alert.ID.Hex(),
+		Type:   notify.EventAlertFired,
+		UserID: alert.UserID,
+		Time:   alert.CreatedAt,
+		Data:   alert,
+	}
+	if err := s.notifier.Notify(ctx, event); err != nil {
+		slog.ErrorContext(ctx, "Failed to deliver alert", "op", "QueryService.evaluate", "alert_id", alert.ID.Hex(), "error", err)
+	}
+	return nil
+}
+
+// shouldAlert reports whether a search with matches matching lines alerts,
+// given the query's last alert on an earlier version of the file, if any. A
+// file that grew without new matches doesn't repeat its alert.
+func shouldAlert(last *models.Alert, matches, threshold int64) bool {
+	if matches <= threshold {
+		return false
+	}
+	return last == nil || matches > last.Matches
+}
+
+// newSavedQuery validates a request and builds the query it describes.
+func newSavedQuery(req models.SavedQueryRequest) (*models.SavedQuery, error) {
+	if len(req.Name) > maxQueryNameLength {
+		return nil, apperrors.New(apperrors.ErrInvalidRequest, fmt.Sprintf("name must be at most %d characters", maxQueryNameLength))
+	}
+	if _, err := search.Compile(search.Query{Pattern: req.Query, Regex: req.Regex, IgnoreCase: req.IgnoreCase, MaxMatches: 1}); err != nil {
+		return nil, apperrors.Wrap(apperrors.ErrInvalidRequest, err, err.Error())
+	}
+	if req.Threshold < 0 || req.Threshold >= maxSearchMatches {
+		return nil, apperrors.New(apperrors.ErrInvalidRequest, fmt.Sprintf("threshold must be between 0 and %d", maxSearchMatches-1))
+	}
+	if req.Filter.Format != "" && !slices.Contains(models.LogFormats, req.Filter.Format) {
+		return nil, apperrors.New(apperrors.ErrInvalidRequest, fmt.Sprintf("unknown format %q", req.Filter.Format)).
+			WithDetails(map[string]any{"allowed_formats": models.LogFormats})
+	}
+	tags, err := normalizeTags(req.Filter.Tags)
+	if err != nil {
+		return nil, err
+	}
+
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+	return &models.SavedQuery{
+		Name:       req.Name,
+		Query:      req.Query,
+		Regex:      req.Regex,
+		IgnoreCase: req.IgnoreCase,
+		Filter:     models.QueryFilter{Tags: tags, Format: req.Filter.Format},
+		Threshold:  req.Threshold,
+		Enabled:    enabled,
+	}, nil
+}
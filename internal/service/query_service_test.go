@@ -0,0 +1,29 @@
+package service
+
+import (
+	"testing"
+	"user-service/internal/models"
+)
+
+func TestShouldAlert(t *testing.T) {
+	tests := []struct {
+		name      string
+		last      *models.Alert
+		matches   int64
+		threshold int64
+		want      bool
+	}{
+		{"at the threshold", nil, 5, 5, false},
+		{"over the threshold", nil, 6, 5, true},
+		{"appended lines with new matches", &models.Alert{FileVersion: 1, Matches: 6}, 9, 5, true},
+		{"appended lines without new matches", &models.Alert{FileVersion: 1, Matches: 6}, 6, 5, false},
+		{"threshold raised since the last alert", &models.Alert{FileVersion: 1, Matches: 6}, 9, 10, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shouldAlert(tt.last, tt.matches, tt.threshold); got != tt.want {
+				t.Errorf("shouldAlert = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
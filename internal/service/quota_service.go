@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"user-service/internal/apperrors"
+	"user-service/internal/models"
+	"user-service/internal/repository"
+)
+
+// QuotaConfig holds the default limits applied to users without a per-user
+// override. A value of 0 disables the corresponding limit.
+type QuotaConfig struct {
+	MaxBytes int64
+	MaxFiles int64
+}
+
+type QuotaService struct {
+	repo   *repository.QuotaRepository
+	config QuotaConfig
+}
+
+func NewQuotaService(repo *repository.QuotaRepository, config QuotaConfig) *QuotaService {
+	return &QuotaService{
+		repo:   repo,
+		config: config,
+	}
+}
+
+// Usage returns the user's current consumption and effective limits.
+func (s *QuotaService) Usage(ctx context.Context, userID uint) (*models.UsageResponse, error) {
+	quota, err := s.repo.Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.usage(quota), nil
+}
+
+// SetLimits stores a user's quota overrides and returns the user's usage
+// against the new limits. Usage above a lowered limit is kept; the user
+// just can't store more until it drops below the limit.
+func (s *QuotaService) SetLimits(ctx context.Context, userID uint, req models.QuotaLimitsRequest) (*models.UsageResponse, error) {
+	if (req.MaxBytes != nil && *req.MaxBytes < 0) || (req.MaxFiles != nil && *req.MaxFiles < 0) {
+		return nil, apperrors.New(apperrors.ErrInvalidRequest, "limits must not be negative")
+	}
+	quota, err := s.repo.SetLimits(ctx, userID, req.MaxBytes, req.MaxFiles)
+	if err != nil {
+		return nil, err
+	}
+	slog.InfoContext(ctx, "Set quota limits", "op", "QuotaService.SetLimits", "user_id", userID)
+	return s.usage(quota), nil
+}
+
+// usage applies the default limits to a quota without overrides.
+func (s *QuotaService) usage(quota *models.UserQuota) *models.UsageResponse {
+	usage := &models.UsageResponse{
+		UserID:    quota.UserID,
+		UsedBytes: quota.UsedBytes,
+		UsedFiles: quota.UsedFiles,
+		MaxBytes:  s.config.MaxBytes,
+		MaxFiles:  s.config.MaxFiles,
+	}
+	if quota.MaxBytes != nil {
+		usage.MaxBytes = *quota.MaxBytes
+	}
+	if quota.MaxFiles != nil {
+		usage.MaxFiles = *quota.MaxFiles
+	}
+	return usage
+}
+
+// RemainingBytes returns how many more bytes the user may store, or -1 when
+// the byte quota is unlimited. It fails with apperrors.ErrQuotaExceeded when
+// the user has no room left for another file.
+func (s *QuotaService) RemainingBytes(ctx context.Context, userID uint) (int64, error) {
+	usage, err := s.Usage(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	if usage.MaxFiles > 0 && usage.UsedFiles >= usage.MaxFiles {
+		return 0, quotaError(fmt.Sprintf("file limit of %d reached", usage.MaxFiles), usage)
+	}
+	if usage.MaxBytes <= 0 {
+		return -1, nil
+	}
+	if usage.UsedBytes >= usage.MaxBytes {
+		return 0, quotaError(fmt.Sprintf("storage quota of %d bytes is used up", usage.MaxBytes), usage)
+	}
+	return usage.MaxBytes - usage.UsedBytes, nil
+}
+
+// Reserve atomically charges a new file of the given size against the user's
+// quota.
+func (s *QuotaService) Reserve(ctx context.Context, userID uint, size int64) error {
+	ok, err := s.repo.Reserve(ctx, userID, size, 1, s.config.MaxBytes, s.config.MaxFiles)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		slog.WarnContext(ctx, "Quota exceeded", "op", "QuotaService.Reserve", "user_id", userID, "size", size)
+		return apperrors.New(apperrors.ErrQuotaExceeded, fmt.Sprintf("storing %d more bytes would exceed the storage quota", size))
+	}
+	return nil
+}
+
+// Release returns a file's bytes and slot to the user's quota.
+func (s *QuotaService) Release(ctx context.Context, userID uint, size int64) error {
+	return s.repo.Release(ctx, userID, size, 1)
+}
+
+// ReserveBytes atomically charges bytes added to an existing file against
+// the user's quota.
+func (s *QuotaService) ReserveBytes(ctx context.Context, userID uint, size int64) error {
+	ok, err := s.repo.Reserve(ctx, userID, size, 0, s.config.MaxBytes, s.config.MaxFiles)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		slog.WarnContext(ctx, "Quota exceeded", "op", "QuotaService.ReserveBytes", "user_id", userID, "size", size)
+		return apperrors.New(apperrors.ErrQuotaExceeded, fmt.Sprintf("storing %d more bytes would exceed the storage quota", size))
+	}
+	return nil
+}
+
+// ReleaseBytes returns bytes to the user's quota without freeing a file
+// slot.
+func (s *QuotaService) ReleaseBytes(ctx context.Context, userID uint, size int64) error {
+	return s.repo.Release(ctx, userID, size, 0)
+}
+
+func quotaError(message string, usage *models.UsageResponse) error {
+	return apperrors.New(apperrors.ErrQuotaExceeded, message).WithDetails(map[string]any{
+		"used_bytes": usage.UsedBytes,
+		"used_files": usage.UsedFiles,
+		"max_bytes":  usage.MaxBytes,
+		"max_files":  usage.MaxFiles,
+	})
+}
@@ -0,0 +1,196 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"user-service/internal/apperrors"
+	"user-service/internal/models"
+	"user-service/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// updated is the reply to an update that matched n documents.
+func updated(n int32) bson.D {
+	return bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: n}, {Key: "nModified", Value: n}}
+}
+
+// quotaReply is the reply to a find of a user's quota document.
+func quotaReply(quota bson.D) bson.D {
+	return mtest.CreateCursorResponse(0, "analyticsai.quotas", mtest.FirstBatch, quota)
+}
+
+func TestQuotaRemainingBytes(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	config := QuotaConfig{MaxBytes: 1000, MaxFiles: 10}
+
+	tests := []struct {
+		name  string
+		quota bson.D
+		want  int64
+		err   error
+	}{
+		{
+			name:  "room left under the defaults",
+			quota: bson.D{{Key: "user_id", Value: 1}, {Key: "used_bytes", Value: int64(400)}, {Key: "used_files", Value: int64(2)}},
+			want:  600,
+		},
+		{
+			name:  "byte quota used up",
+			quota: bson.D{{Key: "user_id", Value: 1}, {Key: "used_bytes", Value: int64(1000)}, {Key: "used_files", Value: int64(2)}},
+			err:   apperrors.ErrQuotaExceeded,
+		},
+		{
+			name:  "file limit reached",
+			quota: bson.D{{Key: "user_id", Value: 1}, {Key: "used_bytes", Value: int64(0)}, {Key: "used_files", Value: int64(10)}},
+			err:   apperrors.ErrQuotaExceeded,
+		},
+		{
+			name: "override raises the byte limit",
+			quota: bson.D{{Key: "user_id", Value: 1}, {Key: "used_bytes", Value: int64(1000)}, {Key: "used_files", Value: int64(2)},
+				{Key: "max_bytes", Value: int64(5000)}},
+			want: 4000,
+		},
+		{
+			name: "override of 0 is unlimited",
+			quota: bson.D{{Key: "user_id", Value: 1}, {Key: "used_bytes", Value: int64(1000)}, {Key: "used_files", Value: int64(2)},
+				{Key: "max_bytes", Value: int64(0)}},
+			want: -1,
+		},
+	}
+
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			quotas := NewQuotaService(repository.NewQuotaRepository(mt.DB), config)
+			mt.AddMockResponses(quotaReply(tt.quota))
+
+			got, err := quotas.RemainingBytes(context.Background(), 1)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					mt.Fatalf("error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				mt.Fatal(err)
+			}
+			if got != tt.want {
+				mt.Errorf("RemainingBytes = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuotaReserve(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	config := QuotaConfig{MaxBytes: 1000, MaxFiles: 10}
+
+	mt.Run("within the quota", func(mt *mtest.T) {
+		quotas := NewQuotaService(repository.NewQuotaRepository(mt.DB), config)
+		mt.AddMockResponses(updated(1), updated(1))
+
+		if err := quotas.Reserve(context.Background(), 1, 300); err != nil {
+			mt.Fatal(err)
+		}
+
+		// The usage document is created first, then charged in a single
+		// update that only matches while the charge fits the limits
+		if upsert := mt.GetStartedEvent(); upsert.CommandName != "update" {
+			mt.Fatalf("first command = %s, want update", upsert.CommandName)
+		}
+		reserve := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		if _, err := reserve.Lookup("q", "$expr").Document().LookupErr("$and"); err != nil {
+			mt.Errorf("reservation filter has no limit check: %v", reserve.Lookup("q"))
+		}
+		inc := reserve.Lookup("u", "$inc").Document()
+		if inc.Lookup("used_bytes").AsInt64() != 300 || inc.Lookup("used_files").AsInt64() != 1 {
+			mt.Errorf("reservation charges %v, want 300 bytes and 1 file", inc)
+		}
+	})
+
+	mt.Run("over the quota", func(mt *mtest.T) {
+		quotas := NewQuotaService(repository.NewQuotaRepository(mt.DB), config)
+		mt.AddMockResponses(updated(1), updated(0))
+
+		err := quotas.Reserve(context.Background(), 1, 2000)
+		if !errors.Is(err, apperrors.ErrQuotaExceeded) {
+			mt.Fatalf("error = %v, want %v", err, apperrors.ErrQuotaExceeded)
+		}
+	})
+
+	mt.Run("bytes only", func(mt *mtest.T) {
+		quotas := NewQuotaService(repository.NewQuotaRepository(mt.DB), config)
+		mt.AddMockResponses(updated(1), updated(1))
+
+		if err := quotas.ReserveBytes(context.Background(), 1, 50); err != nil {
+			mt.Fatal(err)
+		}
+		mt.GetStartedEvent()
+		inc := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("u", "$inc").Document()
+		if inc.Lookup("used_files").AsInt64() != 0 {
+			mt.Errorf("appended bytes took a file slot: %v", inc)
+		}
+	})
+}
+
+func TestQuotaReleaseClampsAtZero(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("release", func(mt *mtest.T) {
+		quotas := NewQuotaService(repository.NewQuotaRepository(mt.DB), QuotaConfig{})
+		mt.AddMockResponses(updated(1))
+
+		if err := quotas.Release(context.Background(), 1, 300); err != nil {
+			mt.Fatal(err)
+		}
+
+		// Usage is set to max(0, used - released) in a pipeline update
+		stages := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("u").Array()
+		set := stages.Index(0).Value().Document().Lookup("$set").Document()
+		for _, field := range []string{"used_bytes", "used_files"} {
+			operands := set.Lookup(field, "$max").Array()
+			if operands.Index(0).Value().AsInt64() != 0 {
+				mt.Errorf("%s is not clamped at 0: %v", field, set.Lookup(field))
+			}
+		}
+	})
+}
+
+func TestQuotaSetLimits(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	config := QuotaConfig{MaxBytes: 1000, MaxFiles: 10}
+	limit := func(v int64) *int64 { return &v }
+
+	mt.Run("negative limit", func(mt *mtest.T) {
+		quotas := NewQuotaService(repository.NewQuotaRepository(mt.DB), config)
+
+		_, err := quotas.SetLimits(context.Background(), 1, models.QuotaLimitsRequest{MaxBytes: limit(-1)})
+		if !errors.Is(err, apperrors.ErrInvalidRequest) {
+			mt.Fatalf("error = %v, want %v", err, apperrors.ErrInvalidRequest)
+		}
+	})
+
+	mt.Run("override and default", func(mt *mtest.T) {
+		quotas := NewQuotaService(repository.NewQuotaRepository(mt.DB), config)
+		mt.AddMockResponses(bson.D{
+			{Key: "ok", Value: 1},
+			{Key: "value", Value: bson.D{{Key: "user_id", Value: 7}, {Key: "used_bytes", Value: int64(0)}, {Key: "max_bytes", Value: int64(5000)}}},
+		})
+
+		usage, err := quotas.SetLimits(context.Background(), 7, models.QuotaLimitsRequest{MaxBytes: limit(5000)})
+		if err != nil {
+			mt.Fatal(err)
+		}
+		if usage.UserID != 7 || usage.MaxBytes != 5000 || usage.MaxFiles != 10 {
+			mt.Errorf("usage = %+v, want user 7 with 5000 bytes and the default 10 files", usage)
+		}
+
+		// The file limit wasn't given, so its override is removed
+		update := mt.GetStartedEvent().Command.Lookup("update").Document()
+		if _, err := update.LookupErr("$unset", "max_files"); err != nil {
+			mt.Errorf("max_files override not removed: %v", update)
+		}
+	})
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+	"user-service/internal/apperrors"
+	"user-service/internal/index"
+	"user-service/internal/logtime"
+	"user-service/internal/models"
+	"user-service/internal/preview"
+	"user-service/internal/repository"
+	"user-service/internal/search"
+	"user-service/pkg/storage"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// defaultSearchHits is the number of lines returned when no limit is
+	// requested.
+	defaultSearchHits = 50
+
+	// maxSearchHits caps the lines returned by a single search.
+	maxSearchHits = 500
+
+	// maxSearchTerms caps the terms in a query.
+	maxSearchTerms = 10
+
+	// maxSearchChunks caps the index chunks read back from storage for a
+	// single search.
+	maxSearchChunks = 200
+)
+
+// SearchService searches across all of a user's active files using the
+// inverted index built during analysis.
+type SearchService struct {
+	files   *repository.FileRepository
+	index   *repository.SearchIndexRepository
+	storage storage.Storage
+}
+
+func NewSearchService(files *repository.FileRepository, index *repository.SearchIndexRepository, storage storage.Storage) *SearchService {
+	return &SearchService{
+		files:   files,
+		index:   index,
+		storage: storage,
+	}
+}
+
+// Search returns the lines of the user's active files that contain every
+// term of the query, grouped by file. Results are ranked by recency: files
+// and lines with the latest timestamps come first. When a time range is
+// given, only lines with a timestamp inside it match.
+func (s *SearchService) Search(ctx context.Context, userID uint, req models.LibrarySearchRequest) ([]models.LibrarySearchResult, error) {
+	slog.DebugContext(ctx, "Searching files", "op", "SearchService.Search", "user_id", userID)
+
+	terms := index.Tokenize(req.Query)
+	switch {
+	case len(terms) == 0:
+		return nil, apperrors.New(apperrors.ErrInvalidRequest, "query must contain at least one word of two or more characters")
+	case len(terms) > maxSearchTerms:
+		return nil, apperrors.New(apperrors.ErrInvalidRequest, fmt.Sprintf("query must contain at most %d words", maxSearchTerms))
+	case !req.From.IsZero() && !req.To.IsZero() && req.To.Before(req.From):
+		return nil, apperrors.New(apperrors.ErrInvalidRequest, "to must not be before from")
+	case req.Limit < 0 || req.Limit > maxSearchHits:
+		return nil, apperrors.New(apperrors.ErrInvalidRequest, fmt.Sprintf("limit must be between 1 and %d", maxSearchHits)).
+			WithDetails(map[string]any{"max_limit": maxSearchHits})
+	}
+	if req.Limit == 0 {
+		req.Limit = defaultSearchHits
+	}
+
+	files, err := s.files.GetByUserID(ctx, userID, models.FileFilter{Status: models.FileStatusActive})
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, nil
+	}
+	byID := make(map[primitive.ObjectID]*models.File, len(files))
+	ids := make([]primitive.ObjectID, 0, len(files))
+	for i := range files {
+		byID[files[i].ID] = &files[i]
+		ids = append(ids, files[i].ID)
+	}
+
+	chunks, err := s.index.Find(ctx, userID, ids, terms, req.From, req.To, maxSearchChunks)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []models.LibrarySearchResult
+	position := make(map[primitive.ObjectID]int)
+	hits := 0
+	for _, chunk := range chunks {
+		file := byID[chunk.FileID]
+		lines, err := s.matchChunk(ctx, file, chunk, terms, req.From, req.To)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to read chunk of file", "op", "SearchService.Search", "file_id", file.ID.Hex(), "error", err)
+			return nil, apperrors.Storage(err)
+		}
+		if len(lines) == 0 {
+			continue
+		}
+
+		i, ok := position[file.ID]
+		if !ok {
+			i = len(results)
+			position[file.ID] = i
+			results = append(results, models.LibrarySearchResult{FileID: file.ID, FileName: file.Name})
+		}
+		for _, line := range lines {
+			results[i].Hits = append(results[i].Hits, line)
+			if hits++; hits == req.Limit {
+				return results, nil
+			}
+		}
+	}
+	slog.InfoContext(ctx, "Search complete", "op", "SearchService.Search", "hits", hits, "files", len(results))
+	return results, nil
+}
+
+// matchChunk reads a chunk back from storage and returns its lines that
+// contain every term, last line first.
+func (s *SearchService) matchChunk(ctx context.Context, file *models.File, chunk models.IndexChunk, terms []string, from, to time.Time) ([]models.SearchHit, error) {
+	reader, err := storage.ReadRange(ctx, s.storage, file.StorageKey, chunk.StartOffset, chunk.EndOffset-chunk.StartOffset)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var encoding string
+	if file.Analysis != nil {
+		encoding = file.Analysis.Encoding
+	}
+
+	// Only the start of very long lines is kept, as in the other readers
+	var hits []models.SearchHit
+	buffered := bufio.NewReaderSize(reader, 64*1024)
+	var current []byte
+	number, offset, lineOffset := chunk.StartLine, chunk.StartOffset, chunk.StartOffset
+	for {
+		part, err := buffered.ReadSlice('\n')
+		offset += int64(len(part))
+		if room := search.MaxLineLength - len(current); len(part) > room {
+			part = part[:max(room, 0)]
+		}
+		current = append(current, part...)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if len(current) == 0 && err == io.EOF {
+			break
+		}
+
+		text := preview.Decode(bytes.TrimRight(current, "\r\n"), encoding)
+		if hit, ok := matchLine(text, number, lineOffset, terms, from, to); ok {
+			hits = append(hits, hit)
+		}
+		if err == io.EOF {
+			break
+		}
+		current, number, lineOffset = current[:0], number+1, offset
+	}
+
+	for i, j := 0, len(hits)-1; i < j; i, j = i+1, j-1 {
+		hits[i], hits[j] = hits[j], hits[i]
+	}
+	return hits, nil
+}
+
+// matchLine reports whether a line contains every term and, when a time
+// range is given, carries a timestamp inside it.
+func matchLine(text string, number, offset int64, terms []string, from, to time.Time) (models.SearchHit, bool) {
+	if !index.ContainsAll(text, terms) {
+		return models.SearchHit{}, false
+	}
+	hit := models.SearchHit{Line: number, Offset: offset, Text: text}
+	if t, ok := logtime.Extract(text); ok {
+		t = t.UTC()
+		hit.Timestamp = &t
+	}
+	if !from.IsZero() || !to.IsZero() {
+		if hit.Timestamp == nil || (!from.IsZero() && hit.Timestamp.Before(from)) || (!to.IsZero() && hit.Timestamp.After(to)) {
+			return models.SearchHit{}, false
+		}
+	}
+	return hit, true
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+	"user-service/internal/apperrors"
+	"user-service/internal/models"
+	"user-service/internal/repository"
+)
+
+type SettingsService struct {
+	repo *repository.SettingsRepository
+}
+
+func NewSettingsService(repo *repository.SettingsRepository) *SettingsService {
+	return &SettingsService{
+		repo: repo,
+	}
+}
+
+// Get returns the user's settings.
+func (s *SettingsService) Get(ctx context.Context, userID uint) (*models.UserSettings, error) {
+	return s.repo.Get(ctx, userID)
+}
+
+// Update applies the fields set in req to the user's settings.
+func (s *SettingsService) Update(ctx context.Context, userID uint, req models.UpdateSettingsRequest) (*models.UserSettings, error) {
+	if req.RedactionMode != nil && *req.RedactionMode != "" {
+		if err := validateRedactionMode(*req.RedactionMode); err != nil {
+			return nil, err
+		}
+	}
+
+	settings, err := s.repo.Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if req.RedactionMode != nil {
+		settings.RedactionMode = *req.RedactionMode
+	}
+	settings.UpdatedAt = time.Now()
+
+	if err := s.repo.Save(ctx, settings); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+func validateRedactionMode(mode models.RedactionMode) error {
+	if !slices.Contains(models.RedactionModes, mode) {
+		return apperrors.New(apperrors.ErrInvalidRequest, fmt.Sprintf("unknown redaction mode %q", mode)).
+			WithDetails(map[string]any{"allowed_modes": models.RedactionModes})
+	}
+	return nil
+}
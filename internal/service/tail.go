@@ -0,0 +1,274 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+	"user-service/internal/apperrors"
+	"user-service/internal/models"
+	"user-service/internal/preview"
+	"user-service/pkg/storage"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// defaultTailLines is the number of existing lines a tail starts with
+	// when none is requested.
+	defaultTailLines = 10
+
+	// maxTailLines caps the existing lines a tail starts with.
+	maxTailLines = 1000
+
+	// tailHeartbeat is how often a tail tells the client it is still alive.
+	tailHeartbeat = 15 * time.Second
+
+	// tailPollInterval is how often a tail re-reads the file to pick up
+	// changes made by other instances, which it isn't notified of.
+	tailPollInterval = 5 * time.Second
+)
+
+// Tail event names.
+const (
+	// TailEventLine carries a preview.Line.
+	TailEventLine = "line"
+
+	// TailEventClosed carries the reason the tail ended: "hidden" or
+	// "deleted".
+	TailEventClosed = "closed"
+)
+
+// TailStream receives the events of a tail. An error from either method
+// ends the tail, as when the client has gone away.
+type TailStream interface {
+	// Send sends an event with a JSON payload.
+	Send(event string, data any) error
+
+	// Heartbeat tells the client the tail is still alive.
+	Heartbeat() error
+}
+
+// errTailStream marks a failure to write to the client.
+var errTailStream = errors.New("tail stream closed")
+
+// TailFile sends the last lines of a file to the stream returned by open,
+// then every line appended to the file, until ctx is done or the file is
+// hidden or deleted. open is only called once the tail is known to start.
+// Lines are read from storage only as fast as the stream accepts them, and
+// notifications that arrive meanwhile are coalesced, so a slow client holds
+// back its own tail without buffering.
+func (s *FileService) TailFile(ctx context.Context, userID uint, id primitive.ObjectID, req models.TailRequest, open func() TailStream) error {
+	slog.InfoContext(ctx, "Tailing file", "op", "FileService.TailFile", "file_id", id.Hex())
+
+	n := int64(defaultTailLines)
+	if req.Lines != nil {
+		n = *req.Lines
+	}
+	if n < 0 || n > maxTailLines {
+		return apperrors.New(apperrors.ErrInvalidRequest, fmt.Sprintf("lines must be between 0 and %d", maxTailLines))
+	}
+
+	file, err := s.getOwnedFile(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+	var encoding string
+	if file.Analysis != nil {
+		encoding = file.Analysis.Encoding
+	}
+	switch {
+	case file.Status == models.FileStatusDeleted:
+		return errFileDeleted
+	case file.Status == models.FileStatusHidden:
+		return apperrors.New(apperrors.ErrInvalidState, "hidden files can't be tailed")
+	case file.Extraction != nil:
+		return errExtracted
+	case !preview.Ranged(encoding):
+		return apperrors.New(apperrors.ErrInvalidRequest, fmt.Sprintf("tailing %s files is not supported", encoding))
+	}
+
+	// Subscribe before reading so that no append is missed
+	events, unsubscribe := s.events.subscribe(id)
+	defer unsubscribe()
+
+	t := &fileTail{offset: file.Size}
+	lines, err := s.lastLines(ctx, file, encoding, max(n, 1))
+	if err != nil {
+		return err
+	}
+	if len(lines) > 0 {
+		t.number = lines[len(lines)-1].Number
+	}
+	if file.Size > 0 {
+		last, err := s.lastByte(ctx, file)
+		if err != nil {
+			return err
+		}
+		t.partial = last != '\n'
+	}
+
+	stream := open()
+	t.stream = stream
+	for _, line := range lines[int64(len(lines))-min(n, int64(len(lines))):] {
+		if err := t.send(line); err != nil {
+			return t.end(err)
+		}
+	}
+
+	heartbeat := time.NewTicker(tailHeartbeat)
+	defer heartbeat.Stop()
+	poll := time.NewTicker(tailPollInterval)
+	defer poll.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-heartbeat.C:
+			if err := stream.Heartbeat(); err != nil {
+				return t.end(errTailStream)
+			}
+			continue
+		case <-events:
+		case <-poll.C:
+		}
+
+		closed, err := s.followTail(ctx, file, encoding, t)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil || closed {
+			return t.end(err)
+		}
+	}
+}
+
+// fileTail is the position of a tail in its file.
+type fileTail struct {
+	stream TailStream
+
+	// offset is the size of the file that has been sent.
+	offset int64
+
+	// number is the number of the last line sent.
+	number int64
+
+	// partial is set when the file doesn't end with a line break, so the
+	// next data continues the last line.
+	partial bool
+}
+
+func (t *fileTail) send(line preview.Line) error {
+	t.number = line.Number
+	if err := t.stream.Send(TailEventLine, line); err != nil {
+		return errTailStream
+	}
+	return nil
+}
+
+// end returns the error that ends a tail. A client that went away ends it
+// normally.
+func (t *fileTail) end(err error) error {
+	if errors.Is(err, errTailStream) {
+		slog.Debug("Client went away", "op", "FileService.TailFile")
+		return nil
+	}
+	return err
+}
+
+// followTail sends the lines appended since the tail's offset, or the
+// reason the tail is over.
+func (s *FileService) followTail(ctx context.Context, file *models.File, encoding string, t *fileTail) (bool, error) {
+	current, err := s.repo.GetByID(ctx, file.ID)
+	if errors.Is(err, apperrors.ErrFileNotFound) {
+		return true, t.close("deleted")
+	}
+	if err != nil {
+		return false, err
+	}
+	switch current.Status {
+	case models.FileStatusDeleted:
+		return true, t.close("deleted")
+	case models.FileStatusHidden:
+		return true, t.close("hidden")
+	}
+	if current.Size <= t.offset {
+		return false, nil
+	}
+
+	reader, err := storage.ReadRange(ctx, s.storage, file.StorageKey, t.offset, current.Size-t.offset)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to read file", "op", "FileService.followTail", "file_id", file.ID.Hex(), "error", err)
+		return false, apperrors.Storage(err)
+	}
+	defer reader.Close()
+
+	first := t.number + 1
+	if t.partial {
+		first = t.number
+	}
+	err = preview.Each(ctx, reader, encoding, first, func(line preview.Line) error {
+		if t.partial {
+			// The line break completing the last line sent
+			t.partial = false
+			if line.Text == "" {
+				return nil
+			}
+		}
+		return t.send(line)
+	})
+	if errors.Is(err, errTailStream) {
+		return false, err
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to read file", "op", "FileService.followTail", "file_id", file.ID.Hex(), "error", err)
+		return false, apperrors.Storage(err)
+	}
+	// Appends always end with a line break
+	t.offset, t.partial = current.Size, false
+	return false, nil
+}
+
+func (t *fileTail) close(reason string) error {
+	if err := t.stream.Send(TailEventClosed, map[string]string{"reason": reason}); err != nil {
+		return errTailStream
+	}
+	return nil
+}
+
+// lastLines returns the last n lines of the file's stored content, reading
+// no further than its recorded size.
+func (s *FileService) lastLines(ctx context.Context, file *models.File, encoding string, n int64) ([]preview.Line, error) {
+	if file.Size == 0 {
+		return nil, nil
+	}
+	if rangeReader, ok := s.storage.(storage.RangeReader); ok &&
+		file.Analysis != nil && file.Analysis.Error == "" && file.Analysis.ByteCount == file.Size {
+		open := func(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+			return rangeReader.DownloadRange(ctx, file.StorageKey, offset, length)
+		}
+		lines, err := preview.TailRange(ctx, open, file.Size, file.Analysis.LineCount, encoding, n)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to read file tail", "op", "FileService.lastLines", "error", err)
+			return nil, apperrors.Storage(err)
+		}
+		return lines, nil
+	}
+
+	reader, err := storage.ReadRange(ctx, s.storage, file.StorageKey, 0, file.Size)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to open file from storage", "op", "FileService.lastLines", "error", err)
+		return nil, apperrors.Storage(err)
+	}
+	defer reader.Close()
+
+	lines, err := preview.Tail(ctx, reader, encoding, n)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to read file", "op", "FileService.lastLines", "error", err)
+		return nil, apperrors.Storage(err)
+	}
+	return lines, nil
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"user-service/internal/apperrors"
+	"user-service/internal/archive"
+	"user-service/internal/models"
+	"user-service/internal/redact"
+)
+
+// sniffLen is the number of leading bytes inspected to detect a file's type.
+const sniffLen = 512
+
+// UploadPolicy controls which files may be uploaded and how large they may
+// be. Empty allow-lists accept anything and a size of 0 means unlimited.
+type UploadPolicy struct {
+	// MaxSize is the limit for types without an entry in MaxSizeByType.
+	MaxSize int64
+
+	// MaxSizeByType overrides MaxSize per detected MIME type.
+	MaxSizeByType map[string]int64
+
+	// AllowedExtensions lists accepted file name extensions, including the
+	// leading dot.
+	AllowedExtensions []string
+
+	// AllowedMimeTypes lists accepted MIME types as detected from content.
+	AllowedMimeTypes []string
+
+	// MaxArchiveSize is the limit for archives uploaded for extraction. The
+	// extracted files are checked against the rest of the policy.
+	MaxArchiveSize int64
+
+	// Archive bounds the expansion of archives.
+	Archive archive.Limits
+
+	// MaxAppendSize is the limit for the data added to a file by one append.
+	MaxAppendSize int64
+
+	// Redaction is the redaction mode for uploads when neither the request
+	// nor the user's settings choose one.
+	Redaction models.RedactionMode
+
+	// Detectors find the data handled by the redaction stage.
+	Detectors []redact.Detector
+}
+
+// DefaultUploadPolicy returns the limits documented in the README: 10MB text,
+// log, JSON, XML and CSV files, 1MB appends, with redaction off.
+func DefaultUploadPolicy() UploadPolicy {
+	return UploadPolicy{
+		MaxSize:           10 << 20,
+		MaxArchiveSize:    10 << 20,
+		MaxAppendSize:     1 << 20,
+		AllowedExtensions: []string{".txt", ".log", ".json", ".xml", ".csv"},
+		AllowedMimeTypes:  []string{"text/plain", "application/json", "text/xml", "application/xml", "text/csv"},
+		Redaction:         models.RedactionModeOff,
+		Detectors:         redact.DefaultDetectors(),
+	}
+}
+
+// Check validates a file name and its leading bytes against the policy. It
+// returns the detected MIME type and the size limit that applies to it.
+func (p UploadPolicy) Check(fileName string, head []byte) (string, int64, error) {
+	ext := strings.ToLower(filepath.Ext(fileName))
+	if len(p.AllowedExtensions) > 0 && !containsFold(p.AllowedExtensions, ext) {
+		return "", 0, p.invalidFile(fmt.Sprintf("file extension %q is not allowed", ext))
+	}
+
+	mimeType := DetectMimeType(fileName, head)
+	if len(p.AllowedMimeTypes) > 0 && !containsFold(p.AllowedMimeTypes, mimeType) {
+		return "", 0, p.invalidFile(fmt.Sprintf("detected content type %q is not allowed", mimeType))
+	}
+
+	return mimeType, p.MaxSizeFor(mimeType), nil
+}
+
+// MaxSizeFor returns the size limit for files of a MIME type.
+func (p UploadPolicy) MaxSizeFor(mimeType string) int64 {
+	if size, ok := p.MaxSizeByType[mimeType]; ok {
+		return size
+	}
+	return p.MaxSize
+}
+
+// TooLarge returns the error reported when a file of the given type exceeds
+// maxSize.
+func (p UploadPolicy) TooLarge(mimeType string, maxSize int64) error {
+	return apperrors.New(apperrors.ErrFileTooLarge, fmt.Sprintf("file exceeds the %d byte limit for %s", maxSize, mimeType)).
+		WithDetails(map[string]any{"max_size": maxSize})
+}
+
+func (p UploadPolicy) invalidFile(message string) error {
+	return apperrors.New(apperrors.ErrInvalidFile, message).WithDetails(map[string]any{
+		"max_size":           p.MaxSize,
+		"allowed_extensions": p.AllowedExtensions,
+		"allowed_types":      p.AllowedMimeTypes,
+	})
+}
+
+// DetectMimeType sniffs a MIME type from the first bytes of a file. Generic
+// text is narrowed using the extension when the content agrees with it, so a
+// client-supplied Content-Type header is never trusted.
+func DetectMimeType(fileName string, head []byte) string {
+	mimeType, _, err := mime.ParseMediaType(http.DetectContentType(head))
+	if err != nil {
+		return "application/octet-stream"
+	}
+	if mimeType != "text/plain" {
+		return mimeType
+	}
+
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".json":
+		trimmed := bytes.TrimSpace(head)
+		if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+			return "application/json"
+		}
+	case ".csv":
+		return "text/csv"
+	}
+	return mimeType
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,403 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+	"user-service/internal/apperrors"
+	"user-service/internal/models"
+	"user-service/internal/notify"
+	"user-service/internal/webhook"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// maxWebhooks caps the webhooks a user can register.
+	maxWebhooks = 10
+
+	maxWebhookURLLength = 2048
+
+	defaultDeliveryLimit = 50
+	maxDeliveryLimit     = 500
+)
+
+// WebhookConfig controls webhook delivery.
+type WebhookConfig struct {
+	// Workers is the number of deliveries sent concurrently.
+	Workers int
+
+	// MaxAttempts is the number of times a delivery is sent before it is
+	// marked failed.
+	MaxAttempts int
+
+	// RetryBase is the wait before the first retry. Each retry waits twice
+	// as long as the one before, up to RetryMax.
+	RetryBase time.Duration
+	RetryMax  time.Duration
+
+	// Timeout is the time a receiver has to respond.
+	Timeout time.Duration
+
+	// PollInterval is how often workers look for due deliveries.
+	PollInterval time.Duration
+}
+
+// WebhookStore stores users' webhooks. It is implemented by
+// repository.WebhookRepository.
+type WebhookStore interface {
+	Create(ctx context.Context, webhook *models.Webhook) error
+	GetByID(ctx context.Context, id primitive.ObjectID) (*models.Webhook, error)
+	ListByUser(ctx context.Context, userID uint) ([]models.Webhook, error)
+	FindSubscribed(ctx context.Context, userID uint, eventType string) ([]models.Webhook, error)
+	CountByUser(ctx context.Context, userID uint) (int64, error)
+	Update(ctx context.Context, webhook *models.Webhook) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+}
+
+// DeliveryStore stores the delivery log and hands due deliveries to
+// workers. It is implemented by repository.DeliveryRepository.
+type DeliveryStore interface {
+	Create(ctx context.Context, deliveries []*models.WebhookDelivery) error
+	GetByID(ctx context.Context, id primitive.ObjectID) (*models.WebhookDelivery, error)
+	ListByWebhook(ctx context.Context, webhookID primitive.ObjectID, status models.DeliveryStatus, limit int) ([]models.WebhookDelivery, error)
+	ClaimDue(ctx context.Context, lease time.Duration) (*models.WebhookDelivery, error)
+	RecordAttempt(ctx context.Context, id primitive.ObjectID, attempt models.DeliveryAttempt, status models.DeliveryStatus, next time.Time) error
+}
+
+// WebhookService manages users' webhooks and delivers their events. It is a
+// notify.Notifier: each event is stored as a delivery per subscribed
+// webhook, then sent by a pool of workers, which retry failed deliveries
+// with exponential backoff. Deliveries are sent at least once; receivers
+// drop duplicates by event ID.
+type WebhookService struct {
+	webhooks   WebhookStore
+	deliveries DeliveryStore
+	sender     *webhook.Sender
+	config     WebhookConfig
+
+	// wake tells an idle worker that deliveries were created
+	wake chan struct{}
+}
+
+// NewWebhookService returns a WebhookService that sends deliveries with
+// client, such as one that trusts a test receiver's certificate. A nil client
+// selects webhook.NewClient, which only connects to public addresses.
+func NewWebhookService(webhooks WebhookStore, deliveries DeliveryStore, client *http.Client, config WebhookConfig) *WebhookService {
+	if config.Workers <= 0 {
+		config.Workers = 1
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 8
+	}
+	if config.RetryBase <= 0 {
+		config.RetryBase = 10 * time.Second
+	}
+	if config.RetryMax <= 0 {
+		config.RetryMax = time.Hour
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = time.Second
+	}
+	return &WebhookService{
+		webhooks:   webhooks,
+		deliveries: deliveries,
+		sender:     webhook.NewSender(client, config.Timeout),
+		config:     config,
+		wake:       make(chan struct{}, config.Workers),
+	}
+}
+
+// Start launches the delivery workers. They stop when ctx is done.
+func (s *WebhookService) Start(ctx context.Context) {
+	slog.InfoContext(ctx, "Starting webhook workers", "op", "WebhookService.Start", "workers", s.config.Workers)
+	for i := 0; i < s.config.Workers; i++ {
+		go s.worker(ctx)
+	}
+}
+
+func (s *WebhookService) Create(ctx context.Context, userID uint, req models.WebhookRequest) (*models.CreatedWebhook, error) {
+	hook, err := newWebhook(req)
+	if err != nil {
+		return nil, err
+	}
+	count, err := s.webhooks.CountByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if count >= maxWebhooks {
+		return nil, apperrors.New(apperrors.ErrInvalidRequest, fmt.Sprintf("at most %d webhooks can be registered", maxWebhooks)).
+			WithDetails(map[string]any{"max_webhooks": maxWebhooks})
+	}
+
+	hook.UserID = userID
+	if hook.Secret, err = webhook.NewSecret(); err != nil {
+		return nil, apperrors.Wrap(apperrors.ErrInternal, err, "")
+	}
+	if err := s.webhooks.Create(ctx, hook); err != nil {
+		return nil, err
+	}
+	slog.InfoContext(ctx, "Registered webhook", "op", "WebhookService.Create", "webhook_id", hook.ID.Hex(), "user_id", userID)
+	return &models.CreatedWebhook{Webhook: hook, Secret: hook.Secret}, nil
+}
+
+func (s *WebhookService) List(ctx context.Context, userID uint) ([]models.Webhook, error) {
+	return s.webhooks.ListByUser(ctx, userID)
+}
+
+func (s *WebhookService) Get(ctx context.Context, userID uint, id primitive.ObjectID) (*models.Webhook, error) {
+	hook, err := s.webhooks.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if hook.UserID != userID {
+		slog.WarnContext(ctx, "User does not own webhook", "op", "WebhookService.Get", "user_id", userID, "webhook_id", id.Hex())
+		return nil, apperrors.ErrForbidden
+	}
+	return hook, nil
+}
+
+// Update replaces a webhook's URL, events and enabled flag. Pending
+// deliveries are sent to the new URL.
+func (s *WebhookService) Update(ctx context.Context, userID uint, id primitive.ObjectID, req models.WebhookRequest) (*models.Webhook, error) {
+	existing, err := s.Get(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	hook, err := newWebhook(req)
+	if err != nil {
+		return nil, err
+	}
+	existing.URL = hook.URL
+	existing.Events = hook.Events
+	existing.Enabled = hook.Enabled
+	if err := s.webhooks.Update(ctx, existing); err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+// Delete removes a webhook. Its pending deliveries fail when they are next
+// sent; the delivery log expires on its own.
+func (s *WebhookService) Delete(ctx context.Context, userID uint, id primitive.ObjectID) error {
+	if _, err := s.Get(ctx, userID, id); err != nil {
+		return err
+	}
+	return s.webhooks.Delete(ctx, id)
+}
+
+// ListDeliveries returns a webhook's most recent deliveries.
+func (s *WebhookService) ListDeliveries(ctx context.Context, userID uint, id primitive.ObjectID, req models.DeliveryListRequest) ([]models.WebhookDelivery, error) {
+	if req.Limit == 0 {
+		req.Limit = defaultDeliveryLimit
+	}
+	if req.Limit < 0 || req.Limit > maxDeliveryLimit {
+		return nil, apperrors.New(apperrors.ErrInvalidRequest, fmt.Sprintf("limit must be between 1 and %d", maxDeliveryLimit))
+	}
+	switch req.Status {
+	case "", models.DeliveryStatusPending, models.DeliveryStatusSucceeded, models.DeliveryStatusFailed:
+	default:
+		return nil, apperrors.New(apperrors.ErrInvalidRequest, fmt.Sprintf("unknown delivery status %q", req.Status))
+	}
+	if _, err := s.Get(ctx, userID, id); err != nil {
+		return nil, err
+	}
+	return s.deliveries.ListByWebhook(ctx, id, req.Status, req.Limit)
+}
+
+// Redeliver sends a delivery's event again as a new delivery with the same
+// event ID.
+func (s *WebhookService) Redeliver(ctx context.Context, userID uint, id, deliveryID primitive.ObjectID) (*models.WebhookDelivery, error) {
+	if _, err := s.Get(ctx, userID, id); err != nil {
+		return nil, err
+	}
+	original, err := s.deliveries.GetByID(ctx, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	if original.WebhookID != id {
+		return nil, apperrors.New(apperrors.ErrNotFound, "delivery not found")
+	}
+
+	delivery := &models.WebhookDelivery{
+		WebhookID:    original.WebhookID,
+		UserID:       original.UserID,
+		EventID:      original.EventID,
+		EventType:    original.EventType,
+		Payload:      original.Payload,
+		RedeliveryOf: &original.ID,
+	}
+	if err := s.deliveries.Create(ctx, []*models.WebhookDelivery{delivery}); err != nil {
+		return nil, err
+	}
+	slog.InfoContext(ctx, "Queued redelivery", "op", "WebhookService.Redeliver", "delivery_id", delivery.ID.Hex(), "original_id", original.ID.Hex())
+	s.signal(1)
+	return delivery, nil
+}
+
+// Notify stores a delivery of the event for each of the user's webhooks that
+// receive its type.
+func (s *WebhookService) Notify(ctx context.Context, event notify.Event) error {
+	hooks, err := s.webhooks.FindSubscribed(ctx, event.UserID, event.Type)
+	if err != nil || len(hooks) == 0 {
+		return err
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	deliveries := make([]*models.WebhookDelivery, len(hooks))
+	for i, hook := range hooks {
+		deliveries[i] = &models.WebhookDelivery{
+			WebhookID: hook.ID,
+			UserID:    event.UserID,
+			EventID:   event.ID,
+			EventType: event.Type,
+			Payload:   string(payload),
+		}
+	}
+	if err := s.deliveries.Create(ctx, deliveries); err != nil {
+		return err
+	}
+	s.signal(len(deliveries))
+	return nil
+}
+
+// signal wakes up to n idle workers.
+func (s *WebhookService) signal(n int) {
+	for i := 0; i < n; i++ {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+			return
+		}
+	}
+}
+
+// worker sends due deliveries until none are left, then waits to be woken
+// or for the next poll.
+func (s *WebhookService) worker(ctx context.Context) {
+	ticker := time.NewTicker(s.config.PollInterval)
+	defer ticker.Stop()
+
+	// A delivery is claimed for longer than an attempt can take
+	lease := 2*s.config.Timeout + time.Minute
+	for {
+		for ctx.Err() == nil {
+			delivery, err := s.deliveries.ClaimDue(ctx, lease)
+			if err != nil || delivery == nil {
+				break
+			}
+			s.deliver(ctx, delivery)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliver sends a claimed delivery once and records the outcome.
+func (s *WebhookService) deliver(ctx context.Context, delivery *models.WebhookDelivery) {
+	attempt := models.DeliveryAttempt{At: time.Now()}
+	status := models.DeliveryStatusFailed
+
+	hook, err := s.webhooks.GetByID(ctx, delivery.WebhookID)
+	switch {
+	case errors.Is(err, apperrors.ErrNotFound):
+		attempt.Error = "webhook was deleted"
+	case err != nil:
+		// Leave the delivery to be claimed again when the lease runs out
+		slog.ErrorContext(ctx, "Failed to fetch webhook", "op", "WebhookService.deliver", "webhook_id", delivery.WebhookID.Hex(), "error", err)
+		return
+	case !hook.Enabled:
+		attempt.Error = "webhook is disabled"
+	default:
+		result := s.sender.Send(ctx, webhook.Message{
+			URL:        hook.URL,
+			Secret:     hook.Secret,
+			Event:      delivery.EventType,
+			DeliveryID: delivery.ID.Hex(),
+			Body:       []byte(delivery.Payload),
+		})
+		attempt.StatusCode = result.StatusCode
+		attempt.DurationMS = result.Duration.Milliseconds()
+		switch {
+		case result.OK():
+			status = models.DeliveryStatusSucceeded
+		case len(delivery.Attempts)+1 < s.config.MaxAttempts:
+			status = models.DeliveryStatusPending
+			attempt.Error = result.Err.Error()
+		default:
+			attempt.Error = result.Err.Error()
+		}
+	}
+
+	next := attempt.At.Add(s.backoff(len(delivery.Attempts) + 1))
+	if err := s.deliveries.RecordAttempt(context.WithoutCancel(ctx), delivery.ID, attempt, status, next); err != nil {
+		return
+	}
+	switch status {
+	case models.DeliveryStatusPending:
+		slog.WarnContext(ctx, "Delivery failed, retrying", "op", "WebhookService.deliver", "delivery_id", delivery.ID.Hex(), "next_attempt_at", next, "error", attempt.Error)
+	case models.DeliveryStatusFailed:
+		slog.ErrorContext(ctx, "Delivery failed permanently", "op", "WebhookService.deliver", "delivery_id", delivery.ID.Hex(), "error", attempt.Error)
+	}
+}
+
+// backoff returns the wait after the given number of failed attempts.
+func (s *WebhookService) backoff(attempts int) time.Duration {
+	wait := s.config.RetryBase
+	for i := 1; i < attempts && wait < s.config.RetryMax; i++ {
+		wait *= 2
+	}
+	return min(wait, s.config.RetryMax)
+}
+
+// newWebhook validates a request and builds the webhook it describes.
+func newWebhook(req models.WebhookRequest) (*models.Webhook, error) {
+	if len(req.URL) > maxWebhookURLLength {
+		return nil, apperrors.New(apperrors.ErrInvalidRequest, fmt.Sprintf("url must be at most %d characters", maxWebhookURLLength))
+	}
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, apperrors.New(apperrors.ErrInvalidRequest, "url must be an absolute http or https URL")
+	}
+	if err := webhook.CheckURL(u); err != nil {
+		return nil, apperrors.New(apperrors.ErrInvalidRequest, "url must not point to a loopback, private or link-local address")
+	}
+
+	var events []string
+	for _, event := range req.Events {
+		if !slices.Contains(notify.EventTypes, event) {
+			return nil, apperrors.New(apperrors.ErrInvalidRequest, fmt.Sprintf("unknown event %q", event)).
+				WithDetails(map[string]any{"allowed_events": notify.EventTypes})
+		}
+		if !slices.Contains(events, event) {
+			events = append(events, event)
+		}
+	}
+	if len(events) == 0 {
+		return nil, apperrors.New(apperrors.ErrInvalidRequest, "at least one event is required").
+			WithDetails(map[string]any{"allowed_events": notify.EventTypes})
+	}
+
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+	return &models.Webhook{URL: req.URL, Events: events, Enabled: enabled}, nil
+}
@@ -0,0 +1,415 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"user-service/internal/apperrors"
+	"user-service/internal/models"
+	"user-service/internal/notify"
+	"user-service/internal/webhook"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memWebhooks is an in-memory WebhookStore.
+type memWebhooks struct {
+	mu    sync.Mutex
+	hooks map[primitive.ObjectID]models.Webhook
+}
+
+func newMemWebhooks() *memWebhooks {
+	return &memWebhooks{hooks: map[primitive.ObjectID]models.Webhook{}}
+}
+
+func (m *memWebhooks) Create(_ context.Context, hook *models.Webhook) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	hook.ID = primitive.NewObjectID()
+	hook.CreatedAt = time.Now()
+	hook.UpdatedAt = hook.CreatedAt
+	m.hooks[hook.ID] = *hook
+	return nil
+}
+
+func (m *memWebhooks) GetByID(_ context.Context, id primitive.ObjectID) (*models.Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	hook, ok := m.hooks[id]
+	if !ok {
+		return nil, apperrors.New(apperrors.ErrNotFound, "webhook not found")
+	}
+	return &hook, nil
+}
+
+func (m *memWebhooks) ListByUser(ctx context.Context, userID uint) ([]models.Webhook, error) {
+	return m.filter(func(hook models.Webhook) bool { return hook.UserID == userID }), nil
+}
+
+func (m *memWebhooks) FindSubscribed(_ context.Context, userID uint, eventType string) ([]models.Webhook, error) {
+	return m.filter(func(hook models.Webhook) bool {
+		for _, event := range hook.Events {
+			if event == eventType {
+				return hook.UserID == userID && hook.Enabled
+			}
+		}
+		return false
+	}), nil
+}
+
+func (m *memWebhooks) filter(keep func(models.Webhook) bool) []models.Webhook {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	hooks := []models.Webhook{}
+	for _, hook := range m.hooks {
+		if keep(hook) {
+			hooks = append(hooks, hook)
+		}
+	}
+	sort.Slice(hooks, func(i, j int) bool { return hooks[i].CreatedAt.Before(hooks[j].CreatedAt) })
+	return hooks
+}
+
+func (m *memWebhooks) CountByUser(ctx context.Context, userID uint) (int64, error) {
+	hooks, _ := m.ListByUser(ctx, userID)
+	return int64(len(hooks)), nil
+}
+
+func (m *memWebhooks) Update(_ context.Context, hook *models.Webhook) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.hooks[hook.ID]; !ok {
+		return apperrors.New(apperrors.ErrNotFound, "webhook not found")
+	}
+	m.hooks[hook.ID] = *hook
+	return nil
+}
+
+func (m *memWebhooks) Delete(_ context.Context, id primitive.ObjectID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.hooks, id)
+	return nil
+}
+
+// memDeliveries is an in-memory DeliveryStore with the repository's claim
+// semantics.
+type memDeliveries struct {
+	mu         sync.Mutex
+	deliveries map[primitive.ObjectID]*models.WebhookDelivery
+}
+
+func newMemDeliveries() *memDeliveries {
+	return &memDeliveries{deliveries: map[primitive.ObjectID]*models.WebhookDelivery{}}
+}
+
+func (m *memDeliveries) Create(_ context.Context, deliveries []*models.WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for _, delivery := range deliveries {
+		delivery.ID = primitive.NewObjectID()
+		delivery.Status = models.DeliveryStatusPending
+		delivery.NextAttemptAt = now
+		delivery.Attempts = []models.DeliveryAttempt{}
+		delivery.CreatedAt = now
+		delivery.UpdatedAt = now
+		stored := *delivery
+		m.deliveries[delivery.ID] = &stored
+	}
+	return nil
+}
+
+func (m *memDeliveries) GetByID(_ context.Context, id primitive.ObjectID) (*models.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delivery, ok := m.deliveries[id]
+	if !ok {
+		return nil, apperrors.New(apperrors.ErrNotFound, "delivery not found")
+	}
+	copied := *delivery
+	copied.Attempts = append([]models.DeliveryAttempt(nil), delivery.Attempts...)
+	return &copied, nil
+}
+
+func (m *memDeliveries) ListByWebhook(ctx context.Context, webhookID primitive.ObjectID, status models.DeliveryStatus, limit int) ([]models.WebhookDelivery, error) {
+	m.mu.Lock()
+	var ids []primitive.ObjectID
+	for id, delivery := range m.deliveries {
+		if delivery.WebhookID == webhookID && (status == "" || delivery.Status == status) {
+			ids = append(ids, id)
+		}
+	}
+	m.mu.Unlock()
+
+	deliveries := []models.WebhookDelivery{}
+	for _, id := range ids {
+		delivery, _ := m.GetByID(ctx, id)
+		deliveries = append(deliveries, *delivery)
+	}
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].ID.Hex() > deliveries[j].ID.Hex() })
+	return deliveries[:min(limit, len(deliveries))], nil
+}
+
+func (m *memDeliveries) ClaimDue(ctx context.Context, lease time.Duration) (*models.WebhookDelivery, error) {
+	m.mu.Lock()
+	now := time.Now()
+	var due *models.WebhookDelivery
+	for _, delivery := range m.deliveries {
+		if delivery.Status == models.DeliveryStatusPending && !delivery.NextAttemptAt.After(now) &&
+			(due == nil || delivery.NextAttemptAt.Before(due.NextAttemptAt)) {
+			due = delivery
+		}
+	}
+	if due == nil {
+		m.mu.Unlock()
+		return nil, nil
+	}
+	due.NextAttemptAt = now.Add(lease)
+	m.mu.Unlock()
+	return m.GetByID(ctx, due.ID)
+}
+
+func (m *memDeliveries) RecordAttempt(_ context.Context, id primitive.ObjectID, attempt models.DeliveryAttempt, status models.DeliveryStatus, next time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delivery := m.deliveries[id]
+	delivery.Status = status
+	delivery.UpdatedAt = attempt.At
+	if status == models.DeliveryStatusPending {
+		delivery.NextAttemptAt = next
+	} else {
+		delivery.CompletedAt = &attempt.At
+	}
+	delivery.Attempts = append(delivery.Attempts, attempt)
+	return nil
+}
+
+// waitForDelivery polls until a delivery leaves the pending status.
+func waitForDelivery(t *testing.T, deliveries *memDeliveries, id primitive.ObjectID) *models.WebhookDelivery {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		delivery, err := deliveries.GetByID(context.Background(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if delivery.Status != models.DeliveryStatusPending {
+			return delivery
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("delivery %s still pending", id.Hex())
+	return nil
+}
+
+// publicReceiver returns a URL with a public host name for server, which
+// listens on a loopback address that webhooks can't be registered for, and a
+// client that connects to server whatever the URL's host.
+func publicReceiver(server *httptest.Server) (string, *http.Client) {
+	client := server.Client()
+	transport := client.Transport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, server.Listener.Addr().String())
+	}
+	client.Transport = transport
+	return strings.Replace(server.URL, "127.0.0.1", "receiver.example", 1), client
+}
+
+func TestWebhookDeliveryRetriesWithBackoffAndRedelivers(t *testing.T) {
+	// The receiver fails the first two requests, then accepts everything
+	var mu sync.Mutex
+	var requests []*http.Request
+	var bodies [][]byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		requests = append(requests, r)
+		bodies = append(bodies, body)
+		n := len(requests)
+		mu.Unlock()
+		if n <= 2 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	const retryBase = 40 * time.Millisecond
+	hooks, deliveries := newMemWebhooks(), newMemDeliveries()
+	receiverURL, client := publicReceiver(server)
+	svc := NewWebhookService(hooks, deliveries, client, WebhookConfig{
+		Workers:      2,
+		MaxAttempts:  5,
+		RetryBase:    retryBase,
+		RetryMax:     time.Second,
+		Timeout:      time.Second,
+		PollInterval: 5 * time.Millisecond,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	svc.Start(ctx)
+
+	created, err := svc.Create(ctx, 1, models.WebhookRequest{URL: receiverURL, Events: []string{notify.EventFileCreated}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := notify.Event{ID: "evt_1", Type: notify.EventFileCreated, UserID: 1, Time: time.Now(), Data: map[string]string{"name": "app.log"}}
+	if err := svc.Notify(ctx, event); err != nil {
+		t.Fatal(err)
+	}
+
+	listed, err := svc.ListDeliveries(ctx, 1, created.ID, models.DeliveryListRequest{})
+	if err != nil || len(listed) != 1 {
+		t.Fatalf("ListDeliveries = %d deliveries, %v", len(listed), err)
+	}
+	delivery := waitForDelivery(t, deliveries, listed[0].ID)
+
+	// The delivery log records each attempt
+	if delivery.Status != models.DeliveryStatusSucceeded || delivery.CompletedAt == nil {
+		t.Fatalf("status = %s, completed at %v", delivery.Status, delivery.CompletedAt)
+	}
+	wantCodes := []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusOK}
+	if len(delivery.Attempts) != len(wantCodes) {
+		t.Fatalf("%d attempts recorded, want %d", len(delivery.Attempts), len(wantCodes))
+	}
+	for i, attempt := range delivery.Attempts {
+		if attempt.StatusCode != wantCodes[i] {
+			t.Errorf("attempt %d: status %d, want %d", i+1, attempt.StatusCode, wantCodes[i])
+		}
+		if (attempt.Error != "") != (wantCodes[i] != http.StatusOK) {
+			t.Errorf("attempt %d: error %q", i+1, attempt.Error)
+		}
+	}
+
+	// Each retry waits twice as long as the one before
+	for i, wait := range []time.Duration{retryBase, 2 * retryBase} {
+		if gap := delivery.Attempts[i+1].At.Sub(delivery.Attempts[i].At); gap < wait {
+			t.Errorf("retry %d sent after %v, want at least %v", i+1, gap, wait)
+		}
+	}
+
+	// Every attempt is the same signed delivery
+	mu.Lock()
+	for i, r := range requests {
+		if err := webhook.Verify(created.Secret, r.Header, bodies[i], time.Minute); err != nil {
+			t.Errorf("request %d: %v", i+1, err)
+		}
+		if got := r.Header.Get(webhook.HeaderDelivery); got != delivery.ID.Hex() {
+			t.Errorf("request %d: delivery %s, want %s", i+1, got, delivery.ID.Hex())
+		}
+	}
+	mu.Unlock()
+
+	// Redelivery sends the same event again as a new delivery
+	redelivery, err := svc.Redeliver(ctx, 1, created.ID, delivery.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	redelivered := waitForDelivery(t, deliveries, redelivery.ID)
+	if redelivered.Status != models.DeliveryStatusSucceeded || len(redelivered.Attempts) != 1 {
+		t.Fatalf("redelivery status = %s after %d attempts", redelivered.Status, len(redelivered.Attempts))
+	}
+	if redelivered.RedeliveryOf == nil || *redelivered.RedeliveryOf != delivery.ID {
+		t.Errorf("redelivery_of = %v, want %s", redelivered.RedeliveryOf, delivery.ID.Hex())
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(requests) != 4 {
+		t.Fatalf("receiver got %d requests, want 4", len(requests))
+	}
+	last := requests[3]
+	if got := last.Header.Get(webhook.HeaderDelivery); got != redelivery.ID.Hex() {
+		t.Errorf("redelivery sent as delivery %s, want %s", got, redelivery.ID.Hex())
+	}
+	var sent notify.Event
+	if err := json.Unmarshal(bodies[3], &sent); err != nil || sent.ID != event.ID {
+		t.Errorf("redelivered event ID = %q (%v), want %q", sent.ID, err, event.ID)
+	}
+	if err := webhook.Verify(created.Secret, last.Header, bodies[3], time.Minute); err != nil {
+		t.Errorf("redelivery: %v", err)
+	}
+}
+
+func TestWebhookDeliveryFailsAfterMaxAttempts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	hooks, deliveries := newMemWebhooks(), newMemDeliveries()
+	receiverURL, client := publicReceiver(server)
+	svc := NewWebhookService(hooks, deliveries, client, WebhookConfig{
+		MaxAttempts:  3,
+		RetryBase:    time.Millisecond,
+		RetryMax:     time.Millisecond,
+		Timeout:      time.Second,
+		PollInterval: 5 * time.Millisecond,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	svc.Start(ctx)
+
+	created, err := svc.Create(ctx, 1, models.WebhookRequest{URL: receiverURL, Events: []string{notify.EventFileDeleted}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Notify(ctx, notify.Event{ID: "evt_2", Type: notify.EventFileDeleted, UserID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	listed, _ := svc.ListDeliveries(ctx, 1, created.ID, models.DeliveryListRequest{})
+	delivery := waitForDelivery(t, deliveries, listed[0].ID)
+	if delivery.Status != models.DeliveryStatusFailed || len(delivery.Attempts) != 3 {
+		t.Errorf("status = %s after %d attempts, want failed after 3", delivery.Status, len(delivery.Attempts))
+	}
+}
+
+func TestCreateWebhookRejectsInternalURLs(t *testing.T) {
+	svc := NewWebhookService(newMemWebhooks(), newMemDeliveries(), nil, WebhookConfig{})
+	for _, url := range []string{
+		"http://127.0.0.1:8080/hook",
+		"http://localhost/hook",
+		"http://api.localhost/hook",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://10.0.0.5/hook",
+		"https://192.168.1.1/hook",
+		"http://[::1]/hook",
+		"http://[fd00::1]/hook",
+		"http://[::ffff:127.0.0.1]/hook",
+		"http://0.0.0.0/hook",
+	} {
+		_, err := svc.Create(context.Background(), 1, models.WebhookRequest{URL: url, Events: []string{notify.EventFileCreated}})
+		if !errors.Is(err, apperrors.ErrInvalidRequest) {
+			t.Errorf("Create(%s) = %v, want an invalid request", url, err)
+		}
+	}
+	if _, err := svc.Create(context.Background(), 1, models.WebhookRequest{URL: "https://hooks.example.com/in", Events: []string{notify.EventFileCreated}}); err != nil {
+		t.Errorf("Create with a public URL: %v", err)
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	svc := NewWebhookService(nil, nil, nil, WebhookConfig{RetryBase: 10 * time.Second, RetryMax: time.Minute})
+	for attempts, want := range map[int]time.Duration{
+		1: 10 * time.Second,
+		2: 20 * time.Second,
+		3: 40 * time.Second,
+		4: time.Minute,
+		9: time.Minute,
+	} {
+		if got := svc.backoff(attempts); got != want {
+			t.Errorf("backoff(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+// Package timeline buckets parsed records by time and level.
+package timeline
+
+import (
+	"errors"
+	"sort"
+	"time"
+	"user-service/internal/models"
+	"user-service/internal/parser"
+)
+
+// MaxBuckets caps the non-empty buckets of a timeline.
+const MaxBuckets = 20000
+
+// ErrTooManyBuckets is returned when a file spans more than MaxBuckets
+// non-empty buckets.
+var ErrTooManyBuckets = errors.New("too many buckets")
+
+// Sizes are the supported bucket sizes by name.
+var Sizes = map[string]time.Duration{
+	"1m": time.Minute,
+	"5m": 5 * time.Minute,
+	"1h": time.Hour,
+}
+
+// Builder accumulates records into buckets of a fixed size. Only non-empty
+// buckets are kept.
+type Builder struct {
+	size    time.Duration
+	buckets map[int64]*models.TimelineBucket
+	untimed int64
+}
+
+func NewBuilder(size time.Duration) *Builder {
+	return &Builder{size: size, buckets: make(map[int64]*models.TimelineBucket)}
+}
+
+// Add counts a record in the bucket of its timestamp.
+func (b *Builder) Add(record parser.Record) error {
+	if record.Timestamp == nil {
+		b.untimed++
+		return nil
+	}
+
+	start := record.Timestamp.UTC().Truncate(b.size)
+	bucket, ok := b.buckets[start.Unix()]
+	if !ok {
+		if len(b.buckets) >= MaxBuckets {
+			return ErrTooManyBuckets
+		}
+		bucket = &models.TimelineBucket{Start: start}
+		b.buckets[start.Unix()] = bucket
+	}
+
+	bucket.Total++
+	switch record.Level {
+	case parser.LevelError:
+		bucket.Error++
+	case parser.LevelWarn:
+		bucket.Warn++
+	case parser.LevelInfo:
+		bucket.Info++
+	case parser.LevelDebug:
+		bucket.Debug++
+	}
+	return nil
+}
+
+// Result returns the buckets in time order and the number of records
+// without a timestamp.
+func (b *Builder) Result() ([]models.TimelineBucket, int64) {
+	buckets := make([]models.TimelineBucket, 0, len(b.buckets))
+	for _, bucket := range b.buckets {
+		buckets = append(buckets, *bucket)
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].Start.Before(buckets[j].Start)
+	})
+	return buckets, b.untimed
+}
@@ -0,0 +1,157 @@
+// Package webhook sends signed JSON events to HTTP endpoints.
+//
+// Every request carries the event as its body and is signed with the
+// webhook's secret: the Signature header holds "sha256=" followed by the
+// hex HMAC-SHA256 of the Timestamp header, a ".", and the body. Receivers
+// recompute the signature with Verify and should reject old timestamps to
+// stop replays.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Request headers.
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+
+	signaturePrefix = "sha256="
+)
+
+// maxResponseBody is the number of bytes of a response read before the
+// connection is released.
+const maxResponseBody = 4 << 10
+
+// NewSecret returns a random signing secret.
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// Sign returns the Signature header value for a body sent at timestamp.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+var (
+	// ErrInvalidSignature is returned by Verify when the signature doesn't
+	// match the body.
+	ErrInvalidSignature = errors.New("webhook signature does not match")
+
+	// ErrExpired is returned by Verify when the timestamp is older than the
+	// tolerance.
+	ErrExpired = errors.New("webhook timestamp is too old")
+)
+
+// Verify checks the Signature and Timestamp headers of a received request
+// against its body. A tolerance of 0 accepts any timestamp.
+func Verify(secret string, header http.Header, body []byte, tolerance time.Duration) error {
+	timestamp, err := strconv.ParseInt(header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s header: %w", HeaderTimestamp, err)
+	}
+	expected := Sign(secret, timestamp, body)
+	if !hmac.Equal([]byte(expected), []byte(strings.TrimSpace(header.Get(HeaderSignature)))) {
+		return ErrInvalidSignature
+	}
+	if tolerance > 0 && time.Since(time.Unix(timestamp, 0)) > tolerance {
+		return ErrExpired
+	}
+	return nil
+}
+
+// Message is one delivery of an event.
+type Message struct {
+	URL        string
+	Secret     string
+	Event      string
+	DeliveryID string
+	Body       []byte
+}
+
+// Result is the outcome of a delivery attempt. StatusCode is 0 when no
+// response was received.
+type Result struct {
+	StatusCode int
+	Duration   time.Duration
+	Err        error
+}
+
+// OK reports whether the receiver accepted the event with a 2xx status.
+func (r Result) OK() bool {
+	return r.Err == nil && r.StatusCode >= 200 && r.StatusCode < 300
+}
+
+// Sender posts messages with an HTTP client. Redirects are not followed, so
+// a signed event is only ever sent to the registered URL.
+type Sender struct {
+	client *http.Client
+}
+
+// NewSender returns a Sender whose requests time out after timeout. A nil
+// client selects NewClient, which only connects to public addresses.
+func NewSender(client *http.Client, timeout time.Duration) *Sender {
+	if client == nil {
+		client = NewClient()
+	} else {
+		copied := *client
+		client = &copied
+	}
+	client.Timeout = timeout
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	return &Sender{client: client}
+}
+
+// Send signs and posts a message.
+func (s *Sender) Send(ctx context.Context, msg Message) Result {
+	start := time.Now()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, msg.URL, bytes.NewReader(msg.Body))
+	if err != nil {
+		return Result{Err: err}
+	}
+	timestamp := start.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "analyticsai-webhooks/1")
+	req.Header.Set(HeaderEvent, msg.Event)
+	req.Header.Set(HeaderDelivery, msg.DeliveryID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(msg.Secret, timestamp, msg.Body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return Result{Duration: time.Since(start), Err: err}
+	}
+	// Drain part of the body so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBody))
+	resp.Body.Close()
+
+	result := Result{StatusCode: resp.StatusCode, Duration: time.Since(start)}
+	if !result.OK() {
+		result.Err = fmt.Errorf("receiver returned HTTP %d", resp.StatusCode)
+	}
+	return result
+}
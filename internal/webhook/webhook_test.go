@@ -0,0 +1,164 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// received is a request as seen by a test receiver.
+type received struct {
+	header http.Header
+	body   []byte
+}
+
+// newReceiver starts a receiver that answers with status and passes each
+// request to requests.
+func newReceiver(t *testing.T, status int) (*httptest.Server, chan received) {
+	t.Helper()
+	requests := make(chan received, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- received{header: r.Header.Clone(), body: body}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+func TestSendSignsTimestampAndBody(t *testing.T) {
+	server, requests := newReceiver(t, http.StatusNoContent)
+	const secret = "whsec_test"
+	body := []byte(`{"id":"evt_1","type":"file.created"}`)
+
+	result := NewSender(server.Client(), 5*time.Second).Send(context.Background(), Message{
+		URL:        server.URL,
+		Secret:     secret,
+		Event:      "file.created",
+		DeliveryID: "delivery-1",
+		Body:       body,
+	})
+	if !result.OK() {
+		t.Fatalf("Send: status %d, error %v", result.StatusCode, result.Err)
+	}
+
+	got := <-requests
+	if string(got.body) != string(body) {
+		t.Errorf("body = %s, want %s", got.body, body)
+	}
+	if got.header.Get(HeaderEvent) != "file.created" || got.header.Get(HeaderDelivery) != "delivery-1" {
+		t.Errorf("event headers = %q, %q", got.header.Get(HeaderEvent), got.header.Get(HeaderDelivery))
+	}
+	if err := Verify(secret, got.header, got.body, time.Minute); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+
+	// The signature is the HMAC-SHA256 of "timestamp.body"
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(got.header.Get(HeaderTimestamp) + "." + string(body)))
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); got.header.Get(HeaderSignature) != want {
+		t.Errorf("signature = %s, want %s", got.header.Get(HeaderSignature), want)
+	}
+
+	if err := Verify("whsec_other", got.header, got.body, time.Minute); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Verify with the wrong secret = %v, want %v", err, ErrInvalidSignature)
+	}
+	if err := Verify(secret, got.header, append(got.body, ' '), time.Minute); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Verify of a changed body = %v, want %v", err, ErrInvalidSignature)
+	}
+}
+
+func TestVerifyRejectsOldTimestamps(t *testing.T) {
+	body := []byte(`{}`)
+	timestamp := time.Now().Add(-10 * time.Minute).Unix()
+	header := http.Header{}
+	header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	header.Set(HeaderSignature, Sign("secret", timestamp, body))
+
+	if err := Verify("secret", header, body, 5*time.Minute); !errors.Is(err, ErrExpired) {
+		t.Errorf("Verify = %v, want %v", err, ErrExpired)
+	}
+	if err := Verify("secret", header, body, 0); err != nil {
+		t.Errorf("Verify without a tolerance = %v", err)
+	}
+}
+
+func TestSendReportsReceiverErrors(t *testing.T) {
+	server, _ := newReceiver(t, http.StatusInternalServerError)
+
+	result := NewSender(server.Client(), 5*time.Second).Send(context.Background(), Message{URL: server.URL, Secret: "s", Body: []byte(`{}`)})
+	if result.OK() {
+		t.Fatal("Send reported success for HTTP 500")
+	}
+	if result.StatusCode != http.StatusInternalServerError || result.Err == nil {
+		t.Errorf("result = %d, %v", result.StatusCode, result.Err)
+	}
+}
+
+func TestSendDoesNotFollowRedirects(t *testing.T) {
+	target, requests := newReceiver(t, http.StatusOK)
+	redirect := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusTemporaryRedirect))
+	defer redirect.Close()
+
+	result := NewSender(redirect.Client(), 5*time.Second).Send(context.Background(), Message{URL: redirect.URL, Secret: "s", Body: []byte(`{}`)})
+	if result.OK() || result.StatusCode != http.StatusTemporaryRedirect {
+		t.Errorf("result = %d, %v, want an unaccepted redirect", result.StatusCode, result.Err)
+	}
+	select {
+	case <-requests:
+		t.Error("redirect was followed")
+	default:
+	}
+}
+
+func TestPublicAddress(t *testing.T) {
+	tests := map[string]bool{
+		"93.184.216.34":    true,
+		"2606:4700::1111":  true,
+		"127.0.0.1":        false,
+		"::1":              false,
+		"10.1.2.3":         false,
+		"172.16.0.1":       false,
+		"192.168.0.1":      false,
+		"169.254.169.254":  false,
+		"100.64.0.1":       false,
+		"0.0.0.0":          false,
+		"224.0.0.1":        false,
+		"fe80::1":          false,
+		"fd00::1":          false,
+		"::ffff:127.0.0.1": false,
+	}
+	for addr, want := range tests {
+		if got := publicAddress(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("publicAddress(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+// TestSendRefusesInternalAddresses checks that the default client refuses to
+// connect to a receiver on a loopback address, whether the URL names the
+// address or a host that resolves to it.
+func TestSendRefusesInternalAddresses(t *testing.T) {
+	server, requests := newReceiver(t, http.StatusOK)
+	for _, url := range []string{server.URL, strings.Replace(server.URL, "127.0.0.1", "localhost", 1)} {
+		result := NewSender(nil, 5*time.Second).Send(context.Background(), Message{URL: url, Secret: "s", Body: []byte(`{}`)})
+		if !errors.Is(result.Err, ErrForbiddenAddress) {
+			t.Errorf("Send(%s) = %v, want %v", url, result.Err, ErrForbiddenAddress)
+		}
+	}
+	select {
+	case <-requests:
+		t.Error("request reached the receiver")
+	default:
+	}
+}
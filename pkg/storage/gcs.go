@@ -1,16 +1,31 @@
 package storage
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"net/http"
 	"path/filepath"
 	"time"
 
 	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
 )
 
+const (
+	// maxComponents stays below the 1024 components GCS allows in a
+	// composite object. Objects that reach it are rewritten in one piece.
+	maxComponents = 1000
+
+	// appendAttempts bounds the retries of an append that lost a race with
+	// another writer.
+	appendAttempts = 5
+)
+
 type GCSConfig struct {
 	ProjectID       string
 	BucketName      string
@@ -66,6 +81,7 @@ func (g *GCSStorage) UploadFile(ctx context.Context, file io.Reader, fileName st
 		return "", fmt.Errorf("failed to close writer: %v", err)
 	}
 
+	slog.DebugContext(ctx, "Stored object", "op", "GCSStorage.UploadFile", "key", objectName, "size", writer.Attrs().Size)
 	return objectName, nil
 }
 
@@ -80,12 +96,101 @@ func (g *GCSStorage) DownloadFile(ctx context.Context, objectName string) (io.Re
 	return reader, nil
 }
 
+func (g *GCSStorage) DownloadRange(ctx context.Context, objectName string, offset, length int64) (io.ReadCloser, error) {
+	bucket := g.client.Bucket(g.bucketName)
+	obj := bucket.Object(objectName)
+	reader, err := obj.NewRangeReader(ctx, offset, length)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create range reader: %v", err)
+	}
+
+	return reader, nil
+}
+
+// AppendFile uploads data as a temporary chunk object and composes the file
+// with it. The compose only succeeds if the file is still at the generation
+// it was read at, so appends from several instances can't overwrite each
+// other; an append that loses the race is retried.
+func (g *GCSStorage) AppendFile(ctx context.Context, objectName string, data []byte) (int64, error) {
+	bucket := g.client.Bucket(g.bucketName)
+	obj := bucket.Object(objectName)
+
+	chunk := bucket.Object(fmt.Sprintf("%s.append-%d", objectName, time.Now().UnixNano()))
+	writer := chunk.NewWriter(ctx)
+	if _, err := writer.Write(data); err != nil {
+		writer.Close()
+		return 0, fmt.Errorf("failed to write append chunk: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		return 0, fmt.Errorf("failed to close append chunk: %v", err)
+	}
+	defer chunk.Delete(context.Background())
+
+	for attempt := 1; ; attempt++ {
+		attrs, err := obj.Attrs(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read object attributes: %v", err)
+		}
+
+		conditional := obj.If(storage.Conditions{GenerationMatch: attrs.Generation})
+		var size int64
+		if attrs.ComponentCount < maxComponents {
+			composer := conditional.ComposerFrom(obj, chunk)
+			composer.ContentType = attrs.ContentType
+			var composed *storage.ObjectAttrs
+			if composed, err = composer.Run(ctx); err == nil {
+				size = composed.Size
+			}
+		} else {
+			slog.DebugContext(ctx, "Rewriting composite object", "op", "GCSStorage.AppendFile", "key", objectName, "components", attrs.ComponentCount)
+			size, err = g.rewrite(ctx, obj.Generation(attrs.Generation), conditional, attrs.ContentType, data)
+		}
+		if err == nil {
+			slog.DebugContext(ctx, "Appended to object", "op", "GCSStorage.AppendFile", "key", objectName, "appended", len(data), "size", size)
+			return size, nil
+		}
+
+		var apiErr *googleapi.Error
+		if !errors.As(err, &apiErr) || apiErr.Code != http.StatusPreconditionFailed || attempt == appendAttempts {
+			return 0, fmt.Errorf("failed to append to object: %v", err)
+		}
+		slog.WarnContext(ctx, "Object changed during append, retrying", "op", "GCSStorage.AppendFile", "key", objectName, "attempt", attempt)
+	}
+}
+
+// rewrite replaces a composite object with a single-component copy of its
+// content followed by data, resetting its component count.
+func (g *GCSStorage) rewrite(ctx context.Context, current, conditional *storage.ObjectHandle, contentType string, data []byte) (int64, error) {
+	reader, err := current.NewReader(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+
+	// Cancelling the writer's context aborts the upload instead of
+	// committing a partial object
+	writeCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	writer := conditional.NewWriter(writeCtx)
+	writer.ContentType = contentType
+	if _, err := io.Copy(writer, io.MultiReader(reader, bytes.NewReader(data))); err != nil {
+		cancel()
+		writer.Close()
+		return 0, err
+	}
+	if err := writer.Close(); err != nil {
+		return 0, err
+	}
+	return writer.Attrs().Size, nil
+}
+
 func (g *GCSStorage) DeleteFile(ctx context.Context, objectName string) error {
 	bucket := g.client.Bucket(g.bucketName)
 	obj := bucket.Object(objectName)
 	if err := obj.Delete(ctx); err != nil {
 		return fmt.Errorf("failed to delete object: %v", err)
 	}
+	slog.DebugContext(ctx, "Deleted object", "op", "GCSStorage.DeleteFile", "key", objectName)
 
 	return nil
 }
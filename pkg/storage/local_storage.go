@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"time"
@@ -41,12 +42,14 @@ func (l *LocalStorage) UploadFile(ctx context.Context, file io.Reader, fileName
 	defer outFile.Close()
 
 	// Copy the content
-	if _, err := io.Copy(outFile, file); err != nil {
+	size, err := io.Copy(outFile, file)
+	if err != nil {
 		// Clean up the file if copy fails
 		os.Remove(filePath)
 		return "", fmt.Errorf("failed to copy file content: %v", err)
 	}
 
+	slog.DebugContext(ctx, "Stored object", "op", "LocalStorage.UploadFile", "key", uniqueName, "size", size)
 	return uniqueName, nil
 }
 
@@ -59,11 +62,54 @@ func (l *LocalStorage) DownloadFile(ctx context.Context, fileName string) (io.Re
 	return file, nil
 }
 
+func (l *LocalStorage) DownloadRange(ctx context.Context, fileName string, offset, length int64) (io.ReadCloser, error) {
+	filePath := filepath.Join(l.baseDir, fileName)
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %v", err)
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to seek file: %v", err)
+	}
+	if length < 0 {
+		return file, nil
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(file, length), file}, nil
+}
+
+func (l *LocalStorage) AppendFile(ctx context.Context, fileName string, data []byte) (int64, error) {
+	filePath := filepath.Join(l.baseDir, fileName)
+	// O_APPEND positions every write at the current end of the file
+	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open file: %v", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(data); err != nil {
+		return 0, fmt.Errorf("failed to append to file: %v", err)
+	}
+	if err := file.Sync(); err != nil {
+		return 0, fmt.Errorf("failed to sync file: %v", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat file: %v", err)
+	}
+	slog.DebugContext(ctx, "Appended to object", "op", "LocalStorage.AppendFile", "key", fileName, "appended", len(data), "size", info.Size())
+	return info.Size(), nil
+}
+
 func (l *LocalStorage) DeleteFile(ctx context.Context, fileName string) error {
 	filePath := filepath.Join(l.baseDir, fileName)
 	if err := os.Remove(filePath); err != nil {
 		return fmt.Errorf("failed to delete file: %v", err)
 	}
+	slog.DebugContext(ctx, "Deleted object", "op", "LocalStorage.DeleteFile", "key", fileName)
 	return nil
 }
 
@@ -18,4 +18,46 @@ type Storage interface {
 	
 	// GetFileURL returns the URL for downloading a file
 	GetFileURL(fileName string) string
-} 
\ No newline at end of file
+}
+
+// RangeReader is implemented by backends that can read part of a file
+// without downloading all of it
+type RangeReader interface {
+	// DownloadRange reads length bytes starting at offset. A negative length
+	// reads to the end of the file
+	DownloadRange(ctx context.Context, fileName string, offset, length int64) (io.ReadCloser, error)
+}
+
+// Appender is implemented by backends that can add data to the end of a
+// stored file
+type Appender interface {
+	// AppendFile durably appends data to a file and returns the file's new
+	// size. Concurrent appends to the same file are applied one after the
+	// other
+	AppendFile(ctx context.Context, fileName string, data []byte) (int64, error)
+}
+
+// ReadRange opens length bytes of a file starting at offset. Backends
+// without ranged reads download the file and skip to offset. A negative
+// length reads to the end of the file
+func ReadRange(ctx context.Context, s Storage, fileName string, offset, length int64) (io.ReadCloser, error) {
+	if rangeReader, ok := s.(RangeReader); ok {
+		return rangeReader.DownloadRange(ctx, fileName, offset, length)
+	}
+
+	reader, err := s.DownloadFile(ctx, fileName)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.CopyN(io.Discard, reader, offset); err != nil {
+		reader.Close()
+		return nil, err
+	}
+	if length < 0 {
+		return reader, nil
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(reader, length), reader}, nil
+}
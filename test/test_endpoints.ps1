@@ -42,6 +42,7 @@ try {
         -Body $bodyLines
     
     $responseContent = $fileUploadResponse.Content | ConvertFrom-Json
+    $fileId = $responseContent.data.id
     Write-Host "File upload response: $($responseContent | ConvertTo-Json)"
 }
 catch {
@@ -98,11 +99,11 @@ catch {
 }
 
 # Test download file (if we have a file ID from previous operations)
-if ($fileUploadResponse.Content.id) {
+if ($fileId) {
     Write-Host "`nTesting file download..."
     try {
-        $downloadPath = Join-Path $PSScriptRoot "downloaded_$($fileUploadResponse.Content.id).txt"
-        $downloadResponse = Invoke-RestMethod -Uri "$baseUrl/files/$($fileUploadResponse.Content.id)/download" `
+        $downloadPath = Join-Path $PSScriptRoot "downloaded_$($fileId).txt"
+        $downloadResponse = Invoke-RestMethod -Uri "$baseUrl/files/$($fileId)/download" `
             -Method GET `
             -OutFile $downloadPath
         Write-Host "File downloaded successfully to: $downloadPath"
@@ -112,11 +113,398 @@ if ($fileUploadResponse.Content.id) {
     }
 }
 
+# Test preview file
+if ($fileId) {
+    Write-Host "`nTesting file preview..."
+    foreach ($query in @("head=2", "tail=2", "from_line=2&to_line=3")) {
+        try {
+            $previewResponse = Invoke-RestMethod -Uri "$baseUrl/files/$($fileId)/preview?$query" -Method GET
+            $numbers = ($previewResponse.data.lines | ForEach-Object { $_.number }) -join ","
+            Write-Host "Preview ($query) returned lines: $numbers"
+        }
+        catch {
+            Write-Host "Preview ($query) failed: $($_.Exception.Message)"
+        }
+    }
+}
+
+# Test search file
+if ($fileId) {
+    Write-Host "`nTesting file search..."
+    try {
+        $searchResponse = Invoke-WebRequest -Uri "$baseUrl/files/$($fileId)/search?q=line&ignore_case=true&context=1" -Method GET
+        $results = $searchResponse.Content -split "`n" | Where-Object { $_ } | ForEach-Object { $_ | ConvertFrom-Json }
+        $summary = $results | Where-Object { $_.type -eq "summary" }
+        Write-Host "Search returned $($summary.matches) matches in $($summary.lines_scanned) lines"
+    }
+    catch {
+        Write-Host "Search failed: $($_.Exception.Message)"
+    }
+}
+
+# Test message templates; analysis runs in the background, so give it a moment
+if ($fileId) {
+    Write-Host "`nTesting file patterns..."
+    Start-Sleep -Seconds 2
+    try {
+        $patternsResponse = Invoke-RestMethod -Uri "$baseUrl/files/$($fileId)/patterns" -Method GET
+        foreach ($pattern in $patternsResponse.data.patterns.patterns) {
+            Write-Host "$($pattern.count) x $($pattern.template)"
+        }
+    }
+    catch {
+        Write-Host "Patterns failed: $($_.Exception.Message)"
+    }
+}
+
+# Test timeline
+if ($fileId) {
+    Write-Host "`nTesting file timeline..."
+    try {
+        $timelineResponse = Invoke-RestMethod -Uri "$baseUrl/files/$($fileId)/timeline?bucket=1m" -Method GET
+        Write-Host "Timeline returned $($timelineResponse.data.timeline.buckets.Count) buckets, $($timelineResponse.data.timeline.untimed) untimed records"
+    }
+    catch {
+        Write-Host "Timeline failed: $($_.Exception.Message)"
+    }
+}
+
+# Test export, streamed and as a background job
+if ($fileId) {
+    Write-Host "`nTesting export..."
+    try {
+        $exportResponse = Invoke-WebRequest -Uri "$baseUrl/files/$($fileId)/export?format=csv&fields=line,level,message" -Method GET
+        Write-Host "CSV export: $($exportResponse.Content.Split("`n").Count) lines"
+        $jobResponse = Invoke-RestMethod -Uri "$baseUrl/files/$($fileId)/export?format=parquet&async=true" -Method GET
+        $jobId = $jobResponse.data.id
+        Start-Sleep -Seconds 2
+        $jobResponse = Invoke-RestMethod -Uri "$baseUrl/jobs/$jobId" -Method GET
+        Write-Host "Export job $jobId is $($jobResponse.data.status), result file: $($jobResponse.data.result_file_id)"
+        if ($jobResponse.data.result_file_id) {
+            Invoke-RestMethod -Uri "$baseUrl/files/$($jobResponse.data.result_file_id)" -Method DELETE | Out-Null
+        }
+    }
+    catch {
+        Write-Host "Export failed: $($_.Exception.Message)"
+    }
+}
+
+# Test appending lines to a file
+if ($fileId) {
+    Write-Host "`nTesting append..."
+    try {
+        $appendBody = "Appended line 1`nAppended line 2`n"
+        $appendResponse = Invoke-RestMethod -Uri "$baseUrl/files/$($fileId)/append" -Method Post -Body $appendBody -ContentType "text/plain"
+        Write-Host "File is now $($appendResponse.data.size) bytes at version $($appendResponse.data.version)"
+    }
+    catch {
+        Write-Host "Append failed: $($_.Exception.Message)"
+    }
+}
+
+# Test tailing a file: read the first events, then disconnect
+if ($fileId) {
+    Write-Host "`nTesting tail..."
+    try {
+        $client = New-Object System.Net.Http.HttpClient
+        $tailResponse = $client.GetAsync("$baseUrl/files/$($fileId)/tail?lines=2", [System.Net.Http.HttpCompletionOption]::ResponseHeadersRead).Result
+        $tailReader = New-Object System.IO.StreamReader($tailResponse.Content.ReadAsStreamAsync().Result)
+        Write-Host "Tail started with: $($tailReader.ReadLine()) $($tailReader.ReadLine())"
+        $tailReader.Dispose()
+        $client.Dispose()
+    }
+    catch {
+        Write-Host "Tail failed: $($_.Exception.Message)"
+    }
+}
+
+# Test merging two files, streamed and saved as a new file
+if ($fileId) {
+    Write-Host "`nTesting merge..."
+    try {
+        $mergeBoundary = [System.Guid]::NewGuid().ToString()
+        $mergeBody = @(
+            "--$mergeBoundary",
+            "Content-Disposition: form-data; name=`"file`"; filename=`"service.log`"",
+            "Content-Type: text/plain",
+            "",
+            "2024-03-20T09:59:58Z ERROR upstream timeout",
+            "2024-03-20T09:59:59Z WARN slow query",
+            "--$mergeBoundary--"
+        ) -join $LF
+        $secondResponse = Invoke-RestMethod -Uri "$baseUrl/files/upload" -Method Post `
+            -ContentType "multipart/form-data; boundary=$mergeBoundary" -Body $mergeBody
+        $secondId = $secondResponse.data.id
+        Start-Sleep -Seconds 1
+
+        $mergeRequest = @{ file_ids = @($fileId, $secondId); format = "text" } | ConvertTo-Json
+        $mergeResponse = Invoke-WebRequest -Uri "$baseUrl/files/merge" -Method Post -Body $mergeRequest -ContentType "application/json"
+        Write-Host "Merged stream: $($mergeResponse.Content.Split("`n").Count) lines"
+
+        $saveRequest = @{ file_ids = @($fileId, $secondId); save = $true; name = "incident" } | ConvertTo-Json
+        $jobResponse = Invoke-RestMethod -Uri "$baseUrl/files/merge" -Method Post -Body $saveRequest -ContentType "application/json"
+        Start-Sleep -Seconds 2
+        $jobResponse = Invoke-RestMethod -Uri "$baseUrl/jobs/$($jobResponse.data.id)" -Method GET
+        Write-Host "Merge job is $($jobResponse.data.status), result file: $($jobResponse.data.result_file_id)"
+        if ($jobResponse.data.result_file_id) {
+            Invoke-RestMethod -Uri "$baseUrl/files/$($jobResponse.data.result_file_id)" -Method DELETE | Out-Null
+        }
+        Invoke-RestMethod -Uri "$baseUrl/files/$secondId" -Method DELETE | Out-Null
+    }
+    catch {
+        Write-Host "Merge failed: $($_.Exception.Message)"
+    }
+}
+
+# Test saved queries: save a query, upload a tagged file that matches it,
+# then check for an alert once analysis has run
+Write-Host "`nTesting saved queries and alerts..."
+try {
+    $queryBody = @{
+        name = "test errors"
+        query = "error"
+        ignore_case = $true
+        filter = @{ tags = @("alert-test") }
+        threshold = 1
+    } | ConvertTo-Json
+    $queryResponse = Invoke-RestMethod -Uri "$baseUrl/queries" -Method Post -Body $queryBody -ContentType "application/json"
+    $queryId = $queryResponse.data.id
+    Write-Host "Saved query: $queryId"
+
+    $tagBoundary = [System.Guid]::NewGuid().ToString()
+    $tagBody = @(
+        "--$tagBoundary",
+        "Content-Disposition: form-data; name=`"tags`"",
+        "",
+        "alert-test,ci",
+        "--$tagBoundary",
+        "Content-Disposition: form-data; name=`"file`"; filename=`"errors.log`"",
+        "Content-Type: text/plain",
+        "",
+        "ERROR one`nok`nERROR two`nERROR three",
+        "--$tagBoundary--"
+    ) -join $LF
+    $tagResponse = Invoke-RestMethod -Uri "$baseUrl/files/upload" -Method Post `
+        -ContentType "multipart/form-data; boundary=$tagBoundary" -Body $tagBody
+    Write-Host "Tags: $($tagResponse.data.tags -join ', ')"
+
+    $tagged = Invoke-RestMethod -Uri "$baseUrl/files?tag=alert-test" -Method GET
+    Write-Host "Files tagged alert-test: $($tagged.data.Count)"
+
+    Start-Sleep -Seconds 2
+    $alerts = Invoke-RestMethod -Uri "$baseUrl/alerts?query_id=$queryId" -Method GET
+    if ($alerts.data.Count -eq 1 -and $alerts.data[0].matches -eq 3) {
+        Write-Host "PASS: query alerted with 3 matches"
+    }
+    else {
+        Write-Host "FAIL: expected one alert with 3 matches, got $($alerts.data | ConvertTo-Json -Depth 4)"
+    }
+
+    Invoke-RestMethod -Uri "$baseUrl/queries/$queryId" -Method DELETE | Out-Null
+    Invoke-RestMethod -Uri "$baseUrl/files/$($tagResponse.data.id)" -Method DELETE | Out-Null
+}
+catch {
+    Write-Host "Saved queries failed: $($_.Exception.Message)"
+}
+
+# Test webhooks: a local receiver is refused, and a public one gets a
+# delivery for each uploaded file
+Write-Host "`nTesting webhooks..."
+try {
+    $localHook = @{ url = "http://localhost:8089/hook"; events = @("file.created") } | ConvertTo-Json
+    Invoke-RestMethod -Uri "$baseUrl/webhooks" -Method Post -Body $localHook -ContentType "application/json" | Out-Null
+    Write-Host "FAIL: webhook to localhost was registered"
+}
+catch {
+    if ($_.Exception.Response.StatusCode.value__ -eq 400) {
+        Write-Host "PASS: webhook to localhost rejected"
+    }
+    else {
+        Write-Host "FAIL: expected 400 for a localhost webhook, got $($_.Exception.Message)"
+    }
+}
+try {
+    $hookBody = @{ url = "https://example.com/hooks/analyticsai"; events = @("file.created") } | ConvertTo-Json
+    $hookResponse = Invoke-RestMethod -Uri "$baseUrl/webhooks" -Method Post -Body $hookBody -ContentType "application/json"
+    $hookId = $hookResponse.data.id
+    Write-Host "Registered webhook: $hookId"
+
+    $hookBoundary = [System.Guid]::NewGuid().ToString()
+    $hookUpload = @(
+        "--$hookBoundary",
+        "Content-Disposition: form-data; name=`"file`"; filename=`"hook.log`"",
+        "Content-Type: text/plain",
+        "",
+        "webhook test line",
+        "--$hookBoundary--"
+    ) -join $LF
+    $hookFile = Invoke-RestMethod -Uri "$baseUrl/files/upload" -Method Post `
+        -ContentType "multipart/form-data; boundary=$hookBoundary" -Body $hookUpload
+
+    Start-Sleep -Seconds 1
+    $deliveries = Invoke-RestMethod -Uri "$baseUrl/webhooks/$hookId/deliveries" -Method GET
+    if ($deliveries.data.Count -eq 1 -and ($deliveries.data[0].payload | ConvertFrom-Json).data.id -eq $hookFile.data.id) {
+        Write-Host "PASS: file.created delivery recorded with status $($deliveries.data[0].status)"
+    }
+    else {
+        Write-Host "FAIL: expected one delivery for $($hookFile.data.id), got $($deliveries.data | ConvertTo-Json -Depth 5)"
+    }
+    $redelivery = Invoke-RestMethod -Uri "$baseUrl/webhooks/$hookId/deliveries/$($deliveries.data[0].id)/redeliver" -Method Post
+    Write-Host "Redelivery queued: $($redelivery.data.id)"
+
+    Invoke-RestMethod -Uri "$baseUrl/webhooks/$hookId" -Method DELETE | Out-Null
+    Invoke-RestMethod -Uri "$baseUrl/files/$($hookFile.data.id)" -Method DELETE | Out-Null
+}
+catch {
+    Write-Host "Webhooks failed: $($_.Exception.Message)"
+}
+
+# Test the audit log: preview a file under a known request ID, then find
+# the entry, export it and verify the hash chain. Requires the server to run
+# with ADMIN_USER_IDS=1 (and AUDIT_HASH_CHAIN=true for the chain check).
+if ($fileId) {
+    Write-Host "`nTesting audit log..."
+    try {
+        $requestId = "audit-test-" + [System.Guid]::NewGuid().ToString()
+        $preview = Invoke-WebRequest -Uri "$baseUrl/files/$($fileId)/preview" -Method GET -Headers @{ "X-Request-ID" = $requestId }
+        if ($preview.Headers["X-Request-ID"] -eq $requestId) {
+            Write-Host "PASS: request ID echoed"
+        }
+        else {
+            Write-Host "FAIL: expected X-Request-ID $requestId, got $($preview.Headers["X-Request-ID"])"
+        }
+
+        $entries = Invoke-RestMethod -Uri "$baseUrl/admin/audit?request_id=$requestId" -Method GET
+        $entry = $entries.data[0]
+        if ($entries.data.Count -eq 1 -and $entry.action -eq "file.preview" -and $entry.file_id -eq $fileId -and $entry.outcome -eq "success") {
+            Write-Host "PASS: audit entry recorded for $($entry.action) by user $($entry.actor_id) from $($entry.ip)"
+        }
+        else {
+            Write-Host "FAIL: unexpected audit entries: $($entries.data | ConvertTo-Json -Depth 3)"
+        }
+
+        $export = Invoke-WebRequest -Uri "$baseUrl/admin/audit/export?file_id=$fileId" -Method GET
+        $lines = @($export.Content -split "`n" | Where-Object { $_ })
+        Write-Host "Exported $($lines.Count) audit entries for the file as $($export.Headers["Content-Type"])"
+
+        $verification = Invoke-RestMethod -Uri "$baseUrl/admin/audit/verify" -Method GET
+        if ($verification.data.valid) {
+            Write-Host "PASS: audit chain valid over $($verification.data.entries) entries"
+        }
+        else {
+            Write-Host "FAIL: audit chain broken at $($verification.data.broken_at): $($verification.data.reason)"
+        }
+    }
+    catch {
+        Write-Host "Audit log failed: $($_.Exception.Message)"
+    }
+}
+
+# Test the Prometheus metrics, served next to the API rather than under it
+Write-Host "`nTesting metrics..."
+try {
+    $metricsResponse = Invoke-WebRequest -Uri "$($baseUrl -replace '/api/v1$', '')/metrics" -Method GET
+    $served = $metricsResponse.Content -split "`n" | Where-Object { $_ -like 'analyticsai_http_requests_total{*route="/api/v1/files/upload"*' }
+    if ($served) {
+        Write-Host "PASS: upload requests counted: $($served -join ', ')"
+    }
+    else {
+        Write-Host "FAIL: no request metrics for the upload route"
+    }
+    $uploaded = $metricsResponse.Content -split "`n" | Where-Object { $_ -like "analyticsai_file_uploaded_bytes_total *" }
+    Write-Host "Uploaded bytes: $uploaded"
+}
+catch {
+    Write-Host "Metrics failed: $($_.Exception.Message)"
+}
+
+# Test search across all files
+Write-Host "`nTesting cross-file search..."
+try {
+    $librarySearchResponse = Invoke-RestMethod -Uri "$baseUrl/search?q=sample%20content" -Method GET
+    Write-Host "Cross-file search matched $($librarySearchResponse.data.results.Count) files"
+}
+catch {
+    Write-Host "Cross-file search failed: $($_.Exception.Message)"
+}
+
+# Test settings and a masked upload
+Write-Host "`nTesting settings..."
+try {
+    $settingsBody = @{ redaction_mode = "report" } | ConvertTo-Json
+    $settingsResponse = Invoke-RestMethod -Uri "$baseUrl/settings" -Method PUT -Body $settingsBody -ContentType "application/json"
+    Write-Host "Redaction mode set to: $($settingsResponse.data.redaction_mode)"
+    $settingsResponse = Invoke-RestMethod -Uri "$baseUrl/settings" -Method GET
+    Write-Host "Settings: $($settingsResponse.data | ConvertTo-Json)"
+}
+catch {
+    Write-Host "Settings failed: $($_.Exception.Message)"
+}
+
+Write-Host "`nTesting redacted upload..."
+try {
+    $piiBoundary = [System.Guid]::NewGuid().ToString()
+    $piiBody = @(
+        "--$piiBoundary",
+        "Content-Disposition: form-data; name=`"redaction`"",
+        "",
+        "mask",
+        "--$piiBoundary",
+        "Content-Disposition: form-data; name=`"file`"; filename=`"pii.log`"",
+        "Content-Type: text/plain",
+        "",
+        "login alice@example.com from 10.0.0.1 card 4111 1111 1111 1111",
+        "--$piiBoundary--"
+    ) -join $LF
+    $piiResponse = Invoke-RestMethod -Uri "$baseUrl/files/upload" -Method Post `
+        -ContentType "multipart/form-data; boundary=$piiBoundary" -Body $piiBody
+    Write-Host "Redaction report: $($piiResponse.data.redaction | ConvertTo-Json)"
+    Invoke-RestMethod -Uri "$baseUrl/files/$($piiResponse.data.id)" -Method DELETE | Out-Null
+
+    $settingsBody = @{ redaction_mode = "" } | ConvertTo-Json
+    Invoke-RestMethod -Uri "$baseUrl/settings" -Method PUT -Body $settingsBody -ContentType "application/json" | Out-Null
+}
+catch {
+    Write-Host "Redacted upload failed: $($_.Exception.Message)"
+}
+
+# Test archive extraction
+Write-Host "`nTesting archive extraction..."
+try {
+    $zipPath = Join-Path $PSScriptRoot "bundle.zip"
+    Compress-Archive -Path $filePath -DestinationPath $zipPath -Force
+    $zipEnc = [System.Text.Encoding]::GetEncoding('ISO-8859-1').GetString([System.IO.File]::ReadAllBytes($zipPath))
+    $zipBoundary = [System.Guid]::NewGuid().ToString()
+    $zipBody = @(
+        "--$zipBoundary",
+        "Content-Disposition: form-data; name=`"extract`"",
+        "",
+        "true",
+        "--$zipBoundary",
+        "Content-Disposition: form-data; name=`"file`"; filename=`"bundle.zip`"",
+        "Content-Type: application/zip",
+        "",
+        $zipEnc,
+        "--$zipBoundary--"
+    ) -join $LF
+    $zipResponse = Invoke-WebRequest -Uri "$baseUrl/files/upload" -Method Post `
+        -ContentType "multipart/form-data; boundary=$zipBoundary" `
+        -Body ([System.Text.Encoding]::GetEncoding('ISO-8859-1').GetBytes($zipBody))
+    $archiveId = ($zipResponse.Content | ConvertFrom-Json).data.id
+    $childrenResponse = Invoke-RestMethod -Uri "$baseUrl/files?parent_id=$archiveId" -Method GET
+    Write-Host "Archive extracted into $($childrenResponse.data.files.Count) files"
+    Invoke-RestMethod -Uri "$baseUrl/files/$archiveId" -Method DELETE | Out-Null
+    Remove-Item $zipPath
+}
+catch {
+    Write-Host "Archive extraction failed: $($_.Exception.Message)"
+}
+
 # Test hide file
-if ($fileUploadResponse.Content.id) {
+if ($fileId) {
     Write-Host "`nTesting hide file..."
     try {
-        $hideResponse = Invoke-RestMethod -Uri "$baseUrl/files/$($fileUploadResponse.Content.id)/hide" -Method PATCH
+        $hideResponse = Invoke-RestMethod -Uri "$baseUrl/files/$($fileId)/hide" -Method PATCH
         Write-Host "Hide file response: $($hideResponse | ConvertTo-Json)"
     }
     catch {
@@ -124,11 +512,56 @@ if ($fileUploadResponse.Content.id) {
     }
 }
 
+# Test quota overrides (requires the test user to be in ADMIN_USER_IDS)
+Write-Host "`nTesting quota overrides..."
+try {
+    $limits = @{ max_bytes = 1048576; max_files = 5 } | ConvertTo-Json
+    $quota = Invoke-RestMethod -Uri "$baseUrl/admin/quotas/1" -Method PUT -Body $limits -ContentType "application/json"
+    if ($quota.data.max_bytes -eq 1048576 -and $quota.data.max_files -eq 5) {
+        Write-Host "PASS: Quota overrides applied"
+    }
+    else {
+        Write-Host "FAIL: Quota overrides not applied: $($quota.data | ConvertTo-Json)"
+    }
+
+    $usage = Invoke-RestMethod -Uri "$baseUrl/usage" -Method GET
+    if ($usage.data.max_files -eq 5) {
+        Write-Host "PASS: Usage reports the override"
+    }
+    else {
+        Write-Host "FAIL: Usage reports max_files $($usage.data.max_files)"
+    }
+
+    # Clearing the overrides restores the defaults
+    $cleared = Invoke-RestMethod -Uri "$baseUrl/admin/quotas/1" -Method PUT -Body "{}" -ContentType "application/json"
+    Write-Host "Quota after clearing overrides: $($cleared.data | ConvertTo-Json)"
+
+    $audit = Invoke-RestMethod -Uri "$baseUrl/admin/audit?action=quota.update&limit=1" -Method GET
+    if ($audit.data.Count -eq 1 -and $audit.data[0].outcome -eq "success") {
+        Write-Host "PASS: Quota update was audited"
+    }
+    else {
+        Write-Host "FAIL: Quota update was not audited"
+    }
+}
+catch {
+    Write-Host "Quota override test failed: $($_.Exception.Message)"
+}
+
+try {
+    Invoke-RestMethod -Uri "$baseUrl/admin/quotas/1" -Method PUT -Body '{"max_bytes":-1}' -ContentType "application/json" | Out-Null
+    Write-Host "FAIL: Negative quota limit was accepted"
+}
+catch {
+    $statusCode = [int]$_.Exception.Response.StatusCode
+    Write-Host "Negative quota limit returned $statusCode (expected 400)"
+}
+
 # Test delete file
-if ($fileUploadResponse.Content.id) {
+if ($fileId) {
     Write-Host "`nTesting delete file..."
     try {
-        $deleteResponse = Invoke-RestMethod -Uri "$baseUrl/files/$($fileUploadResponse.Content.id)" -Method DELETE
+        $deleteResponse = Invoke-RestMethod -Uri "$baseUrl/files/$($fileId)" -Method DELETE
         Write-Host "Delete file response: $($deleteResponse | ConvertTo-Json)"
     }
     catch {
@@ -136,6 +569,106 @@ if ($fileUploadResponse.Content.id) {
     }
 }
 
+# Test not-found handling: every file operation on a nonexistent ID must
+# return 404 with the FILE_NOT_FOUND error code
+function Test-NotFound {
+    param (
+        [string]$Name,
+        [string]$Method,
+        [string]$Uri,
+        [string]$Code = "FILE_NOT_FOUND",
+        [string]$Body
+    )
+
+    try {
+        if ($Body) {
+            Invoke-RestMethod -Uri $Uri -Method $Method -Body $Body -ContentType "text/plain" | Out-Null
+        }
+        else {
+            Invoke-RestMethod -Uri $Uri -Method $Method | Out-Null
+        }
+        Write-Host "FAIL: $Name returned success for a nonexistent resource"
+    }
+    catch {
+        $statusCode = [int]$_.Exception.Response.StatusCode
+        $body = $_.ErrorDetails.Message | ConvertFrom-Json
+        if ($statusCode -eq 404 -and $body.error.code -eq $Code) {
+            Write-Host "PASS: $Name returned 404 $Code"
+        }
+        else {
+            Write-Host "FAIL: $Name returned $statusCode $($body.error.code)"
+        }
+    }
+}
+
+Write-Host "`nTesting not-found handling..."
+$missingId = "000000000000000000000000"
+Test-NotFound -Name "Download" -Method GET -Uri "$baseUrl/files/$missingId/download"
+Test-NotFound -Name "Preview" -Method GET -Uri "$baseUrl/files/$missingId/preview"
+Test-NotFound -Name "Search" -Method GET -Uri "$baseUrl/files/$missingId/search?q=error"
+Test-NotFound -Name "Export" -Method GET -Uri "$baseUrl/files/$missingId/export?format=csv"
+Test-NotFound -Name "Analysis" -Method GET -Uri "$baseUrl/files/$missingId/analysis"
+Test-NotFound -Name "Patterns" -Method GET -Uri "$baseUrl/files/$missingId/patterns"
+Test-NotFound -Name "Timeline" -Method GET -Uri "$baseUrl/files/$missingId/timeline?bucket=1m"
+Test-NotFound -Name "Append" -Method POST -Uri "$baseUrl/files/$missingId/append" -Body "a new line`n"
+Test-NotFound -Name "Tail" -Method GET -Uri "$baseUrl/files/$missingId/tail"
+Test-NotFound -Name "Job" -Method GET -Uri "$baseUrl/jobs/$missingId" -Code "NOT_FOUND"
+Test-NotFound -Name "Query" -Method GET -Uri "$baseUrl/queries/$missingId" -Code "NOT_FOUND"
+Test-NotFound -Name "Webhook" -Method GET -Uri "$baseUrl/webhooks/$missingId" -Code "NOT_FOUND"
+Test-NotFound -Name "Hide" -Method PATCH -Uri "$baseUrl/files/$missingId/hide"
+Test-NotFound -Name "Delete" -Method DELETE -Uri "$baseUrl/files/$missingId"
+
+# Test deleted-file handling: the file deleted above keeps its record, and
+# every operation that reads or changes it must return 409 INVALID_STATE
+function Test-Deleted {
+    param (
+        [string]$Name,
+        [string]$Method,
+        [string]$Uri,
+        [string]$Body
+    )
+
+    try {
+        if ($Body) {
+            Invoke-RestMethod -Uri $Uri -Method $Method -Body $Body -ContentType "text/plain" | Out-Null
+        }
+        else {
+            Invoke-RestMethod -Uri $Uri -Method $Method | Out-Null
+        }
+        Write-Host "FAIL: $Name returned success for a deleted file"
+    }
+    catch {
+        $statusCode = [int]$_.Exception.Response.StatusCode
+        $body = $_.ErrorDetails.Message | ConvertFrom-Json
+        if ($statusCode -eq 409 -and $body.error.code -eq "INVALID_STATE") {
+            Write-Host "PASS: $Name returned 409 INVALID_STATE"
+        }
+        else {
+            Write-Host "FAIL: $Name returned $statusCode $($body.error.code)"
+        }
+    }
+}
+
+if ($fileId) {
+    Write-Host "`nTesting deleted-file handling..."
+    $deleted = Invoke-RestMethod -Uri "$baseUrl/files/$fileId" -Method GET
+    if ($deleted.data.status -eq "deleted") {
+        Write-Host "PASS: Deleted file's record is returned with status deleted"
+    }
+    else {
+        Write-Host "FAIL: Deleted file has status $($deleted.data.status)"
+    }
+    Test-Deleted -Name "Download" -Method GET -Uri "$baseUrl/files/$fileId/download"
+    Test-Deleted -Name "Preview" -Method GET -Uri "$baseUrl/files/$fileId/preview"
+    Test-Deleted -Name "Search" -Method GET -Uri "$baseUrl/files/$fileId/search?q=error"
+    Test-Deleted -Name "Timeline" -Method GET -Uri "$baseUrl/files/$fileId/timeline?bucket=1m"
+    Test-Deleted -Name "Export" -Method GET -Uri "$baseUrl/files/$fileId/export?format=csv"
+    Test-Deleted -Name "Append" -Method POST -Uri "$baseUrl/files/$fileId/append" -Body "a new line`n"
+    Test-Deleted -Name "Tail" -Method GET -Uri "$baseUrl/files/$fileId/tail"
+    Test-Deleted -Name "Hide" -Method PATCH -Uri "$baseUrl/files/$fileId/hide"
+    Test-Deleted -Name "Delete" -Method DELETE -Uri "$baseUrl/files/$fileId"
+}
+
 # Clean up test file
 if (Test-Path $filePath) {
     Remove-Item -Path $filePath -Force